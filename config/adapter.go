@@ -0,0 +1,73 @@
+package config
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/freelan-developers/go-freelan/tuntap"
+)
+
+// AdapterMode selects whether the adapter operates at the link layer (tap)
+// or at the network layer (tun).
+type AdapterMode string
+
+const (
+	// AdapterModeTap opens a tap (Ethernet) adapter.
+	AdapterModeTap AdapterMode = "tap"
+	// AdapterModeTun opens a tun (IP) adapter.
+	AdapterModeTun AdapterMode = "tun"
+)
+
+// AdapterConfig holds the settings used to build the tun/tap adapter.
+type AdapterConfig struct {
+	// Mode selects the tap or tun adapter. It defaults to AdapterModeTap.
+	Mode AdapterMode
+
+	// Name is the name of the adapter to open.
+	//
+	// The exact value of this field is operating-system-dependant.
+	//
+	// On most systems, specifying an empty name will trigger auto-assignation
+	// or device creation.
+	Name string
+
+	// IPv4 is an IPv4 CIDR to set on the interface after it goes up.
+	IPv4 *net.IPNet
+
+	// IPv6 is an IPv6 CIDR to set on the interface after it goes up.
+	IPv6 *net.IPNet
+
+	// MTU is the MTU to set on the interface after it goes up.
+	//
+	// A zero value leaves the operating system's default MTU untouched.
+	MTU int
+
+	// DisableARP disables the ARP proxy.
+	//
+	// This is ignored on tun adapters.
+	DisableARP bool
+
+	// DisableDHCP disables the fake DHCP server.
+	DisableDHCP bool
+}
+
+// build opens the adapter described by the configuration.
+func (a *AdapterConfig) build() (tuntap.Adapter, error) {
+	config := &tuntap.AdapterConfig{
+		Name:        a.Name,
+		IPv4:        a.IPv4,
+		IPv6:        a.IPv6,
+		MTU:         a.MTU,
+		DisableARP:  a.DisableARP,
+		DisableDHCP: a.DisableDHCP,
+	}
+
+	switch a.Mode {
+	case "", AdapterModeTap:
+		return tuntap.NewTapAdapter(config)
+	case AdapterModeTun:
+		return tuntap.NewTunAdapter(config)
+	default:
+		return nil, fmt.Errorf("unsupported adapter mode: %q", a.Mode)
+	}
+}
@@ -0,0 +1,154 @@
+// Package config implements loading of the go-freelan node configuration
+// from a single HJSON file, mirroring the way Yggdrasil loads its whole node
+// configuration from a commented, BOM-tolerant HJSON document.
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/hjson/hjson-go"
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/freelan-developers/go-freelan/fscp"
+	"github.com/freelan-developers/go-freelan/routing"
+	"github.com/freelan-developers/go-freelan/tuntap"
+)
+
+// Config is the root of a go-freelan node configuration.
+type Config struct {
+	// Security holds the settings used to build the fscp.ClientSecurity.
+	Security SecurityConfig
+
+	// Adapter holds the settings used to build the tun/tap adapter.
+	Adapter AdapterConfig
+
+	// Listen is the local FSCP listen address, in `host:port` form.
+	Listen string
+
+	// Contacts is a static list of FSCP remote addresses to connect to on
+	// startup.
+	Contacts []string
+
+	// Routes is the list of routes to push through the routing.Router once
+	// the adapter is up.
+	Routes []RouteConfig
+}
+
+// LoadFile loads a Config from an HJSON file at path.
+func LoadFile(path string) (*Config, error) {
+	raw, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, fmt.Errorf("reading configuration file %q: %s", path, err)
+	}
+
+	raw = stripBOM(raw)
+
+	var decoded map[string]interface{}
+
+	if err := hjson.Unmarshal(raw, &decoded); err != nil {
+		return nil, fmt.Errorf("parsing configuration file %q: %s", path, err)
+	}
+
+	config := &Config{}
+
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		Result:           config,
+		WeaklyTypedInput: true,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("instanciating the configuration decoder: %s", err)
+	}
+
+	if err := decoder.Decode(decoded); err != nil {
+		return nil, fmt.Errorf("decoding configuration file %q: %s", path, err)
+	}
+
+	return config, nil
+}
+
+// stripBOM removes a leading UTF-8 byte-order mark, if any.
+func stripBOM(raw []byte) []byte {
+	const bom = "\xef\xbb\xbf"
+
+	if len(raw) >= len(bom) && string(raw[:len(bom)]) == bom {
+		return raw[len(bom):]
+	}
+
+	return raw
+}
+
+// Build instantiates the runtime components described by the configuration:
+// the FSCP client, the tun/tap adapter, and the routes pushed through the
+// operating system's routing table.
+//
+// Contacts are dialed in the background: a failure to reach one of them is
+// not considered fatal.
+func (c *Config) Build(ctx context.Context) (*fscp.Client, tuntap.Adapter, error) {
+	security, err := c.Security.build()
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("building the client security: %s", err)
+	}
+
+	laddr, err := net.ResolveUDPAddr("udp", c.Listen)
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("resolving listen address %q: %s", c.Listen, err)
+	}
+
+	conn, err := net.ListenUDP("udp", laddr)
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("listening on %q: %s", c.Listen, err)
+	}
+
+	client, err := fscp.NewClient(fscp.NewUDPTransport(conn), security, nil)
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("instanciating the FSCP client: %s", err)
+	}
+
+	adapter, err := c.Adapter.build()
+
+	if err != nil {
+		client.Close()
+
+		return nil, nil, fmt.Errorf("building the adapter: %s", err)
+	}
+
+	router := routing.NewRouter()
+
+	for _, route := range c.Routes {
+		if _, err := router.AddRoute(route.Network, route.Gateway); err != nil && !errors.Is(err, routing.ErrRouteExists) {
+			client.Close()
+			adapter.Close()
+
+			return nil, nil, fmt.Errorf("adding route %s -> %s: %s", route.Network, route.Gateway, err)
+		}
+	}
+
+	for _, contact := range c.Contacts {
+		raddr, err := fscp.ResolveFSCPAddr(fscp.Network, contact)
+
+		if err != nil {
+			client.Close()
+			adapter.Close()
+
+			return nil, nil, fmt.Errorf("resolving contact %q: %s", contact, err)
+		}
+
+		go func(raddr *fscp.Addr) {
+			// Best-effort: a contact that can't be reached yet will be
+			// retried once it shows up as an incoming connection instead.
+			client.DialContext(ctx, raddr)
+		}(raddr)
+	}
+
+	return client, adapter, nil
+}
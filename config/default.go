@@ -0,0 +1,46 @@
+package config
+
+// defaultTemplate is the fully-commented HJSON template returned by
+// GenerateDefault, meant to be written to disk and edited by hand.
+const defaultTemplate = `{
+  # The local FSCP listen address, in "host:port" form.
+  listen: "0.0.0.0:5000"
+
+  security: {
+    # Path to a PEM-encoded certificate (X.509 or a compact CertificateV2
+    # envelope) and its associated private key. Leave both empty to fall
+    # back to a preshared key.
+    certificateFile: ""
+    privateKeyFile: ""
+
+    # Used when certificateFile is empty.
+    presharedKeyPassphrase: ""
+    presharedKeySalt: "freelan"
+    presharedKeyIterations: 2000
+
+    # Leave empty to use the fscp package's defaults.
+    cipherSuites: []
+    ellipticCurves: []
+  }
+
+  adapter: {
+    # "tap" (Ethernet) or "tun" (IP).
+    mode: "tap"
+    name: ""
+    disableARP: false
+    disableDHCP: false
+  }
+
+  # A static list of "host:port" addresses to connect to on startup.
+  contacts: []
+
+  # Routes to push once the adapter is up.
+  routes: []
+}
+`
+
+// GenerateDefault returns a fully-commented HJSON configuration template
+// meant to be written to disk and edited by hand.
+func GenerateDefault() string {
+	return defaultTemplate
+}
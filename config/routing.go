@@ -0,0 +1,13 @@
+package config
+
+import "net"
+
+// RouteConfig describes a single route to push through the routing.Router
+// once the adapter is up.
+type RouteConfig struct {
+	// Network is the destination network of the route.
+	Network *net.IPNet
+
+	// Gateway is the gateway to route Network through.
+	Gateway net.IP
+}
@@ -0,0 +1,187 @@
+package config
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+
+	"github.com/freelan-developers/go-freelan/fscp"
+)
+
+// SecurityConfig holds the settings used to build a fscp.ClientSecurity.
+type SecurityConfig struct {
+	// CertificateFile is the path to a PEM-encoded certificate, either a
+	// legacy X.509 one or a compact fscp.CertificateV2 envelope.
+	CertificateFile string
+
+	// PrivateKeyFile is the path to the PEM-encoded private key associated
+	// to CertificateFile.
+	PrivateKeyFile string
+
+	// PresharedKeyPassphrase, PresharedKeySalt and PresharedKeyIterations
+	// feed fscp.ClientSecurity.SetPresharedKeyFromPassphrase. They are only
+	// used when CertificateFile is empty.
+	PresharedKeyPassphrase string
+	PresharedKeySalt       string
+	PresharedKeyIterations int
+
+	// CipherSuites and EllipticCurves list the allowed algorithms by name.
+	// A nil or empty list falls back to the fscp package's defaults.
+	CipherSuites   []string
+	EllipticCurves []string
+}
+
+var cipherSuitesByName = map[string]fscp.CipherSuite{
+	"ecdhe-rsa-aes128-gcm-sha256":            fscp.ECDHERSAAES128GCMSHA256,
+	"ecdhe-rsa-aes256-gcm-sha384":            fscp.ECDHERSAAES256GCMSHA384,
+	"ecdhe-ed25519-chacha20-poly1305-sha256": fscp.ECDHEED25519CHACHA20POLY1305SHA256,
+	"ecdhe-ed25519-aes256-gcm-sha384":        fscp.ECDHEED25519AES256GCMSHA384,
+	"ecdhe-rsa-chacha20-poly1305-sha256":     fscp.ECDHERSACHACHA20POLY1305SHA256,
+}
+
+var ellipticCurvesByName = map[string]fscp.EllipticCurve{
+	"sect571k1":          fscp.SECT571K1,
+	"secp384r1":          fscp.SECP384R1,
+	"secp521r1":          fscp.SECP521R1,
+	"kyber768-secp384r1": fscp.KYBER768_SECP384R1,
+	"newhope-secp521r1":  fscp.NEWHOPE_SECP521R1,
+}
+
+func parseCipherSuites(names []string) (fscp.CipherSuiteSlice, error) {
+	var result fscp.CipherSuiteSlice
+
+	for _, name := range names {
+		cipherSuite, ok := cipherSuitesByName[name]
+
+		if !ok {
+			return nil, fmt.Errorf("unknown cipher suite: %q", name)
+		}
+
+		result = append(result, cipherSuite)
+	}
+
+	return result, nil
+}
+
+func parseEllipticCurves(names []string) (fscp.EllipticCurveSlice, error) {
+	var result fscp.EllipticCurveSlice
+
+	for _, name := range names {
+		ellipticCurve, ok := ellipticCurvesByName[name]
+
+		if !ok {
+			return nil, fmt.Errorf("unknown elliptic curve: %q", name)
+		}
+
+		result = append(result, ellipticCurve)
+	}
+
+	return result, nil
+}
+
+// build resolves the configuration into a *fscp.ClientSecurity, loading the
+// certificate and private key from disk when CertificateFile is set.
+func (s *SecurityConfig) build() (*fscp.ClientSecurity, error) {
+	security := &fscp.ClientSecurity{}
+
+	cipherSuites, err := parseCipherSuites(s.CipherSuites)
+
+	if err != nil {
+		return nil, fmt.Errorf("parsing cipher suites: %s", err)
+	}
+
+	security.CipherSuites = cipherSuites
+
+	ellipticCurves, err := parseEllipticCurves(s.EllipticCurves)
+
+	if err != nil {
+		return nil, fmt.Errorf("parsing elliptic curves: %s", err)
+	}
+
+	security.EllipticCurves = ellipticCurves
+
+	if s.CertificateFile != "" {
+		if err := s.loadCertificate(security); err != nil {
+			return nil, err
+		}
+	} else {
+		iterations := s.PresharedKeyIterations
+
+		if iterations == 0 {
+			iterations = fscp.DefaultPresharedKeyIterations
+		}
+
+		salt := []byte(s.PresharedKeySalt)
+
+		if len(salt) == 0 {
+			salt = fscp.DefaultPresharedKeySalt
+		}
+
+		security.SetPresharedKeyFromPassphrase(s.PresharedKeyPassphrase, salt, iterations)
+	}
+
+	return security, nil
+}
+
+func (s *SecurityConfig) loadCertificate(security *fscp.ClientSecurity) error {
+	raw, err := os.ReadFile(s.CertificateFile)
+
+	if err != nil {
+		return fmt.Errorf("reading certificate file %q: %s", s.CertificateFile, err)
+	}
+
+	cert, certV2, err := fscp.LoadCertificateV2(raw)
+
+	if err != nil {
+		return fmt.Errorf("parsing certificate file %q: %s", s.CertificateFile, err)
+	}
+
+	security.Certificate = cert
+	security.CertificateV2 = certV2
+
+	keyRaw, err := os.ReadFile(s.PrivateKeyFile)
+
+	if err != nil {
+		return fmt.Errorf("reading private key file %q: %s", s.PrivateKeyFile, err)
+	}
+
+	privateKey, err := parsePrivateKey(keyRaw)
+
+	if err != nil {
+		return fmt.Errorf("parsing private key file %q: %s", s.PrivateKeyFile, err)
+	}
+
+	security.PrivateKey = privateKey
+
+	return nil
+}
+
+func parsePrivateKey(raw []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(raw)
+
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode PEM block")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+
+	if err != nil {
+		return nil, fmt.Errorf("unsupported private key format: %s", err)
+	}
+
+	switch key := key.(type) {
+	case crypto.Signer:
+		return key, nil
+	case ed25519.PrivateKey:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported private key type: %T", key)
+	}
+}
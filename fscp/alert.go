@@ -0,0 +1,93 @@
+package fscp
+
+import "fmt"
+
+// AlertLevel indicates the severity of an Alert message, mirroring TLS's
+// alert subprotocol.
+type AlertLevel uint8
+
+const (
+	// AlertLevelWarning indicates a non-fatal alert. AlertCloseNotify is the
+	// only alert sent at this level; a Conn closes itself on receiving an
+	// alert of any level.
+	AlertLevelWarning AlertLevel = 0x01
+	// AlertLevelFatal indicates a fatal alert: the connection is torn down
+	// right after it is sent or received.
+	AlertLevelFatal AlertLevel = 0x02
+)
+
+func (l AlertLevel) String() string {
+	switch l {
+	case AlertLevelWarning:
+		return "warning"
+	case AlertLevelFatal:
+		return "fatal"
+	default:
+		return fmt.Sprintf("AlertLevel(%d)", uint8(l))
+	}
+}
+
+// AlertDescription is the reason code carried by an Alert message, borrowed
+// from the BoringSSL runner's alert.go.
+type AlertDescription uint8
+
+const (
+	// AlertCloseNotify signals a graceful shutdown. It is the only
+	// description ever sent at AlertLevelWarning.
+	AlertCloseNotify AlertDescription = 0x00
+	// AlertBadCertificate signals a certificate that failed validation.
+	AlertBadCertificate AlertDescription = 0x01
+	// AlertUnknownCA signals a certificate issued by an unrecognized CA.
+	AlertUnknownCA AlertDescription = 0x02
+	// AlertHandshakeFailure signals a failure unrelated to security
+	// settings, unable to complete the handshake.
+	AlertHandshakeFailure AlertDescription = 0x03
+	// AlertDecryptError signals a signature or MAC verification failure.
+	AlertDecryptError AlertDescription = 0x04
+	// AlertProtocolVersion signals an unsupported message version.
+	AlertProtocolVersion AlertDescription = 0x05
+	// AlertInsufficientSecurity signals that no common cipher suite or
+	// elliptic curve could be negotiated.
+	AlertInsufficientSecurity AlertDescription = 0x06
+	// AlertInternalError signals an unrelated local error.
+	AlertInternalError AlertDescription = 0x07
+	// AlertAccessDenied signals that the peer is not authorized to connect.
+	AlertAccessDenied AlertDescription = 0x08
+)
+
+func (d AlertDescription) String() string {
+	switch d {
+	case AlertCloseNotify:
+		return "close_notify"
+	case AlertBadCertificate:
+		return "bad_certificate"
+	case AlertUnknownCA:
+		return "unknown_ca"
+	case AlertHandshakeFailure:
+		return "handshake_failure"
+	case AlertDecryptError:
+		return "decrypt_error"
+	case AlertProtocolVersion:
+		return "protocol_version"
+	case AlertInsufficientSecurity:
+		return "insufficient_security"
+	case AlertInternalError:
+		return "internal_error"
+	case AlertAccessDenied:
+		return "access_denied"
+	default:
+		return fmt.Sprintf("AlertDescription(%d)", uint8(d))
+	}
+}
+
+// AlertError is returned from Conn.Read and Client.DialContext when the
+// connection was torn down because of a received or locally-generated Alert
+// message.
+type AlertError struct {
+	Level       AlertLevel
+	Description AlertDescription
+}
+
+func (e *AlertError) Error() string {
+	return fmt.Sprintf("%s alert: %s", e.Level, e.Description)
+}
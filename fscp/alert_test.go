@@ -0,0 +1,112 @@
+package fscp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func FuzzMessageAlertDeserialize(f *testing.F) {
+	f.Add([]byte{0x01, 0x00})
+	f.Add([]byte{0x02, 0x08})
+	f.Add([]byte{0xff, 0xff})
+	f.Add([]byte{0x00})
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		msg := &messageAlert{}
+
+		// deserialize must never panic, regardless of its input.
+		_ = msg.deserialize(bytes.NewReader(data))
+	})
+}
+
+// TestFatalAlertAbortsConnection checks that a fatal alert sent by one end of
+// a connection deterministically aborts it on both ends: the sender sees its
+// own close error, and the peer sees the matching *AlertError.
+func TestFatalAlertAbortsConnection(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	server, err := Listen(Network, ":5010")
+
+	if err != nil {
+		t.Fatalf("expected no error: %s", err)
+	}
+	defer server.Close()
+
+	client, err := Listen(Network, ":5011")
+
+	if err != nil {
+		t.Fatalf("expected no error: %s", err)
+	}
+	defer client.Close()
+
+	go func() {
+		<-ctx.Done()
+
+		server.Close()
+		client.Close()
+	}()
+
+	clientConnCh := make(chan *Conn, 1)
+	clientErrCh := make(chan error, 1)
+
+	go func() {
+		addr, err := ResolveFSCPAddr(Network, "localhost:5010")
+
+		if err != nil {
+			clientErrCh <- err
+			return
+		}
+
+		clientConn, err := client.(*Client).DialContext(ctx, addr)
+
+		if err != nil {
+			clientErrCh <- err
+			return
+		}
+
+		clientConnCh <- clientConn
+	}()
+
+	serverConn, err := server.Accept()
+
+	if err != nil {
+		t.Fatalf("server accepting a connection: %s", err)
+	}
+
+	var clientConn *Conn
+
+	select {
+	case err := <-clientErrCh:
+		t.Fatalf("client connecting: %s", err)
+	case clientConn = <-clientConnCh:
+	}
+	defer clientConn.Close()
+
+	var senderErr *AlertError
+
+	if err := serverConn.(*Conn).closeWithAlert(AlertHandshakeFailure); !errors.As(err, &senderErr) || senderErr.Description != AlertHandshakeFailure {
+		t.Fatalf("expected the sender to see its own *AlertError, got: %v", err)
+	}
+
+	buf := make([]byte, 10)
+	_, err = clientConn.Read(buf)
+
+	var alertErr *AlertError
+
+	if !errors.As(err, &alertErr) {
+		t.Fatalf("expected an *AlertError, got: %v", err)
+	}
+
+	if alertErr.Level != AlertLevelFatal {
+		t.Errorf("expected level %s, got %s", AlertLevelFatal, alertErr.Level)
+	}
+
+	if alertErr.Description != AlertHandshakeFailure {
+		t.Errorf("expected description %s, got %s", AlertHandshakeFailure, alertErr.Description)
+	}
+}
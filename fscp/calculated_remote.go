@@ -0,0 +1,257 @@
+package fscp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+)
+
+// A CalculatedRemote synthesizes a candidate FSCP remote address from a
+// peer's overlay (VPN-layer) IP address, instead of requiring a pre-known
+// transport address for it.
+//
+// It combines the masked (network) bits of Mask with the unmasked (host)
+// bits of the overlay IP address: for instance, an Overlay of 10.42.0.0/16
+// and a Mask of 198.51.100.0/24 turns overlay address 10.42.1.2 into public
+// address 198.51.100.2. This is inspired by Nebula's calculated_remote
+// feature and lets deployments use a deterministic IP mapping instead of a
+// central directory of addresses.
+type CalculatedRemote struct {
+	Overlay netip.Prefix
+	Mask    netip.Prefix
+	Port    int
+}
+
+// resolve synthesizes the concrete address that corresponds to overlayIP, or
+// returns an error if overlayIP does not belong to r.Overlay or the address
+// families of r.Mask and r.Overlay don't match.
+func (r CalculatedRemote) resolve(overlayIP netip.Addr) (*Addr, error) {
+	if r.Mask.Addr().BitLen() != r.Overlay.Addr().BitLen() {
+		return nil, fmt.Errorf("mask %s and overlay %s must share the same address family", r.Mask, r.Overlay)
+	}
+
+	if overlayIP.BitLen() != r.Overlay.Addr().BitLen() {
+		return nil, fmt.Errorf("overlay address %s does not match the address family of %s", overlayIP, r.Overlay)
+	}
+
+	if !r.Overlay.Contains(overlayIP) {
+		return nil, fmt.Errorf("%s is not part of the %s overlay network", overlayIP, r.Overlay)
+	}
+
+	maskBytes := r.Mask.Addr().AsSlice()
+	overlayBytes := overlayIP.AsSlice()
+	resultBytes := make([]byte, len(maskBytes))
+
+	bits := r.Mask.Bits()
+
+	for i := range resultBytes {
+		byteBitOffset := i * 8
+
+		switch {
+		case byteBitOffset+8 <= bits:
+			// Fully within the masked (network) part: keep Mask's byte.
+			resultBytes[i] = maskBytes[i]
+		case byteBitOffset >= bits:
+			// Fully within the unmasked (host) part: use the overlay's byte.
+			resultBytes[i] = overlayBytes[i]
+		default:
+			// Straddles the boundary: keep the high bits from Mask and take
+			// the low bits from the overlay address.
+			keep := uint(bits - byteBitOffset)
+			highBitsMask := byte(0xff << (8 - keep))
+			resultBytes[i] = (maskBytes[i] & highBitsMask) | (overlayBytes[i] &^ highBitsMask)
+		}
+	}
+
+	addr, ok := netip.AddrFromSlice(resultBytes)
+
+	if !ok {
+		return nil, fmt.Errorf("failed to build a calculated remote address from %s and %s", r.Mask, overlayIP)
+	}
+
+	return &Addr{
+		TransportAddr: &net.UDPAddr{
+			IP:   addr.AsSlice(),
+			Port: r.Port,
+		},
+	}, nil
+}
+
+// DialOverlay dials a peer identified only by its overlay (VPN-layer) IP
+// address, using d.CalculatedRemotes to synthesize candidate transport
+// addresses and racing connection attempts against all of them,
+// happy-eyeballs-style, until one of them completes its handshake.
+func (d *Dialer) DialOverlay(ctx context.Context, overlayIP net.IP) (*Conn, error) {
+	addr, ok := netip.AddrFromSlice(overlayIP)
+
+	if !ok {
+		return nil, fmt.Errorf("invalid overlay IP address: %s", overlayIP)
+	}
+
+	addr = addr.Unmap()
+
+	var candidates []*Addr
+
+	for _, remote := range d.CalculatedRemotes {
+		candidate, err := remote.resolve(addr)
+
+		if err != nil {
+			continue
+		}
+
+		candidates = append(candidates, candidate)
+	}
+
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no calculated remote produced a candidate address for overlay IP %s", overlayIP)
+	}
+
+	return d.raceDialFSCP(ctx, candidates)
+}
+
+// DialOverlay connects to a peer identified only by its overlay (VPN-layer)
+// IP address, using c.CalculatedRemotes to synthesize candidate transport
+// addresses and racing connection attempts against all of them,
+// happy-eyeballs-style, until one of them completes its handshake.
+func (c *Client) DialOverlay(ctx context.Context, overlayIP net.IP) (*Conn, error) {
+	addr, ok := netip.AddrFromSlice(overlayIP)
+
+	if !ok {
+		return nil, fmt.Errorf("invalid overlay IP address: %s", overlayIP)
+	}
+
+	addr = addr.Unmap()
+
+	var candidates []*Addr
+
+	for _, remote := range c.CalculatedRemotes {
+		candidate, err := remote.resolve(addr)
+
+		if err != nil {
+			continue
+		}
+
+		candidates = append(candidates, candidate)
+	}
+
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no calculated remote produced a candidate address for overlay IP %s", overlayIP)
+	}
+
+	return c.raceConnect(ctx, candidates)
+}
+
+// raceConnect connects to every candidate concurrently and returns the first
+// connection that completes its handshake, closing the others.
+func (c *Client) raceConnect(ctx context.Context, candidates []*Addr) (*Conn, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		conn *Conn
+		err  error
+	}
+
+	results := make(chan result, len(candidates))
+
+	for _, candidate := range candidates {
+		go func(raddr *Addr) {
+			conn, err := c.DialContext(ctx, raddr)
+			results <- result{conn, err}
+		}(candidate)
+	}
+
+	// closeRest closes every connection among the remaining results, other
+	// than winner.
+	closeRest := func(winner *Conn, remaining int) {
+		go func() {
+			for ; remaining > 0; remaining-- {
+				if r := <-results; r.err == nil && r.conn != winner {
+					r.conn.Close()
+				}
+			}
+		}()
+	}
+
+	var lastErr error
+
+	for i := range candidates {
+		select {
+		case r := <-results:
+			if r.err == nil {
+				cancel()
+				closeRest(r.conn, len(candidates)-i-1)
+				return r.conn, nil
+			}
+
+			lastErr = r.err
+		case <-ctx.Done():
+			closeRest(nil, len(candidates)-i)
+			return nil, ctx.Err()
+		}
+	}
+
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no candidate address could be reached")
+	}
+
+	return nil, lastErr
+}
+
+// raceDialFSCP dials every candidate concurrently and returns the first
+// connection that completes its handshake, closing the others.
+func (d *Dialer) raceDialFSCP(ctx context.Context, candidates []*Addr) (*Conn, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		conn *Conn
+		err  error
+	}
+
+	results := make(chan result, len(candidates))
+
+	for _, candidate := range candidates {
+		go func(raddr *Addr) {
+			conn, err := d.DialFSCP(Network, nil, raddr)
+			results <- result{conn, err}
+		}(candidate)
+	}
+
+	// closeRest closes every connection among the remaining results, other
+	// than winner.
+	closeRest := func(winner *Conn, remaining int) {
+		go func() {
+			for ; remaining > 0; remaining-- {
+				if r := <-results; r.err == nil && r.conn != winner {
+					r.conn.Close()
+				}
+			}
+		}()
+	}
+
+	var lastErr error
+
+	for i := range candidates {
+		select {
+		case r := <-results:
+			if r.err == nil {
+				cancel()
+				closeRest(r.conn, len(candidates)-i-1)
+				return r.conn, nil
+			}
+
+			lastErr = r.err
+		case <-ctx.Done():
+			closeRest(nil, len(candidates)-i)
+			return nil, ctx.Err()
+		}
+	}
+
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no candidate address could be reached")
+	}
+
+	return nil, lastErr
+}
@@ -0,0 +1,208 @@
+package fscp
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/cryptobyte"
+)
+
+// CertificateV2Curve identifies the key type carried by a CertificateV2.
+type CertificateV2Curve uint8
+
+const (
+	// NullCertificateV2Curve represents an invalid curve identifier.
+	NullCertificateV2Curve CertificateV2Curve = 0x00
+	// CertificateV2Ed25519 identifies an Ed25519 identity key.
+	CertificateV2Ed25519 CertificateV2Curve = 0x01
+)
+
+// pemTypeCertificateV2 is the PEM block type used for the compact, non-X.509
+// certificate envelope.
+const pemTypeCertificateV2 = "FREELAN CERTIFICATE V2"
+
+// CertificateV2 is a compact, non-X.509 certificate envelope inspired by
+// Nebula's v2 certificate format: a length-prefixed TLV encoding of a subject
+// name, a validity period, a curve identifier, a public key and a detached
+// signature over everything that precedes it.
+type CertificateV2 struct {
+	Subject   string
+	NotBefore time.Time
+	NotAfter  time.Time
+	Curve     CertificateV2Curve
+	PublicKey []byte
+	Signature []byte
+}
+
+// NewCertificateV2 creates and signs a CertificateV2 for the given Ed25519
+// key pair.
+func NewCertificateV2(subject string, notBefore, notAfter time.Time, pub ed25519.PublicKey, priv ed25519.PrivateKey) (*CertificateV2, error) {
+	cert := &CertificateV2{
+		Subject:   subject,
+		NotBefore: notBefore,
+		NotAfter:  notAfter,
+		Curve:     CertificateV2Ed25519,
+		PublicKey: []byte(pub),
+	}
+
+	unsigned, err := cert.marshalUnsigned()
+
+	if err != nil {
+		return nil, fmt.Errorf("marshaling unsigned certificate: %s", err)
+	}
+
+	cert.Signature = ed25519.Sign(priv, unsigned)
+
+	return cert, nil
+}
+
+func (c *CertificateV2) marshalUnsigned() ([]byte, error) {
+	var b cryptobyte.Builder
+
+	b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes([]byte(c.Subject))
+	})
+	b.AddUint64(uint64(c.NotBefore.Unix()))
+	b.AddUint64(uint64(c.NotAfter.Unix()))
+	b.AddUint8(uint8(c.Curve))
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes(c.PublicKey)
+	})
+
+	return b.Bytes()
+}
+
+// Marshal encodes the certificate, including its signature, to its compact
+// wire representation.
+func (c *CertificateV2) Marshal() ([]byte, error) {
+	unsigned, err := c.marshalUnsigned()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var b cryptobyte.Builder
+	b.AddBytes(unsigned)
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes(c.Signature)
+	})
+
+	return b.Bytes()
+}
+
+// ParseCertificateV2 decodes a CertificateV2 from its compact wire
+// representation.
+func ParseCertificateV2(data []byte) (*CertificateV2, error) {
+	s := cryptobyte.String(data)
+
+	cert := &CertificateV2{}
+
+	var subject cryptobyte.String
+	var notBefore, notAfter uint64
+	var curve uint8
+	var publicKey, signature cryptobyte.String
+
+	if !s.ReadUint8LengthPrefixed(&subject) ||
+		!s.ReadUint64(&notBefore) ||
+		!s.ReadUint64(&notAfter) ||
+		!s.ReadUint8(&curve) ||
+		!s.ReadUint16LengthPrefixed(&publicKey) ||
+		!s.ReadUint16LengthPrefixed(&signature) ||
+		!s.Empty() {
+		return nil, errors.New("malformed v2 certificate")
+	}
+
+	cert.Subject = string(subject)
+	cert.NotBefore = time.Unix(int64(notBefore), 0).UTC()
+	cert.NotAfter = time.Unix(int64(notAfter), 0).UTC()
+	cert.Curve = CertificateV2Curve(curve)
+	cert.PublicKey = []byte(publicKey)
+	cert.Signature = []byte(signature)
+
+	return cert, nil
+}
+
+// Verify checks that the certificate is self-consistent: its signature
+// matches its own public key and it is currently within its validity period.
+//
+// It does not perform any kind of chain-of-trust validation, as CertificateV2
+// is meant to be used for self-signed, pinned identities.
+func (c *CertificateV2) Verify(at time.Time) error {
+	if at.Before(c.NotBefore) || at.After(c.NotAfter) {
+		return fmt.Errorf("certificate is not valid at %s (valid from %s to %s)", at, c.NotBefore, c.NotAfter)
+	}
+
+	switch c.Curve {
+	case CertificateV2Ed25519:
+		unsigned, err := c.marshalUnsigned()
+
+		if err != nil {
+			return fmt.Errorf("marshaling unsigned certificate: %s", err)
+		}
+
+		if !ed25519.Verify(ed25519.PublicKey(c.PublicKey), unsigned, c.Signature) {
+			return errors.New("signature does not match")
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("unsupported curve identifier: %d", c.Curve)
+	}
+}
+
+// LoadCertificateV2 loads a certificate from a PEM-encoded blob, accepting
+// both a legacy X.509 certificate and the new compact CertificateV2 envelope.
+//
+// Exactly one of the two return values is non-nil on success.
+func LoadCertificateV2(data []byte) (*x509.Certificate, *CertificateV2, error) {
+	block, _ := pem.Decode(data)
+
+	if block == nil {
+		return nil, nil, errors.New("failed to decode PEM block")
+	}
+
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("parsing X509 certificate: %s", err)
+		}
+
+		return cert, nil, nil
+	case pemTypeCertificateV2:
+		cert, err := ParseCertificateV2(block.Bytes)
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("parsing v2 certificate: %s", err)
+		}
+
+		return nil, cert, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported PEM block type: %s", block.Type)
+	}
+}
+
+// MarshalPEM encodes the certificate as a PEM block using the compact
+// envelope's dedicated type.
+func (c *CertificateV2) MarshalPEM() ([]byte, error) {
+	raw, err := c.Marshal()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: pemTypeCertificateV2, Bytes: raw}), nil
+}
+
+// generateV2KeyPair is a small helper used by tests and by
+// GenerateLocalEd25519Certificate-style call sites that want a v2 envelope
+// instead of an X.509 one.
+func generateV2KeyPair() (ed25519.PublicKey, ed25519.PrivateKey, error) {
+	return ed25519.GenerateKey(rand.Reader)
+}
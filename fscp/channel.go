@@ -0,0 +1,135 @@
+package fscp
+
+import (
+	"fmt"
+	"io"
+)
+
+const (
+	// DefaultChannel is the wire channel Conn.Read and Conn.Write operate
+	// on: Channel(DefaultChannel) returns the Conn itself.
+	DefaultChannel uint8 = 0
+
+	// ICMPChannel is the conventional channel ICMP echo traffic is proxied
+	// through, so liveness can be verified end-to-end without a real TAP
+	// interface.
+	ICMPChannel uint8 = 1
+)
+
+// channelQueueSize is the depth of a connChannel's incoming queue.
+const channelQueueSize = 100
+
+// outgoingFrame pairs cleartext with the wire channel it should be sent on.
+type outgoingFrame struct {
+	channel uint8
+	data    []byte
+}
+
+// Channel returns an io.ReadWriteCloser multiplexed over the connection's
+// single encrypted session, so that several logical streams (user data,
+// ICMP, ...) can flow over one handshake, the way cloudflared's
+// packet.Router muxes user datagrams and ICMP traffic over a single QUIC
+// session. Channel(DefaultChannel) returns c itself, so using Conn as a
+// plain net.Conn keeps working unchanged; any other id gets its own
+// independent stream of cleartext messages, lazily created on first use.
+func (c *Conn) Channel(id uint8) io.ReadWriteCloser {
+	if id == DefaultChannel {
+		return c
+	}
+
+	c.chMu.Lock()
+	defer c.chMu.Unlock()
+
+	if ch, ok := c.channels[id]; ok {
+		return ch
+	}
+
+	ch := &connChannel{
+		conn:     c,
+		id:       id,
+		incoming: make(chan []byte, channelQueueSize),
+	}
+
+	c.channels[id] = ch
+
+	return ch
+}
+
+// routeChannelData delivers data arriving for the given wire channel to its
+// registered reader, dropping it the same way a full DefaultChannel queue
+// already does if nothing is there to receive it.
+func (c *Conn) routeChannelData(id uint8, data []byte) {
+	if id == DefaultChannel {
+		select {
+		case c.incomingData <- data:
+		default:
+			c.warning(fmt.Errorf("dropping %d byte(s) of incoming data on channel %d because reads are not happening fast enough", len(data), id))
+		}
+
+		return
+	}
+
+	c.chMu.Lock()
+	ch, ok := c.channels[id]
+	c.chMu.Unlock()
+
+	if !ok {
+		c.warning(fmt.Errorf("dropping %d byte(s) of incoming data on channel %d because no reader is registered for it", len(data), id))
+		return
+	}
+
+	select {
+	case ch.incoming <- data:
+	default:
+		c.warning(fmt.Errorf("dropping %d byte(s) of incoming data on channel %d because reads are not happening fast enough", len(data), id))
+	}
+}
+
+// connChannel is one multiplexed logical stream over a Conn's single
+// encrypted session. Obtained via Conn.Channel.
+type connChannel struct {
+	conn     *Conn
+	id       uint8
+	incoming chan []byte
+}
+
+// Read returns the cleartext payload of the next message received on this
+// channel. It blocks until data arrives or the underlying Conn closes.
+func (ch *connChannel) Read(b []byte) (int, error) {
+	select {
+	case <-ch.conn.closed:
+		return 0, ch.conn.closeError
+	case buf := <-ch.incoming:
+		return copy(b, buf), nil
+	}
+}
+
+// Write encrypts p and sends it to the peer on this channel. It blocks
+// until the Conn's session handshake has completed.
+func (ch *connChannel) Write(p []byte) (int, error) {
+	b := make([]byte, len(p))
+	copy(b, p)
+
+	select {
+	case <-ch.conn.connected:
+	case <-ch.conn.closed:
+		return 0, io.ErrClosedPipe
+	}
+
+	select {
+	case ch.conn.outgoing <- outgoingFrame{channel: ch.id, data: b}:
+		return len(b), nil
+	case <-ch.conn.closed:
+		return 0, io.ErrClosedPipe
+	}
+}
+
+// Close unregisters the channel; data subsequently received for it is
+// dropped. It does not close the underlying Conn.
+func (ch *connChannel) Close() error {
+	ch.conn.chMu.Lock()
+	delete(ch.conn.channels, ch.id)
+	ch.conn.chMu.Unlock()
+
+	return nil
+}
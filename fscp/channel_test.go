@@ -0,0 +1,113 @@
+package fscp
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestConnChannelMultiplexing(t *testing.T) {
+	network := NewInMemoryNetwork()
+
+	serverTransport, err := network.Listen("channel-server")
+
+	if err != nil {
+		t.Fatalf("expected no error: %s", err)
+	}
+
+	defer serverTransport.Close()
+
+	clientTransport, err := network.Listen("channel-client")
+
+	if err != nil {
+		t.Fatalf("expected no error: %s", err)
+	}
+
+	server, err := NewClient(serverTransport, nil, nil)
+
+	if err != nil {
+		t.Fatalf("expected no error: %s", err)
+	}
+
+	defer server.Close()
+
+	client, err := NewClient(clientTransport, nil, nil)
+
+	if err != nil {
+		t.Fatalf("expected no error: %s", err)
+	}
+
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	addr := serverTransport.LocalAddr()
+
+	serverConnCh := make(chan net.Conn, 1)
+
+	go func() {
+		conn, err := server.Accept()
+
+		if err == nil {
+			serverConnCh <- conn
+		}
+	}()
+
+	clientConn, err := client.DialContext(ctx, addr)
+
+	if err != nil {
+		t.Fatalf("client connecting to %s: %s", addr, err)
+	}
+
+	defer clientConn.Close()
+
+	var serverConn *Conn
+
+	select {
+	case conn := <-serverConnCh:
+		serverConn = conn.(*Conn)
+	case <-time.After(time.Second):
+		t.Fatal("expected the server to accept a connection")
+	}
+
+	defer serverConn.Close()
+
+	const testChannel = 5
+
+	// A reader must be registered before data arrives, or it is dropped the
+	// same way DefaultChannel data is when nothing is reading.
+	serverChannel := serverConn.Channel(testChannel)
+	clientChannel := clientConn.Channel(testChannel)
+
+	if _, err := clientChannel.Write([]byte("ping")); err != nil {
+		t.Fatalf("writing to channel %d: %s", testChannel, err)
+	}
+
+	buf := make([]byte, 16)
+	n, err := serverChannel.Read(buf)
+
+	if err != nil {
+		t.Fatalf("reading from channel %d: %s", testChannel, err)
+	}
+
+	if got := string(buf[:n]); got != "ping" {
+		t.Errorf("expected `ping`, got `%s`", got)
+	}
+
+	// DefaultChannel keeps working unchanged, on the same connection.
+	if _, err := clientConn.Write([]byte("hello")); err != nil {
+		t.Fatalf("writing on the default channel: %s", err)
+	}
+
+	n, err = serverConn.Read(buf)
+
+	if err != nil {
+		t.Fatalf("reading on the default channel: %s", err)
+	}
+
+	if got := string(buf[:n]); got != "hello" {
+		t.Errorf("expected `hello`, got `%s`", got)
+	}
+}
@@ -0,0 +1,101 @@
+package fscp
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	_ "crypto/sha512" // registers crypto.SHA384, used by the suites below
+	"fmt"
+	"sync"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// CipherSuiteImpl provides the cryptographic primitives a CipherSuite
+// constant is bound to in the cipher suite registry: the AEAD
+// construction newAEAD uses, the sizes Session relies on to allocate its
+// key/nonce/tag buffers, and the hash function deriveSessionKeys builds
+// its key schedule on.
+type CipherSuiteImpl interface {
+	// NewAEAD constructs the AEAD keyed by key, which is KeyLen() bytes long.
+	NewAEAD(key []byte) (cipher.AEAD, error)
+	// KeyLen returns the length, in bytes, of the key NewAEAD expects.
+	KeyLen() int
+	// NonceLen returns the length, in bytes, of the nonce the AEAD returned by NewAEAD expects.
+	NonceLen() int
+	// TagLen returns the length, in bytes, of the authentication tag the AEAD returned by NewAEAD appends to a sealed message.
+	TagLen() int
+	// Hash returns the hash function this suite's key schedule is built on.
+	Hash() crypto.Hash
+}
+
+// aesGCMCipherSuite implements CipherSuiteImpl for an AES-GCM suite of a
+// given key size.
+type aesGCMCipherSuite struct {
+	keyLen int
+	hash   crypto.Hash
+}
+
+func (s aesGCMCipherSuite) NewAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+
+	if err != nil {
+		return nil, fmt.Errorf("instanciating block cipher: %s", err)
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func (s aesGCMCipherSuite) KeyLen() int       { return s.keyLen }
+func (s aesGCMCipherSuite) NonceLen() int     { return 12 }
+func (s aesGCMCipherSuite) TagLen() int       { return 16 }
+func (s aesGCMCipherSuite) Hash() crypto.Hash { return s.hash }
+
+// chacha20Poly1305CipherSuite implements CipherSuiteImpl for a
+// ChaCha20-Poly1305 suite.
+type chacha20Poly1305CipherSuite struct {
+	hash crypto.Hash
+}
+
+func (s chacha20Poly1305CipherSuite) NewAEAD(key []byte) (cipher.AEAD, error) {
+	return chacha20poly1305.New(key)
+}
+
+func (s chacha20Poly1305CipherSuite) KeyLen() int       { return chacha20poly1305.KeySize }
+func (s chacha20Poly1305CipherSuite) NonceLen() int     { return chacha20poly1305.NonceSize }
+func (s chacha20Poly1305CipherSuite) TagLen() int       { return 16 }
+func (s chacha20Poly1305CipherSuite) Hash() crypto.Hash { return s.hash }
+
+// cipherSuiteRegistryMu guards cipherSuiteRegistry.
+var cipherSuiteRegistryMu sync.RWMutex
+
+// cipherSuiteRegistry maps every CipherSuite constant to its
+// CipherSuiteImpl. RegisterCipherSuite adds to (or overrides) it.
+var cipherSuiteRegistry = map[CipherSuite]CipherSuiteImpl{
+	ECDHERSAAES128GCMSHA256:            aesGCMCipherSuite{keyLen: 16, hash: crypto.SHA256},
+	ECDHERSAAES256GCMSHA384:            aesGCMCipherSuite{keyLen: 32, hash: crypto.SHA384},
+	ECDHEED25519CHACHA20POLY1305SHA256: chacha20Poly1305CipherSuite{hash: crypto.SHA256},
+	ECDHEED25519AES256GCMSHA384:        aesGCMCipherSuite{keyLen: 32, hash: crypto.SHA384},
+	ECDHERSACHACHA20POLY1305SHA256:     chacha20Poly1305CipherSuite{hash: crypto.SHA256},
+}
+
+// RegisterCipherSuite binds id to impl in the global cipher suite
+// registry, so a Session negotiating id uses impl's AEAD construction
+// and key schedule. It is meant to be called during program
+// initialization, before any Session negotiates id, and is safe to call
+// concurrently with an already-running Client.
+func RegisterCipherSuite(id CipherSuite, impl CipherSuiteImpl) {
+	cipherSuiteRegistryMu.Lock()
+	defer cipherSuiteRegistryMu.Unlock()
+
+	cipherSuiteRegistry[id] = impl
+}
+
+// cipherSuiteImpl returns the CipherSuiteImpl registered for s, or nil if
+// none is registered.
+func cipherSuiteImpl(s CipherSuite) CipherSuiteImpl {
+	cipherSuiteRegistryMu.RLock()
+	defer cipherSuiteRegistryMu.RUnlock()
+
+	return cipherSuiteRegistry[s]
+}
@@ -0,0 +1,71 @@
+package fscp
+
+import (
+	"crypto"
+	"testing"
+)
+
+func TestRegisteredCipherSuitesImplementExpectedSizes(t *testing.T) {
+	cases := []struct {
+		suite    CipherSuite
+		keyLen   int
+		nonceLen int
+		tagLen   int
+		hash     crypto.Hash
+	}{
+		{ECDHERSAAES128GCMSHA256, 16, 12, 16, crypto.SHA256},
+		{ECDHERSAAES256GCMSHA384, 32, 12, 16, crypto.SHA384},
+		{ECDHEED25519CHACHA20POLY1305SHA256, 32, 12, 16, crypto.SHA256},
+		{ECDHEED25519AES256GCMSHA384, 32, 12, 16, crypto.SHA384},
+		{ECDHERSACHACHA20POLY1305SHA256, 32, 12, 16, crypto.SHA256},
+	}
+
+	for _, c := range cases {
+		impl := cipherSuiteImpl(c.suite)
+
+		if impl == nil {
+			t.Errorf("%d: expected a registered CipherSuiteImpl but got none", c.suite)
+			continue
+		}
+
+		if got := impl.KeyLen(); got != c.keyLen {
+			t.Errorf("%d: KeyLen() = %d, want %d", c.suite, got, c.keyLen)
+		}
+
+		if got := impl.NonceLen(); got != c.nonceLen {
+			t.Errorf("%d: NonceLen() = %d, want %d", c.suite, got, c.nonceLen)
+		}
+
+		if got := impl.TagLen(); got != c.tagLen {
+			t.Errorf("%d: TagLen() = %d, want %d", c.suite, got, c.tagLen)
+		}
+
+		if got := impl.Hash(); got != c.hash {
+			t.Errorf("%d: Hash() = %v, want %v", c.suite, got, c.hash)
+		}
+
+		if _, err := impl.NewAEAD(make([]byte, c.keyLen)); err != nil {
+			t.Errorf("%d: NewAEAD() failed: %s", c.suite, err)
+		}
+	}
+}
+
+func TestRegisterCipherSuiteOverridesRegistry(t *testing.T) {
+	const testSuite CipherSuite = 0xff
+
+	if cipherSuiteImpl(testSuite) != nil {
+		t.Fatalf("expected no CipherSuiteImpl registered for %d yet", testSuite)
+	}
+
+	RegisterCipherSuite(testSuite, aesGCMCipherSuite{keyLen: 16, hash: crypto.SHA256})
+
+	impl := cipherSuiteImpl(testSuite)
+
+	if impl == nil {
+		t.Fatal("expected a CipherSuiteImpl to be registered")
+	}
+
+	if got := impl.KeyLen(); got != 16 {
+		t.Errorf("KeyLen() = %d, want 16", got)
+	}
+}
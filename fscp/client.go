@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"net"
 	"sync"
@@ -11,18 +12,30 @@ import (
 
 // Client represents a FSCP connection.
 type Client struct {
-	transportConn  net.PacketConn
+	transport      Transport
 	hostIdentifier HostIdentifier
 	security       ClientSecurity
+	options        ClientOptions
 	backlog        chan *Conn
 	closed         bool
 
+	// CalculatedRemotes, if set, lets DialOverlay synthesize candidate
+	// transport addresses for a peer from its overlay IP address instead of
+	// requiring a pre-known transport address for it.
+	CalculatedRemotes []CalculatedRemote
+
 	lock        sync.Mutex
 	connsByAddr map[string]*Conn
+
+	stats   clientStats
+	limiter *peerLimiter
+	workers []chan rawFrame
 }
 
-// NewClient creates a new client.
-func NewClient(conn net.PacketConn, security *ClientSecurity) (client *Client, err error) {
+// NewClient creates a new client on top of transport. options tunes its
+// queue sizes, decode worker count and per-peer rate limits; a nil options
+// selects the package defaults.
+func NewClient(transport Transport, security *ClientSecurity, options *ClientOptions) (client *Client, err error) {
 	if security == nil {
 		security = &ClientSecurity{}
 	}
@@ -31,12 +44,21 @@ func NewClient(conn net.PacketConn, security *ClientSecurity) (client *Client, e
 		return nil, fmt.Errorf("failed to instanciate a new client: %s", err)
 	}
 
+	opts := options.withDefaults()
+
 	client = &Client{
-		transportConn: conn,
-		security:      *security,
-		backlog:       make(chan *Conn, 20),
-		closed:        false,
-		connsByAddr:   map[string]*Conn{},
+		transport:   transport,
+		security:    *security,
+		options:     opts,
+		backlog:     make(chan *Conn, 20),
+		closed:      false,
+		connsByAddr: map[string]*Conn{},
+		limiter:     newPeerLimiter(opts.RateLimitBurst, opts.RateLimitPerSecond),
+		workers:     make([]chan rawFrame, opts.Workers),
+	}
+
+	for i := range client.workers {
+		client.workers[i] = make(chan rawFrame, opts.QueueSize)
 	}
 
 	if client.hostIdentifier, err = GenerateHostIdentifier(); err != nil {
@@ -48,6 +70,25 @@ func NewClient(conn net.PacketConn, security *ClientSecurity) (client *Client, e
 	return client, nil
 }
 
+// Stats returns a snapshot of the client's dispatch-loop metrics.
+func (c *Client) Stats() Stats {
+	framesReceived, framesDropped := c.stats.snapshot()
+
+	c.lock.Lock()
+	depths := make(map[string]int, len(c.connsByAddr))
+
+	for addr, conn := range c.connsByAddr {
+		depths[addr] = len(conn.incoming)
+	}
+	c.lock.Unlock()
+
+	return Stats{
+		FramesReceived:    framesReceived,
+		FramesDropped:     framesDropped,
+		PerPeerQueueDepth: depths,
+	}
+}
+
 // Security gets the client's security.
 func (c *Client) Security() ClientSecurity {
 	c.lock.Lock()
@@ -67,30 +108,61 @@ func (c *Client) SetSecurity(security ClientSecurity) {
 	c.closeConns()
 }
 
+// SetLogger sets the Logger used by connections the client creates from
+// now on, replacing the one set through ClientOptions. Existing
+// connections keep the logger they were created with; call Conn.SetLogger
+// on them individually if they also need to switch. A nil logger falls
+// back to the package default (silenced unless FREELAN_FSCP_DEBUG=1 is
+// set).
+func (c *Client) SetLogger(logger Logger) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if logger == nil {
+		logger = envLogger{}
+	}
+
+	c.options.Logger = logger
+}
+
 // Addr returns the listener address.
 func (c *Client) Addr() net.Addr {
-	return &Addr{TransportAddr: c.transportConn.LocalAddr()}
+	return c.transport.LocalAddr()
 }
 
 // Accept a new connection.
 func (c *Client) Accept() (net.Conn, error) {
-	if conn, ok := <-c.backlog; ok {
+	return c.AcceptContext(context.Background())
+}
+
+// AcceptContext accepts a new connection, or gives up once ctx is done,
+// the same way net.Dialer.DialContext gives up a dial.
+func (c *Client) AcceptContext(ctx context.Context) (net.Conn, error) {
+	select {
+	case conn, ok := <-c.backlog:
+		if !ok {
+			return nil, io.EOF
+		}
+
 		return conn, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
-
-	return nil, io.EOF
 }
 
 // Close the listener.
 func (c *Client) Close() error {
-	return c.transportConn.Close()
+	return c.transport.Close()
 }
 
-// Connect connects to the specified host.
-func (c *Client) Connect(ctx context.Context, remoteAddr *Addr) (conn *Conn, err error) {
+// DialContext connects to the specified host, or gives up once ctx is
+// done. Cancelling ctx before the handshake completes also stops the
+// underlying hello-request retries, tearing the connection down, the same
+// way net.Dialer.DialContext does.
+func (c *Client) DialContext(ctx context.Context, remoteAddr *Addr) (conn *Conn, err error) {
 	var ok bool
 
-	conn, ok = c.addConn(remoteAddr)
+	conn, ok = c.addConn(ctx, remoteAddr)
 
 	if conn == nil {
 		return nil, io.EOF
@@ -102,7 +174,7 @@ func (c *Client) Connect(ctx context.Context, remoteAddr *Addr) (conn *Conn, err
 
 		select {
 		case <-conn.closed:
-			return nil, io.EOF
+			return nil, conn.closeError
 		case <-conn.connected:
 		case <-ctx.Done():
 			return nil, ctx.Err()
@@ -112,22 +184,71 @@ func (c *Client) Connect(ctx context.Context, remoteAddr *Addr) (conn *Conn, err
 	return
 }
 
+// rawFrame is an undecoded frame handed off from dispatchLoop to a
+// decodeWorker.
+type rawFrame struct {
+	data []byte
+	addr *Addr
+}
+
+// dispatchLoop reads frames off the transport and fans them out to a fixed
+// pool of decode workers, one goroutine per worker. A frame is always
+// routed to the same worker as every other frame from the same peer (see
+// workerFor), so per-connection message ordering is preserved even though
+// different peers' frames are decoded concurrently.
 func (c *Client) dispatchLoop() {
 	defer c.finalize()
 	defer close(c.backlog)
 
-	b := make([]byte, 1500)
+	for _, worker := range c.workers {
+		go c.decodeWorker(worker)
+	}
+	defer func() {
+		for _, worker := range c.workers {
+			close(worker)
+		}
+	}()
 
 	for {
-		n, addr, err := c.transportConn.ReadFrom(b)
+		data, remoteAddr, err := c.transport.ReadFrame(context.Background())
 
 		if err != nil {
 			return
 		}
 
-		data := b[:n]
-		remoteAddr := &Addr{TransportAddr: addr}
-		conn, ok := c.addConn(remoteAddr)
+		c.stats.receivedFrame()
+
+		if !c.limiter.Allow(remoteAddr.String()) {
+			c.stats.droppedFrame()
+			c.releaseBuffer(data)
+			continue
+		}
+
+		worker := c.workers[workerFor(remoteAddr, len(c.workers))]
+
+		select {
+		case worker <- rawFrame{data: data, addr: remoteAddr}:
+		default:
+			// The worker's queue is full: discard the frame rather than
+			// stall the reader and, with it, every other peer.
+			c.stats.droppedFrame()
+			c.releaseBuffer(data)
+		}
+	}
+}
+
+// releaseBuffer returns b to the transport's buffer pool, if it has one.
+func (c *Client) releaseBuffer(b []byte) {
+	if releaser, ok := c.transport.(bufferReleaser); ok {
+		releaser.releaseBuffer(b)
+	}
+}
+
+// decodeWorker decodes frames from ch, one at a time, delivering each to its
+// connection's incoming queue.
+func (c *Client) decodeWorker(ch chan rawFrame) {
+	for rf := range ch {
+		conn, ok := c.addConn(context.Background(), rf.addr)
 
 		// A nil conn indicates that the client is closing, which means we will
 		// soon exit from the incoming loop anyway.
@@ -136,57 +257,79 @@ func (c *Client) dispatchLoop() {
 		}
 
 		if ok {
-			go func(conn *Conn) {
-				select {
-				case <-conn.connected:
-				case <-conn.closed:
-					// If we get there, it means the connection was closed
-					// before it completed its handshake.
-					return
-				}
-
-				select {
-				case <-conn.closed:
-					// If we get there, it means the connection was closed
-					// right after it completed its handshake. This is rare,
-					// but if it happens we might as well not add the
-					// connection to the backlog.
-				case c.backlog <- conn:
-					// We added the connection to the backlog and can happily
-					// move on.
-				default:
-					// If the backlog is full, we shut down the connection.
-					conn.Close()
-				}
-			}(conn)
+			go c.promoteToBacklog(conn)
 		}
 
-		var reader lenReader = bytes.NewReader(data)
+		reader := bytes.NewReader(rf.data)
 
-		if messageType, message, err := readMessage(reader); err == nil {
+		messageType, message, err := conn.codec.ReadMessage(reader, conn.tracer())
+
+		// readMessage always fully parses the payload into message's own
+		// fields, so rf.data can go back to the transport's pool as soon
+		// as it returns, regardless of outcome.
+		c.releaseBuffer(rf.data)
+
+		if err == nil {
 			select {
 			case conn.incoming <- messageFrame{messageType, message}:
 			default:
-				// If the connection's incoming queue is full, we simply discard
-				// the frame.
+				// If the connection's incoming queue is full, we simply
+				// discard the frame.
+				c.stats.droppedFrame()
 			}
 		} else {
-			debugPrintf("failed to read message: %s\n", err)
+			conn.log().Warn("message_decode_failed", "remote_addr", rf.addr, "error", err)
 		}
 	}
 }
 
+// promoteToBacklog waits for conn to complete its handshake and then adds it
+// to the client's Accept backlog.
+func (c *Client) promoteToBacklog(conn *Conn) {
+	select {
+	case <-conn.connected:
+	case <-conn.closed:
+		// If we get there, it means the connection was closed before it
+		// completed its handshake.
+		return
+	}
+
+	select {
+	case <-conn.closed:
+		// If we get there, it means the connection was closed right after
+		// it completed its handshake. This is rare, but if it happens we
+		// might as well not add the connection to the backlog.
+	case c.backlog <- conn:
+		// We added the connection to the backlog and can happily move on.
+	default:
+		// If the backlog is full, we shut down the connection.
+		conn.Close()
+	}
+}
+
+// workerFor deterministically maps addr to one of n worker indices, so that
+// every frame from a given peer always lands on the same worker.
+func workerFor(addr *Addr, n int) int {
+	h := fnv.New32a()
+	h.Write([]byte(addr.String()))
+
+	return int(h.Sum32() % uint32(n))
+}
+
 func (c *Client) finalize() {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 
 	// After that point (and the lock is released), addConn() can't add new
-	// connections which means Connect() can't either.
+	// connections which means DialContext() can't either.
 	c.closed = true
 	c.closeConns()
 }
 
-func (c *Client) addConn(remoteAddr *Addr) (conn *Conn, ok bool) {
+// addConn returns the existing Conn for remoteAddr, or creates one bound to
+// ctx. ctx only governs the handshake retries of a newly created Conn (ok
+// == true); an existing Conn keeps running on whatever context created it.
+func (c *Client) addConn(ctx context.Context, remoteAddr *Addr) (conn *Conn, ok bool) {
 	key := remoteAddr.String()
 
 	c.lock.Lock()
@@ -200,8 +343,8 @@ func (c *Client) addConn(remoteAddr *Addr) (conn *Conn, ok bool) {
 		}
 
 		// This is a new peer so we start a new connection.
-		writer := &clientWriter{c, remoteAddr.TransportAddr}
-		conn = newConn(&Addr{TransportAddr: c.Addr()}, remoteAddr, writer, c.hostIdentifier, c.security)
+		writer := &clientWriter{c, remoteAddr}
+		conn = newConn(ctx, &Addr{TransportAddr: c.Addr()}, remoteAddr, writer, c.hostIdentifier, c.security, c.options)
 
 		c.connsByAddr[key] = conn
 
@@ -223,6 +366,8 @@ func (c *Client) removeConn(conn *Conn) {
 	c.lock.Lock()
 	delete(c.connsByAddr, key)
 	c.lock.Unlock()
+
+	c.limiter.forget(key)
 }
 
 // closeConns closes all the connections.
@@ -240,9 +385,13 @@ func (c *Client) closeConns() {
 
 type clientWriter struct {
 	client     *Client
-	remoteAddr net.Addr
+	remoteAddr *Addr
 }
 
 func (w *clientWriter) Write(b []byte) (n int, err error) {
-	return w.client.transportConn.WriteTo(b, w.remoteAddr)
+	if err = w.client.transport.WriteFrame(b, w.remoteAddr); err != nil {
+		return 0, err
+	}
+
+	return len(b), nil
 }
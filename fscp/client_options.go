@@ -0,0 +1,113 @@
+package fscp
+
+import "time"
+
+// Defaults applied by ClientOptions when the corresponding field is left at
+// its zero value.
+const (
+	// DefaultQueueSize is the default size of each connection's incoming
+	// message queue.
+	DefaultQueueSize = 10
+	// DefaultWorkers is the default number of goroutines decoding incoming
+	// frames in parallel.
+	DefaultWorkers = 4
+	// DefaultRateLimitBurst is the default per-peer token bucket burst
+	// size.
+	DefaultRateLimitBurst = 64
+	// DefaultRateLimitPerSecond is the default per-peer token bucket
+	// refill rate, in frames per second.
+	DefaultRateLimitPerSecond = 200
+	// DefaultKeepAliveInterval is the default period between keep-alive
+	// messages sent on an otherwise idle connection.
+	DefaultKeepAliveInterval = 30 * time.Second
+	// DefaultKeepAliveTimeout is the default duration of silence from a
+	// peer after which it is presumed dead and the connection is closed.
+	DefaultKeepAliveTimeout = 90 * time.Second
+)
+
+// ClientOptions tunes the resource usage of a Client: how deep its queues
+// are, how many goroutines decode incoming frames, and how aggressively it
+// rate-limits a single peer to mitigate a handshake-flood DoS from unknown
+// sources.
+type ClientOptions struct {
+	// QueueSize is the size of each connection's incoming message queue.
+	// Zero selects DefaultQueueSize.
+	QueueSize int
+
+	// Workers is the number of goroutines decoding incoming frames in
+	// parallel. Frames from a given peer always land on the same worker,
+	// so per-connection message ordering is preserved even though
+	// different peers' frames are decoded concurrently. Zero selects
+	// DefaultWorkers.
+	Workers int
+
+	// RateLimitBurst is the per-peer token bucket's burst size: the number
+	// of frames a single peer may send instantly before being throttled.
+	// Zero selects DefaultRateLimitBurst.
+	RateLimitBurst int
+
+	// RateLimitPerSecond is the per-peer token bucket's refill rate, in
+	// frames per second. Zero selects DefaultRateLimitPerSecond.
+	RateLimitPerSecond float64
+
+	// KeepAliveInterval is the period between keep-alive messages sent on
+	// an otherwise idle connection. Zero selects DefaultKeepAliveInterval.
+	KeepAliveInterval time.Duration
+
+	// KeepAliveTimeout is the duration of silence from a peer after which
+	// it is presumed dead and the connection is closed. Zero selects
+	// DefaultKeepAliveTimeout.
+	KeepAliveTimeout time.Duration
+
+	// MaxMessageSize caps the payload size a Conn will accept from a
+	// single message header, guarding against a peer inflating its
+	// length prefix to force a large allocation. Zero, or a value above
+	// DefaultMaxMessageSize, selects DefaultMaxMessageSize.
+	MaxMessageSize int
+
+	// Logger receives structured log events from every Conn created by the
+	// Client. A nil Logger selects a default that reproduces the
+	// historical FREELAN_FSCP_DEBUG=1 stderr dump, for backward
+	// compatibility with programs that never adopted the Logger interface.
+	Logger Logger
+}
+
+// withDefaults returns a copy of o (or the defaults, if o is nil) with every
+// zero-valued field replaced by its default.
+func (o *ClientOptions) withDefaults() ClientOptions {
+	var out ClientOptions
+
+	if o != nil {
+		out = *o
+	}
+
+	if out.QueueSize <= 0 {
+		out.QueueSize = DefaultQueueSize
+	}
+
+	if out.Workers <= 0 {
+		out.Workers = DefaultWorkers
+	}
+
+	if out.RateLimitBurst <= 0 {
+		out.RateLimitBurst = DefaultRateLimitBurst
+	}
+
+	if out.RateLimitPerSecond <= 0 {
+		out.RateLimitPerSecond = DefaultRateLimitPerSecond
+	}
+
+	if out.KeepAliveInterval <= 0 {
+		out.KeepAliveInterval = DefaultKeepAliveInterval
+	}
+
+	if out.KeepAliveTimeout <= 0 {
+		out.KeepAliveTimeout = DefaultKeepAliveTimeout
+	}
+
+	if out.Logger == nil {
+		out.Logger = envLogger{}
+	}
+
+	return out
+}
@@ -2,19 +2,31 @@ package fscp
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"math/rand"
 	"net"
+	"os"
 	"sync"
 	"time"
 )
 
+// ErrKeepAliveTimeout is the error a Conn closes itself with once no frame
+// at all has been received from the peer for longer than its
+// KeepAliveTimeout, meaning it is presumed dead.
+var ErrKeepAliveTimeout = errors.New("fscp: no data received from peer in too long, presuming it dead")
+
 type messageFrame struct {
 	messageType MessageType
 	message     interface{}
 }
 
+// rekeyGraceSessions bounds how many sessions superseded by a rekey
+// Conn.previousSessions retains.
+const rekeyGraceSessions = 2
+
 // Conn is a FSCP connection.
 type Conn struct {
 	writer               io.Writer
@@ -26,6 +38,24 @@ type Conn struct {
 	session              *Session
 	nextSession          *Session
 
+	// codec is copied from the owning Client's options at creation time,
+	// and reads and writes every message Conn exchanges with its peer.
+	codec MessageCodec
+
+	// previousSessions retains the last few sessions superseded by a
+	// rekey, most recently superseded last, so that a message the peer
+	// encrypted under an old key just before the swap still decrypts
+	// during the brief window before it notices. Like session and
+	// nextSession, it is owned exclusively by dispatchLoop.
+	previousSessions []*Session
+
+	// ctx bounds the handshake retries driven by dispatchLoop: once it is
+	// done, the loop stops retrying and tears down the connection, the same
+	// way a net.Dialer.DialContext call gives up on its context. It is
+	// context.Background() for connections accepted rather than dialed,
+	// since there is no caller context to bind their lifetime to.
+	ctx context.Context
+
 	incoming   chan messageFrame
 	connected  chan struct{}
 	closed     chan struct{}
@@ -33,23 +63,73 @@ type Conn struct {
 	once       sync.Once
 
 	incomingData chan []byte
-	outgoingData chan []byte
+	outgoing     chan outgoingFrame
+
+	// channels holds every non-default Channel created so far. It is
+	// guarded by chMu since Channel may be called from any goroutine,
+	// unlike session/nextSession which only dispatchLoop ever touches.
+	channels map[uint8]*connChannel
+	chMu     sync.Mutex
+
+	contactHints chan ContactInfo
+
+	// keepAliveInterval and keepAliveTimeout are copied from the owning
+	// Client's options at creation time.
+	keepAliveInterval time.Duration
+	keepAliveTimeout  time.Duration
+
+	// lastActivity is the time the last frame of any kind was received
+	// from the peer. Like session and nextSession, it is owned exclusively
+	// by dispatchLoop.
+	lastActivity time.Time
+
+	deadlineMu    sync.Mutex
+	readDeadline  time.Time
+	writeDeadline time.Time
+
+	// loggerMu guards logger, which SetLogger may replace from any
+	// goroutine while dispatchLoop concurrently reads it.
+	loggerMu sync.RWMutex
+	logger   Logger
+
+	// stats holds the decrypt-path counters returned by Stats. Its
+	// counters are updated with atomic operations, so, unlike session and
+	// nextSession, it may be read from any goroutine.
+	stats connStats
 }
 
-func newConn(localAddr *Addr, remoteAddr *Addr, w io.Writer, hostIdentifier HostIdentifier, security ClientSecurity) *Conn {
+// Stats returns a snapshot of the connection's decrypt-path metrics.
+func (c *Conn) Stats() ConnStats {
+	return c.stats.snapshot()
+}
+
+func newConn(ctx context.Context, localAddr *Addr, remoteAddr *Addr, w io.Writer, hostIdentifier HostIdentifier, security ClientSecurity, options ClientOptions) *Conn {
+	options = options.withDefaults()
+
 	conn := &Conn{
 		writer:              w,
 		localAddr:           localAddr,
 		remoteAddr:          remoteAddr,
 		localHostIdentifier: hostIdentifier,
 		security:            security,
+		ctx:                 ctx,
 
-		incoming:  make(chan messageFrame, 10),
+		codec: MessageCodec{MaxMessageSize: options.MaxMessageSize},
+
+		incoming:  make(chan messageFrame, options.QueueSize),
 		connected: make(chan struct{}),
 		closed:    make(chan struct{}),
 
 		incomingData: make(chan []byte, 100),
-		outgoingData: make(chan []byte, 100),
+		outgoing:     make(chan outgoingFrame, 100),
+
+		channels:     map[uint8]*connChannel{},
+		contactHints: make(chan ContactInfo, 4),
+
+		keepAliveInterval: options.KeepAliveInterval,
+		keepAliveTimeout:  options.KeepAliveTimeout,
+
+		logger: options.Logger,
 	}
 
 	go conn.dispatchLoop()
@@ -58,15 +138,23 @@ func newConn(localAddr *Addr, remoteAddr *Addr, w io.Writer, hostIdentifier Host
 }
 
 func (c *Conn) Read(b []byte) (n int, err error) {
+	timeout, stop := deadlineTimer(c.getReadDeadline())
+	defer stop()
+
 	select {
 	case <-c.closed:
-		return 0, io.EOF
+		return 0, c.closeError
 	case buf := <-c.incomingData:
 		return copy(b, buf), nil
+	case <-timeout:
+		return 0, c.timeoutError("read")
 	}
 }
 
 func (c *Conn) Write(p []byte) (n int, err error) {
+	timeout, stop := deadlineTimer(c.getWriteDeadline())
+	defer stop()
+
 	select {
 	case <-c.connected:
 		// Implementations must not retain p.
@@ -77,28 +165,59 @@ func (c *Conn) Write(p []byte) (n int, err error) {
 		case <-c.closed:
 			return 0, io.ErrClosedPipe
 
-		case c.outgoingData <- b:
+		case c.outgoing <- outgoingFrame{channel: DefaultChannel, data: b}:
 			return len(b), nil
+
+		case <-timeout:
+			return 0, c.timeoutError("write")
 		}
 
 	case <-c.closed:
 		return 0, io.ErrClosedPipe
+
+	case <-timeout:
+		return 0, c.timeoutError("write")
 	}
 }
 
 // Close closes the connection.
+//
+// A CloseNotify warning alert is sent to the peer beforehand, on a
+// best-effort basis.
 func (c *Conn) Close() error {
+	if err := c.sendAlert(AlertLevelWarning, AlertCloseNotify); err != nil {
+		c.warning(fmt.Errorf("failed to send close_notify alert: %s", err))
+	}
+
 	return c.closeWithError(io.EOF)
 }
 
-func (c *Conn) debugPrintf(msg string, args ...interface{}) {
-	debugPrintf("(%s <- %s) %s", c.LocalAddr(), c.RemoteAddr(), fmt.Sprintf(msg, args...))
+// SetLogger sets the Logger used by the connection for structured log
+// events, replacing the one inherited from the owning Client's options. A
+// nil logger falls back to the package default (silenced unless
+// FREELAN_FSCP_DEBUG=1 is set).
+func (c *Conn) SetLogger(logger Logger) {
+	c.loggerMu.Lock()
+	defer c.loggerMu.Unlock()
+
+	if logger == nil {
+		logger = envLogger{}
+	}
+
+	c.logger = logger
+}
+
+func (c *Conn) log() Logger {
+	c.loggerMu.RLock()
+	defer c.loggerMu.RUnlock()
+
+	return loggerOrDiscard(c.logger)
 }
 
 // closeWithError closes the connection with the specified error.
 func (c *Conn) closeWithError(err error) error {
 	c.once.Do(func() {
-		c.debugPrintf("closing connection: %s\n", err)
+		c.log().Info("connection_closed", "local_addr", c.LocalAddr(), "remote_addr", c.RemoteAddr(), "reason", err)
 
 		c.closeError = err
 		close(c.closed)
@@ -108,7 +227,7 @@ func (c *Conn) closeWithError(err error) error {
 }
 
 func (c *Conn) warning(err error) {
-	c.debugPrintf("Warning: %s\n", err.Error())
+	c.log().Warn("warning", "local_addr", c.LocalAddr(), "remote_addr", c.RemoteAddr(), "error", err)
 }
 
 // LocalAddr returns the local address of the connection.
@@ -117,24 +236,91 @@ func (c *Conn) LocalAddr() net.Addr { return c.localAddr }
 // RemoteAddr returns the remote address of the connection.
 func (c *Conn) RemoteAddr() net.Addr { return c.remoteAddr }
 
-// SetDeadline sets the deadline on the connection.
+// SetDeadline sets the read and write deadlines on the connection, as per
+// the net.Conn contract. A zero value disables the deadline.
 func (c *Conn) SetDeadline(t time.Time) error {
-	// TODO: Implement.
+	c.deadlineMu.Lock()
+	defer c.deadlineMu.Unlock()
+
+	c.readDeadline = t
+	c.writeDeadline = t
+
 	return nil
 }
 
-// SetReadDeadline sets the deadline on the connection.
+// SetReadDeadline sets the deadline for future Read calls. A zero value
+// disables the deadline.
 func (c *Conn) SetReadDeadline(t time.Time) error {
-	// TODO: Implement.
+	c.deadlineMu.Lock()
+	defer c.deadlineMu.Unlock()
+
+	c.readDeadline = t
+
 	return nil
 }
 
-// SetWriteDeadline sets the deadline on the connection.
+// SetWriteDeadline sets the deadline for future Write calls. A zero value
+// disables the deadline.
 func (c *Conn) SetWriteDeadline(t time.Time) error {
-	// TODO: Implement.
+	c.deadlineMu.Lock()
+	defer c.deadlineMu.Unlock()
+
+	c.writeDeadline = t
+
 	return nil
 }
 
+func (c *Conn) getReadDeadline() time.Time {
+	c.deadlineMu.Lock()
+	defer c.deadlineMu.Unlock()
+
+	return c.readDeadline
+}
+
+func (c *Conn) getWriteDeadline() time.Time {
+	c.deadlineMu.Lock()
+	defer c.deadlineMu.Unlock()
+
+	return c.writeDeadline
+}
+
+// timeoutError builds the *net.OpError returned by Read/Write once their
+// deadline has elapsed. os.ErrDeadlineExceeded already satisfies net.Error
+// with Timeout() == true, so wrapping it is enough to honor the net.Conn
+// deadline contract.
+func (c *Conn) timeoutError(op string) error {
+	return &net.OpError{Op: op, Net: Network, Source: c.localAddr, Addr: c.remoteAddr, Err: os.ErrDeadlineExceeded}
+}
+
+// deadlineTimer returns a channel that receives once deadline elapses, and
+// a stop function that must be called (typically via defer) to release the
+// underlying timer. A zero deadline disables the timeout: the returned
+// channel never fires.
+func deadlineTimer(deadline time.Time) (<-chan time.Time, func() bool) {
+	if deadline.IsZero() {
+		return nil, func() bool { return true }
+	}
+
+	d := time.Until(deadline)
+
+	if d <= 0 {
+		expired := make(chan time.Time, 1)
+		expired <- time.Now()
+
+		return expired, func() bool { return true }
+	}
+
+	timer := time.NewTimer(d)
+
+	return timer.C, timer.Stop
+}
+
+// tracer returns c.security.Tracer, or a Tracer that discards every call if
+// it is nil, so callers can invoke hooks unconditionally.
+func (c *Conn) tracer() Tracer {
+	return traceOrDiscard(c.security.Tracer)
+}
+
 func (c *Conn) writeMessage(messageType MessageType, message serializable) (err error) {
 	// FIXME: If we know for sure that no two writeMessage() calls ever happen
 	// concurrently, we can reuse the same buffer over and over (don't forget
@@ -142,7 +328,7 @@ func (c *Conn) writeMessage(messageType MessageType, message serializable) (err
 
 	buf := &bytes.Buffer{}
 
-	if err = writeMessage(buf, messageType, message); err != nil {
+	if err = c.codec.WriteMessage(buf, messageType, message, c.security.Tracer); err != nil {
 		return err
 	}
 
@@ -160,7 +346,7 @@ func (c *Conn) sendHelloRequest(uniqueNumber UniqueNumber) (err error) {
 		UniqueNumber: uniqueNumber,
 	}
 
-	c.debugPrintf("Sending %s.\n", msg)
+	c.log().Debug("message_sent", "type", MessageTypeHelloRequest, "message", msg)
 
 	if err = c.writeMessage(MessageTypeHelloRequest, msg); err != nil {
 		return err
@@ -174,7 +360,7 @@ func (c *Conn) sendHelloResponse(uniqueNumber UniqueNumber) error {
 		UniqueNumber: uniqueNumber,
 	}
 
-	c.debugPrintf("Sending %s.\n", msg)
+	c.log().Debug("message_sent", "type", MessageTypeHelloResponse, "message", msg)
 
 	return c.writeMessage(MessageTypeHelloResponse, msg)
 }
@@ -184,7 +370,11 @@ func (c *Conn) sendPresentation() error {
 		Certificate: c.security.Certificate,
 	}
 
-	c.debugPrintf("Sending %s.\n", msg)
+	if msg.Certificate == nil {
+		msg.CertificateV2 = c.security.CertificateV2
+	}
+
+	c.log().Debug("message_sent", "type", MessageTypePresentation, "message", msg)
 
 	return c.writeMessage(MessageTypePresentation, msg)
 }
@@ -201,7 +391,7 @@ func (c *Conn) sendSessionRequest(sessionNumber SessionNumber) error {
 		return fmt.Errorf("failed to forge session request message: %s", err)
 	}
 
-	c.debugPrintf("Sending %s request.\n", msg)
+	c.log().Debug("message_sent", "type", MessageTypeSessionRequest, "message", msg)
 
 	return c.writeMessage(MessageTypeSessionRequest, msg)
 }
@@ -219,23 +409,153 @@ func (c *Conn) sendSession(session *Session) error {
 		return fmt.Errorf("failed to forge session message: %s", err)
 	}
 
-	c.debugPrintf("Sending %s.\n", msg)
+	c.log().Debug("message_sent", "type", MessageTypeSession, "message", msg)
 
 	return c.writeMessage(MessageTypeSession, msg)
 }
 
+func (c *Conn) sendAlert(level AlertLevel, description AlertDescription) error {
+	msg := &messageAlert{
+		Level:       level,
+		Description: description,
+	}
+
+	c.log().Debug("message_sent", "type", MessageTypeAlert, "message", msg)
+
+	return c.writeMessage(MessageTypeAlert, msg)
+}
+
+// closeWithAlert sends a fatal alert to the peer before tearing down the
+// connection with the matching *AlertError.
+func (c *Conn) closeWithAlert(description AlertDescription) error {
+	if err := c.sendAlert(AlertLevelFatal, description); err != nil {
+		c.warning(fmt.Errorf("failed to send %s alert: %s", description, err))
+	}
+
+	return c.closeWithError(&AlertError{Level: AlertLevelFatal, Description: description})
+}
+
 func (c *Conn) sendData(channel uint8, cleartext []byte) error {
-	msg := c.session.Encrypt(cleartext)
+	msg, err := c.session.Encrypt(cleartext)
+
+	if err != nil {
+		return fmt.Errorf("encrypting data: %s", err)
+	}
+
+	c.maybeRekey()
 
-	// Channel handling is a real pain and doesn't fit well with the
-	// Reader/Writer pattern... Let's hardcode channel 1 for now.
 	msg.Channel = channel
 
-	c.debugPrintf("Sending %s.\n", msg)
+	c.log().Debug("message_sent", "type", MessageTypeData, "channel", channel, "message", msg)
 
 	return c.writeMessage(MessageTypeData, msg)
 }
 
+// sendKeepAlive encrypts an empty payload and sends it as a KEEP_ALIVE
+// message, so the peer's lastActivity advances without carrying any actual
+// channel data.
+func (c *Conn) sendKeepAlive() error {
+	msg, err := c.session.Encrypt(nil)
+
+	if err != nil {
+		return fmt.Errorf("encrypting keep-alive: %s", err)
+	}
+
+	c.log().Debug("message_sent", "type", MessageTypeKeepAlive)
+
+	return c.writeMessage(MessageTypeKeepAlive, msg)
+}
+
+// configureSession applies the per-ClientSecurity settings a freshly
+// created Session doesn't know about itself, ahead of c.sendSession or
+// installing it as c.session/c.nextSession.
+func (c *Conn) configureSession(session *Session) {
+	session.Tracer = c.security.Tracer
+
+	if c.security.ReplayWindowSize > 0 {
+		session.WindowSize = c.security.ReplayWindowSize
+	}
+}
+
+// needsRekey reports whether the active session has crossed its own hard
+// sequence-number-based threshold (see Session.NeedsRekey) or any
+// threshold configured via c.security.RekeyPolicy.
+func (c *Conn) needsRekey() bool {
+	if c.session.NeedsRekey() {
+		return true
+	}
+
+	policy := c.security.RekeyPolicy
+
+	if policy == nil {
+		return false
+	}
+
+	if policy.MaxBytes > 0 && c.session.LocalBytesSent >= policy.MaxBytes {
+		return true
+	}
+
+	if policy.MaxMessages > 0 && c.session.LocalSequenceNumber >= policy.MaxMessages {
+		return true
+	}
+
+	if policy.MaxAge > 0 && time.Since(c.session.EstablishedAt) >= policy.MaxAge {
+		return true
+	}
+
+	return false
+}
+
+// maybeRekey proactively negotiates a replacement session once the active
+// session crosses a rekey threshold, by sending a SESSION_REQUEST for
+// SessionNumber+1, the same message the initial handshake uses. The swap
+// into c.session only completes once the peer replies with its own
+// SESSION message, handled like any other in dispatchLoop. It is a no-op
+// while a rekey is already in flight (c.nextSession != nil).
+func (c *Conn) maybeRekey() {
+	if c.nextSession != nil || !c.needsRekey() {
+		return
+	}
+
+	nextSessionNumber := c.session.SessionNumber + 1
+
+	if err := c.sendSessionRequest(nextSessionNumber); err != nil {
+		c.warning(fmt.Errorf("failed to initiate rekey: %s", err))
+		return
+	}
+
+	c.log().Info("rekey_initiated", "session_number", c.session.SessionNumber, "next_session_number", nextSessionNumber)
+}
+
+// rememberPreviousSession appends session to the grace-period ring kept
+// for decrypting messages sent just before a rekey, evicting the oldest
+// entry once it grows past rekeyGraceSessions.
+func (c *Conn) rememberPreviousSession(session *Session) {
+	if session == nil {
+		return
+	}
+
+	c.previousSessions = append(c.previousSessions, session)
+
+	if len(c.previousSessions) > rekeyGraceSessions {
+		c.previousSessions = c.previousSessions[1:]
+	}
+}
+
+// decryptWithGracePeriod retries a message that failed to authenticate
+// against the active session against each session in the grace-period
+// ring, most recently superseded first, and returns fallbackErr unchanged
+// if none of them can decrypt it either.
+func (c *Conn) decryptWithGracePeriod(imsg *messageData, fallbackErr error) ([]byte, error) {
+	for i := len(c.previousSessions) - 1; i >= 0; i-- {
+		if data, err := c.previousSessions[i].Decrypt(imsg); err == nil {
+			return data, nil
+		}
+	}
+
+	return nil, fallbackErr
+}
+
 func (c *Conn) dispatchLoop() {
 	uniqueNumber := UniqueNumber(rand.Uint32())
 
@@ -247,19 +567,44 @@ func (c *Conn) dispatchLoop() {
 			c.closeWithError(err)
 		},
 		Period: time.Second * 3,
+		// A HELLO request failing to send means the transport itself is
+		// broken, not that the peer hasn't answered yet (the retrier
+		// keeps resending on its own for that); retrying it would just
+		// spin against the same dead transport, so give up right away.
+		ShouldRetry: func(err error) bool { return false },
 	}
 
 	helloRequestRetrier.Start()
 	defer helloRequestRetrier.Stop()
 
+	c.lastActivity = time.Now()
+
+	// keepAliveTicker stays nil until the session is established (see the
+	// two close(c.connected) sites below): there is nothing to keep alive
+	// before that, and the handshake retrier already covers liveness.
+	var keepAliveTicker *time.Ticker
+	var keepAliveC <-chan time.Time
+
+	// ctxDone is set to nil once the session is established: c.ctx only
+	// bounds the handshake, not the lifetime of an established connection.
+	ctxDone := c.ctx.Done()
+
+	defer func() {
+		if keepAliveTicker != nil {
+			keepAliveTicker.Stop()
+		}
+	}()
+
 	for {
 		select {
 		case frame := <-c.incoming:
+			c.lastActivity = time.Now()
+
 			switch imsg := frame.message.(type) {
 			case *messageHello:
 				switch frame.messageType {
 				case MessageTypeHelloRequest:
-					c.debugPrintf("Received %s request.\n", imsg)
+					c.log().Debug("message_received", "type", MessageTypeHelloRequest, "message", imsg)
 
 					if err := c.sendHelloResponse(imsg.UniqueNumber); err != nil {
 						c.closeWithError(err)
@@ -267,7 +612,7 @@ func (c *Conn) dispatchLoop() {
 					}
 
 				case MessageTypeHelloResponse:
-					c.debugPrintf("Received %s response.\n", imsg)
+					c.log().Debug("message_received", "type", MessageTypeHelloResponse, "message", imsg)
 
 					if imsg.UniqueNumber != uniqueNumber {
 						// The received response does not match the outstanding
@@ -289,7 +634,7 @@ func (c *Conn) dispatchLoop() {
 			case *messagePresentation:
 				switch frame.messageType {
 				case MessageTypePresentation:
-					c.debugPrintf("Received %s.\n", imsg)
+					c.log().Debug("message_received", "type", MessageTypePresentation, "message", imsg)
 
 					//TODO: Check if the certificate is acceptable.
 
@@ -300,14 +645,17 @@ func (c *Conn) dispatchLoop() {
 							// If we receive a presentation message, store its
 							// certificate only if we don't have one already.
 							remoteClientSecurity.Certificate = imsg.Certificate
-							c.debugPrintf("Stored certificate (%s) for remote host.\n", imsg.Certificate.Subject)
+							c.log().Debug("remote_certificate_stored", "subject", imsg.Certificate.Subject)
+						} else if imsg.CertificateV2 != nil {
+							remoteClientSecurity.CertificateV2 = imsg.CertificateV2
+							c.log().Debug("remote_certificate_stored", "subject", imsg.CertificateV2.Subject)
 						} else {
-							c.debugPrintf("Using pre-shared key for remote host.\n")
+							c.log().Debug("remote_presharedkey_used")
 						}
 
 						c.security.RemoteClientSecurity = remoteClientSecurity
 					} else {
-						c.debugPrintf("Ignoring repeated presentation for remote host.\n")
+						c.log().Debug("presentation_ignored", "reason", "repeated")
 
 						continue
 					}
@@ -326,18 +674,19 @@ func (c *Conn) dispatchLoop() {
 				}
 
 			case *messageSessionRequest:
-				c.debugPrintf("Received %s.\n", imsg)
+				c.log().Debug("message_received", "type", MessageTypeSessionRequest, "message", imsg)
 
 				if err := imsg.verifySignature(c.security); err != nil {
 					c.warning(fmt.Errorf("session request signature verification failed: %s", err))
-					continue
+					c.closeWithAlert(AlertDecryptError)
+					return
 				}
 
 				//TODO: Filter out some hosts based on a callback or other client logic.
 
 				if c.remoteHostIdentifier == nil {
 					c.remoteHostIdentifier = &imsg.HostIdentifier
-					c.debugPrintf("Setting remote host identifier: %s\n", imsg.HostIdentifier)
+					c.log().Debug("remote_host_identifier_set", "host_identifier", imsg.HostIdentifier)
 				} else if imsg.HostIdentifier != *c.remoteHostIdentifier {
 					c.warning(fmt.Errorf("ignoring session request because host identifier does not match: expected %s but got %s", *c.remoteHostIdentifier, imsg.HostIdentifier))
 					continue
@@ -346,7 +695,7 @@ func (c *Conn) dispatchLoop() {
 				// If we already have a current session that is more recent
 				// than the requested one, we resend it.
 				if c.session != nil && c.session.SessionNumber >= imsg.SessionNumber {
-					c.debugPrintf("Session request is for an oudated session (%d): resending current session (%d).\n", imsg.SessionNumber, c.session.SessionNumber)
+					c.log().Debug("session_request_outdated", "requested_session_number", imsg.SessionNumber, "current_session_number", c.session.SessionNumber)
 
 					// The session request is oudated: we resend the current session.
 					if err := c.sendSession(c.session); err != nil {
@@ -374,18 +723,13 @@ func (c *Conn) dispatchLoop() {
 
 				if err != nil {
 					c.warning(fmt.Errorf("failed to initialize new session: %s", err))
-
-					if err := c.sendSession(session); err != nil {
-						c.closeWithError(err)
-						return
-					}
-
-					continue
+					c.closeWithAlert(AlertInsufficientSecurity)
+					return
 				}
 
-				c.debugPrintf("Session number: %d.\n", session.SessionNumber)
-				c.debugPrintf("Selected cipher suite: %s.\n", session.CipherSuite)
-				c.debugPrintf("Selected elliptic curve: %s.\n", session.EllipticCurve)
+				c.configureSession(session)
+
+				c.log().Debug("session_negotiated", "session_number", session.SessionNumber, "cipher_suite", session.CipherSuite, "elliptic_curve", session.EllipticCurve)
 
 				c.nextSession = session
 
@@ -395,11 +739,12 @@ func (c *Conn) dispatchLoop() {
 				}
 
 			case *messageSession:
-				c.debugPrintf("Received %s.\n", imsg)
+				c.log().Debug("message_received", "type", MessageTypeSession, "message", imsg)
 
 				if err := imsg.verifySignature(c.security); err != nil {
 					c.warning(fmt.Errorf("session request signature verification failed: %s", err))
-					continue
+					c.closeWithAlert(AlertDecryptError)
+					return
 				}
 
 				//TODO: Filter out some hosts based on a callback or other client logic.
@@ -409,7 +754,7 @@ func (c *Conn) dispatchLoop() {
 						// The requested session matches the current one: we
 						// send nothing to avoid a ping-pong of identical
 						// session messages.
-						c.debugPrintf("Ignoring repeated session message (%d).\n", imsg.SessionNumber)
+						c.log().Debug("session_message_ignored", "session_number", imsg.SessionNumber)
 
 						continue
 					} else if c.session.SessionNumber > imsg.SessionNumber {
@@ -434,14 +779,23 @@ func (c *Conn) dispatchLoop() {
 
 						if c.session == nil {
 							close(c.connected)
+							keepAliveTicker = time.NewTicker(c.keepAliveInterval)
+							keepAliveC = keepAliveTicker.C
+							ctxDone = nil
 						}
 
+						oldSession := c.session
 						c.session, c.nextSession = c.nextSession, nil
-						c.debugPrintf("Session %d established.\n", c.session.SessionNumber)
+						c.log().Info("session_established", "session_number", c.session.SessionNumber, "cipher_suite", c.session.CipherSuite, "elliptic_curve", c.session.EllipticCurve)
+
+						if oldSession != nil {
+							c.tracer().OnRekey(oldSession, c.session)
+							c.rememberPreviousSession(oldSession)
+						}
 
 						continue
 					} else if c.nextSession.SessionNumber > imsg.SessionNumber {
-						c.debugPrintf("Session is outdated (%d < %d): ignoring.\n", imsg.SessionNumber, c.nextSession.SessionNumber)
+						c.log().Debug("session_outdated", "received_session_number", imsg.SessionNumber, "current_session_number", c.nextSession.SessionNumber)
 
 						continue
 					}
@@ -456,42 +810,62 @@ func (c *Conn) dispatchLoop() {
 
 				if err != nil {
 					c.warning(fmt.Errorf("failed to initialize new session: %s", err))
-
-					if err := c.sendSession(session); err != nil {
-						c.closeWithError(err)
-						return
-					}
-
-					continue
+					c.closeWithAlert(AlertInsufficientSecurity)
+					return
 				}
 
+				c.configureSession(session)
+
 				if err := c.sendSession(session); err != nil {
 					c.closeWithError(err)
 					return
 				}
 
-				c.debugPrintf("Session number: %d.\n", session.SessionNumber)
-				c.debugPrintf("Selected cipher suite: %s.\n", session.CipherSuite)
-				c.debugPrintf("Selected elliptic curve: %s.\n", session.EllipticCurve)
+				c.log().Debug("session_negotiated", "session_number", session.SessionNumber, "cipher_suite", session.CipherSuite, "elliptic_curve", session.EllipticCurve)
 
+				oldSession := c.session
 				c.session, c.nextSession = session, nil
-				c.debugPrintf("Session %d established.\n", c.session.SessionNumber)
+				c.log().Info("session_established", "session_number", c.session.SessionNumber, "cipher_suite", c.session.CipherSuite, "elliptic_curve", c.session.EllipticCurve)
 
 				if c.session == nil {
 					close(c.connected)
+					keepAliveTicker = time.NewTicker(c.keepAliveInterval)
+					keepAliveC = keepAliveTicker.C
+					ctxDone = nil
+				}
+
+				if oldSession != nil {
+					c.tracer().OnRekey(oldSession, c.session)
+					c.rememberPreviousSession(oldSession)
 				}
 
+			case *messageAlert:
+				c.log().Debug("message_received", "type", MessageTypeAlert, "message", imsg)
+
+				c.closeWithError(&AlertError{Level: imsg.Level, Description: imsg.Description})
+				return
+
 			case *messageData:
-				c.debugPrintf("Received %s.\n", frame.message)
+				c.log().Debug("message_received", "type", frame.messageType, "message", frame.message)
 
 				if c.session == nil {
-					c.debugPrintf("Received data without an active session: ignoring.\n")
+					c.log().Debug("data_without_session")
 					continue
 				}
 
 				data, err := c.session.Decrypt(imsg)
 
 				if err != nil {
+					data, err = c.decryptWithGracePeriod(imsg, err)
+				}
+
+				if err != nil {
+					if errors.Is(err, ErrOutdatedMessage) || errors.Is(err, ErrReplayedMessage) {
+						c.stats.droppedReplay()
+					} else {
+						c.stats.droppedDecryptFailure()
+					}
+
 					c.warning(fmt.Errorf("failed to decode DATA message (%d): %s", imsg.SequenceNumber, err))
 
 					continue
@@ -499,40 +873,61 @@ func (c *Conn) dispatchLoop() {
 
 				switch frame.messageType {
 				case MessageTypeKeepAlive:
-					// TODO: Handle keep alives.
+					// The frame already refreshed lastActivity above; a
+					// keep-alive carries nothing beyond that.
+				case MessageTypeContactRequest:
+					if err := c.sendContact(); err != nil {
+						c.closeWithError(err)
+						return
+					}
 				case MessageTypeContact:
-					// TODO: Handle contacts.
-				case MessageTypeData:
 					select {
-					case c.incomingData <- data:
+					case c.contactHints <- ContactInfo{Addr: string(data)}:
 					default:
-						c.warning(fmt.Errorf("dropping %d byte(s) of incoming data because reads are not happening fast enough", len(data)))
-
-						continue
+						c.warning(fmt.Errorf("dropping a contact hint because nothing is reading ContactHints"))
 					}
+				default:
+					// Every other type in this branch is channel data (see
+					// readMessage): imsg.Channel says which one.
+					c.routeChannelData(imsg.Channel, data)
 				}
 
 			default:
-				c.debugPrintf("Received %s.\n", frame.message)
+				c.log().Debug("message_received", "type", frame.messageType, "message", frame.message)
 			}
 
-		case data := <-c.outgoingData:
+		case frame := <-c.outgoing:
 			// This is not supposed to happen, as the addition to the
-			// outgoingData channel is gated by the closure of the connected
+			// outgoing channel is gated by the closure of the connected
 			// channel.
 			if c.session == nil {
-				c.warning(fmt.Errorf("dropping %d byte(s) of outgoing data because no session is currently active", len(data)))
+				c.warning(fmt.Errorf("dropping %d byte(s) of outgoing data because no session is currently active", len(frame.data)))
 
 				continue
 			}
 
-			if err := c.sendData(1, data); err != nil {
+			if err := c.sendData(frame.channel, frame.data); err != nil {
+				c.closeWithError(err)
+				return
+			}
+
+		case <-keepAliveC:
+			if time.Since(c.lastActivity) > c.keepAliveTimeout {
+				c.closeWithError(ErrKeepAliveTimeout)
+				return
+			}
+
+			if err := c.sendKeepAlive(); err != nil {
 				c.closeWithError(err)
 				return
 			}
 
 		case <-c.closed:
 			return
+
+		case <-ctxDone:
+			c.closeWithError(c.ctx.Err())
+			return
 		}
 	}
 }
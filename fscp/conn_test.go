@@ -0,0 +1,173 @@
+package fscp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func newTestConn() *Conn {
+	localAddr := &Addr{TransportAddr: inMemoryAddr("local")}
+	remoteAddr := &Addr{TransportAddr: inMemoryAddr("remote")}
+
+	return newConn(context.Background(), localAddr, remoteAddr, io.Discard, HostIdentifier{}, ClientSecurity{}, ClientOptions{QueueSize: 1})
+}
+
+func TestConnReadDeadline(t *testing.T) {
+	conn := newTestConn()
+	defer conn.closeWithError(io.EOF)
+
+	if err := conn.SetReadDeadline(time.Now().Add(20 * time.Millisecond)); err != nil {
+		t.Fatalf("expected no error: %s", err)
+	}
+
+	_, err := conn.Read(make([]byte, 1))
+
+	var netErr net.Error
+
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("expected a timeout net.Error, got: %s", err)
+	}
+}
+
+func TestConnWriteDeadline(t *testing.T) {
+	conn := newTestConn()
+	defer conn.closeWithError(io.EOF)
+
+	if err := conn.SetWriteDeadline(time.Now().Add(20 * time.Millisecond)); err != nil {
+		t.Fatalf("expected no error: %s", err)
+	}
+
+	// The connection never completes its handshake, so Write blocks until
+	// the deadline kicks in.
+	_, err := conn.Write([]byte("hello"))
+
+	var netErr net.Error
+
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("expected a timeout net.Error, got: %s", err)
+	}
+}
+
+// TestDialContextCancellationStopsConnection verifies that cancelling the
+// context passed to DialContext doesn't just abandon the caller's wait: it
+// also stops the underlying hello-request retries and tears the connection
+// down, the same way net.Dialer.DialContext gives up on a dial.
+func TestDialContextCancellationStopsConnection(t *testing.T) {
+	network := NewInMemoryNetwork()
+
+	// A black-hole listener: it never replies, so the HELLO handshake never
+	// completes and the retrier keeps firing until ctx gives up.
+	serverTransport, err := network.Listen("server")
+
+	if err != nil {
+		t.Fatalf("expected no error: %s", err)
+	}
+
+	defer serverTransport.Close()
+
+	clientTransport, err := network.Listen("client")
+
+	if err != nil {
+		t.Fatalf("expected no error: %s", err)
+	}
+
+	client, err := NewClient(clientTransport, nil, nil)
+
+	if err != nil {
+		t.Fatalf("expected no error: %s", err)
+	}
+
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	addr := serverTransport.LocalAddr()
+
+	if _, err := client.DialContext(ctx, addr); !errors.Is(err, ctx.Err()) {
+		t.Fatalf("expected DialContext to fail with `%s`, got: `%s`", ctx.Err(), err)
+	}
+
+	client.lock.Lock()
+	conn, ok := client.connsByAddr[addr.String()]
+	client.lock.Unlock()
+
+	if !ok {
+		// The connection was already unregistered, which means it closed
+		// already: that's what we're checking for.
+		return
+	}
+
+	select {
+	case <-conn.closed:
+	case <-time.After(time.Second):
+		t.Fatalf("expected the connection to close once its context expired")
+	}
+}
+
+// TestConnKeepAliveKeepsConnectionAlive verifies that periodic keep-alives
+// sent by both ends of a connection keep each other's lastActivity fresh,
+// so an otherwise silent connection doesn't get mistaken for a dead peer.
+func TestConnKeepAliveKeepsConnectionAlive(t *testing.T) {
+	network := NewInMemoryNetwork()
+
+	serverTransport, err := network.Listen("keepalive-server")
+
+	if err != nil {
+		t.Fatalf("expected no error: %s", err)
+	}
+
+	defer serverTransport.Close()
+
+	clientTransport, err := network.Listen("keepalive-client")
+
+	if err != nil {
+		t.Fatalf("expected no error: %s", err)
+	}
+
+	opts := &ClientOptions{
+		KeepAliveInterval: 20 * time.Millisecond,
+		KeepAliveTimeout:  60 * time.Millisecond,
+	}
+
+	server, err := NewClient(serverTransport, nil, opts)
+
+	if err != nil {
+		t.Fatalf("expected no error: %s", err)
+	}
+
+	defer server.Close()
+
+	client, err := NewClient(clientTransport, nil, opts)
+
+	if err != nil {
+		t.Fatalf("expected no error: %s", err)
+	}
+
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	addr := serverTransport.LocalAddr()
+
+	go server.Accept()
+
+	clientConn, err := client.DialContext(ctx, addr)
+
+	if err != nil {
+		t.Fatalf("client connecting to %s: %s", addr, err)
+	}
+
+	defer clientConn.Close()
+
+	select {
+	case <-clientConn.closed:
+		t.Fatalf("expected the connection to stay alive while keep-alives are flowing, got: %s", clientConn.closeError)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
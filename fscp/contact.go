@@ -0,0 +1,59 @@
+package fscp
+
+import (
+	"fmt"
+	"io"
+)
+
+// ContactInfo is an endpoint hint a peer reports in response to Contact:
+// the transport address it observed this connection coming from, the same
+// information a STUN binding response carries. Exchanging these hints lets
+// two hosts behind NAT discover addresses worth trying for hole punching.
+type ContactInfo struct {
+	Addr string
+}
+
+// Contact asks the peer what transport address it sees this connection
+// coming from. The answer, once it arrives, is delivered on the channel
+// returned by ContactHints.
+func (c *Conn) Contact() error {
+	select {
+	case <-c.closed:
+		return io.ErrClosedPipe
+	case <-c.connected:
+	default:
+		return fmt.Errorf("fscp: contact requires an established session")
+	}
+
+	return c.sendContactRequest()
+}
+
+// ContactHints returns the channel ContactInfo hints reported by the peer,
+// in response to Contact, are delivered on.
+func (c *Conn) ContactHints() <-chan ContactInfo {
+	return c.contactHints
+}
+
+func (c *Conn) sendContactRequest() error {
+	msg, err := c.session.Encrypt(nil)
+
+	if err != nil {
+		return fmt.Errorf("encrypting contact request: %s", err)
+	}
+
+	c.log().Debug("message_sent", "type", MessageTypeContactRequest)
+
+	return c.writeMessage(MessageTypeContactRequest, msg)
+}
+
+func (c *Conn) sendContact() error {
+	msg, err := c.session.Encrypt([]byte(c.remoteAddr.String()))
+
+	if err != nil {
+		return fmt.Errorf("encrypting contact: %s", err)
+	}
+
+	c.log().Debug("message_sent", "type", MessageTypeContact, "addr", c.remoteAddr)
+
+	return c.writeMessage(MessageTypeContact, msg)
+}
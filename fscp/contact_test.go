@@ -0,0 +1,89 @@
+package fscp
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestConnContact(t *testing.T) {
+	network := NewInMemoryNetwork()
+
+	serverTransport, err := network.Listen("contact-server")
+
+	if err != nil {
+		t.Fatalf("expected no error: %s", err)
+	}
+
+	defer serverTransport.Close()
+
+	clientTransport, err := network.Listen("contact-client")
+
+	if err != nil {
+		t.Fatalf("expected no error: %s", err)
+	}
+
+	server, err := NewClient(serverTransport, nil, nil)
+
+	if err != nil {
+		t.Fatalf("expected no error: %s", err)
+	}
+
+	defer server.Close()
+
+	client, err := NewClient(clientTransport, nil, nil)
+
+	if err != nil {
+		t.Fatalf("expected no error: %s", err)
+	}
+
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	addr := serverTransport.LocalAddr()
+
+	serverConnCh := make(chan net.Conn, 1)
+
+	go func() {
+		conn, err := server.Accept()
+
+		if err == nil {
+			serverConnCh <- conn
+		}
+	}()
+
+	clientConn, err := client.DialContext(ctx, addr)
+
+	if err != nil {
+		t.Fatalf("client connecting to %s: %s", addr, err)
+	}
+
+	defer clientConn.Close()
+
+	var serverConn *Conn
+
+	select {
+	case conn := <-serverConnCh:
+		serverConn = conn.(*Conn)
+	case <-time.After(time.Second):
+		t.Fatal("expected the server to accept a connection")
+	}
+
+	defer serverConn.Close()
+
+	if err := clientConn.Contact(); err != nil {
+		t.Fatalf("expected no error: %s", err)
+	}
+
+	select {
+	case hint := <-clientConn.ContactHints():
+		if hint.Addr != serverConn.RemoteAddr().String() {
+			t.Errorf("expected `%s`, got `%s`", serverConn.RemoteAddr(), hint.Addr)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected a contact hint in response")
+	}
+}
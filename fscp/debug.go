@@ -2,22 +2,18 @@ package fscp
 
 import (
 	"encoding/hex"
-	"fmt"
 	"os"
 )
 
+// debug gates envLogger's stderr output and mirrors the historical
+// FREELAN_FSCP_DEBUG=1 switch, kept for backward compatibility now that
+// logging itself goes through the Logger interface.
 var debug = readDebug()
 
 func readDebug() bool {
 	return os.Getenv("FREELAN_FSCP_DEBUG") == "1"
 }
 
-func debugPrintf(msg string, args ...interface{}) {
-	if debug {
-		fmt.Fprintf(os.Stderr, msg, args...)
-	}
-}
-
 type debugLenReader struct {
 	lenReader
 }
@@ -0,0 +1,181 @@
+package fscp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Preference controls how a Dialer orders candidate addresses when a
+// hostname resolves to both IPv4 and IPv6 records, mirroring the
+// `ip-version` option found in Clash's base dialer options.
+type Preference uint8
+
+const (
+	// DualStack tries every resolved address in the order returned by the
+	// resolver. This is the default.
+	DualStack Preference = iota
+	// IPv4Only discards every IPv6 candidate.
+	IPv4Only
+	// IPv6Only discards every IPv4 candidate.
+	IPv6Only
+	// IPv4Prefer tries IPv4 candidates before IPv6 ones.
+	IPv4Prefer
+	// IPv6Prefer tries IPv6 candidates before IPv4 ones.
+	IPv6Prefer
+)
+
+// DefaultFallbackDelay is the default delay between staggered connection
+// attempts, as recommended by RFC 8305 ("Happy Eyeballs").
+const DefaultFallbackDelay = 250 * time.Millisecond
+
+// order filters and/or reorders addrs according to the preference.
+func (p Preference) order(addrs []*Addr) []*Addr {
+	var v4, v6 []*Addr
+
+	for _, addr := range addrs {
+		if isIPv4Addr(addr) {
+			v4 = append(v4, addr)
+		} else {
+			v6 = append(v6, addr)
+		}
+	}
+
+	switch p {
+	case IPv4Only:
+		return v4
+	case IPv6Only:
+		return v6
+	case IPv4Prefer:
+		return append(v4, v6...)
+	case IPv6Prefer:
+		return append(v6, v4...)
+	default:
+		return addrs
+	}
+}
+
+func isIPv4Addr(addr *Addr) bool {
+	udpAddr, ok := addr.TransportAddr.(*net.UDPAddr)
+
+	return ok && udpAddr.IP.To4() != nil
+}
+
+// ResolveFSCPAddrs parses a FSCP address, returning one candidate *Addr per
+// A/AAAA record the host part resolves to.
+func ResolveFSCPAddrs(network, address string) ([]*Addr, error) {
+	switch network {
+	case Network:
+		host, port, err := net.SplitHostPort(address)
+
+		if err != nil {
+			return nil, fmt.Errorf("parsing FSCP address: %s", err)
+		}
+
+		portNum, err := net.DefaultResolver.LookupPort(context.Background(), "udp", port)
+
+		if err != nil {
+			return nil, fmt.Errorf("parsing FSCP address: %s", err)
+		}
+
+		ips, err := net.DefaultResolver.LookupIPAddr(context.Background(), host)
+
+		if err != nil {
+			return nil, fmt.Errorf("resolving FSCP address: %s", err)
+		}
+
+		addrs := make([]*Addr, 0, len(ips))
+
+		for _, ip := range ips {
+			addrs = append(addrs, &Addr{
+				TransportAddr: &net.UDPAddr{
+					IP:   ip.IP,
+					Port: portNum,
+					Zone: ip.Zone,
+				},
+			})
+		}
+
+		return addrs, nil
+	default:
+		return nil, fmt.Errorf("unsupported network: %s", network)
+	}
+}
+
+// listen opens the local socket used for dialing, honoring d.LocalAddr and
+// d.Control.
+func (d *Dialer) listen(network string, laddr *Addr) (*Client, error) {
+	if laddr == nil {
+		if d.LocalAddr != nil {
+			laddr = d.LocalAddr
+		} else {
+			laddr = DefaultAddr
+		}
+	}
+
+	if d.Control == nil {
+		return ListenFSCP(network, laddr)
+	}
+
+	switch network {
+	case Network:
+		udpAddr, ok := laddr.TransportAddr.(*net.UDPAddr)
+
+		if !ok {
+			return nil, &net.OpError{Op: "listen", Net: network, Addr: laddr, Err: fmt.Errorf("unsupported transport address for FSCP: %#v", laddr)}
+		}
+
+		listenConfig := net.ListenConfig{Control: d.Control}
+
+		conn, err := listenConfig.ListenPacket(context.Background(), "udp", udpAddr.String())
+
+		if err != nil {
+			return nil, err
+		}
+
+		return NewClient(NewUDPTransport(conn), nil, nil)
+	default:
+		return nil, &net.OpError{Op: "listen", Net: network, Addr: laddr, Err: fmt.Errorf("unsupported network: %s", network)}
+	}
+}
+
+// raceDial dials every raddr, staggering attempts by d.FallbackDelay and
+// returning the first one that completes its handshake.
+func (d *Dialer) raceDial(network string, laddr *Addr, raddrs []*Addr) (*Conn, error) {
+	delay := d.FallbackDelay
+
+	if delay <= 0 {
+		delay = DefaultFallbackDelay
+	}
+
+	type result struct {
+		conn *Conn
+		err  error
+	}
+
+	results := make(chan result, len(raddrs))
+
+	for i, raddr := range raddrs {
+		go func(i int, raddr *Addr) {
+			time.Sleep(time.Duration(i) * delay)
+
+			conn, err := d.dialOne(network, laddr, raddr)
+			results <- result{conn, err}
+		}(i, raddr)
+	}
+
+	var lastErr error
+
+	for range raddrs {
+		r := <-results
+
+		if r.err == nil {
+			return r.conn, nil
+		}
+
+		lastErr = r.err
+	}
+
+	return nil, lastErr
+}
@@ -4,9 +4,9 @@ package fscp
 
 import "strconv"
 
-const _EllipticCurve_name = "SECT571K1SECP384R1SECP521R1"
+const _EllipticCurve_name = "SECT571K1SECP384R1SECP521R1KYBER768_SECP384R1NEWHOPE_SECP521R1"
 
-var _EllipticCurve_index = [...]uint8{0, 9, 18, 27}
+var _EllipticCurve_index = [...]uint8{0, 9, 18, 27, 45, 62}
 
 func (i EllipticCurve) String() string {
 	i -= 1
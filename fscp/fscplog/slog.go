@@ -0,0 +1,43 @@
+// Package fscplog adapts fscp.Logger to popular third-party logging
+// packages, so a program that already routes its own logs through
+// log/slog, zap, or syslog can do the same for go-freelan's connection
+// events instead of relying on the built-in FREELAN_FSCP_DEBUG fallback.
+package fscplog
+
+import (
+	"log/slog"
+
+	"github.com/freelan-developers/go-freelan/fscp"
+)
+
+// slogLogger adapts a *slog.Logger to fscp.Logger.
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+// NewSlogLogger returns an fscp.Logger that forwards every event to logger,
+// keyed by event name with its keyvals passed through as slog attributes.
+// A nil logger uses slog.Default().
+func NewSlogLogger(logger *slog.Logger) fscp.Logger {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return slogLogger{logger: logger}
+}
+
+func (l slogLogger) Debug(event string, keyvals ...interface{}) {
+	l.logger.Debug(event, keyvals...)
+}
+
+func (l slogLogger) Info(event string, keyvals ...interface{}) {
+	l.logger.Info(event, keyvals...)
+}
+
+func (l slogLogger) Warn(event string, keyvals ...interface{}) {
+	l.logger.Warn(event, keyvals...)
+}
+
+func (l slogLogger) Error(event string, keyvals ...interface{}) {
+	l.logger.Error(event, keyvals...)
+}
@@ -0,0 +1,64 @@
+package fscplog
+
+import (
+	"fmt"
+	"strings"
+
+	gsyslog "github.com/hashicorp/go-syslog"
+
+	"github.com/freelan-developers/go-freelan/fscp"
+)
+
+// syslogLogger adapts a gsyslog.Syslogger to fscp.Logger, so a freelan
+// daemon can ship its connection events to the local syslog the same way
+// it already ships everything else.
+type syslogLogger struct {
+	logger gsyslog.Syslogger
+}
+
+// NewSyslogLogger returns an fscp.Logger that writes every event to the
+// local syslog through logger, tagging each line with its level.
+func NewSyslogLogger(logger gsyslog.Syslogger) fscp.Logger {
+	return syslogLogger{logger: logger}
+}
+
+func (l syslogLogger) Debug(event string, keyvals ...interface{}) {
+	l.write(gsyslog.LOG_DEBUG, event, keyvals)
+}
+
+func (l syslogLogger) Info(event string, keyvals ...interface{}) {
+	l.write(gsyslog.LOG_INFO, event, keyvals)
+}
+
+func (l syslogLogger) Warn(event string, keyvals ...interface{}) {
+	l.write(gsyslog.LOG_WARNING, event, keyvals)
+}
+
+func (l syslogLogger) Error(event string, keyvals ...interface{}) {
+	l.write(gsyslog.LOG_ERR, event, keyvals)
+}
+
+func (l syslogLogger) write(priority gsyslog.Priority, event string, keyvals []interface{}) {
+	l.logger.WriteLevel(priority, []byte(formatEvent(event, keyvals)))
+}
+
+// formatEvent renders event and keyvals as a single logfmt-like line, e.g.
+// `session_established session_number=1 cipher_suite=ECDHERSAAES256GCMSHA384`.
+func formatEvent(event string, keyvals []interface{}) string {
+	var b strings.Builder
+
+	b.WriteString(event)
+
+	for i := 0; i < len(keyvals); i += 2 {
+		key := keyvals[i]
+		value := interface{}("<missing>")
+
+		if i+1 < len(keyvals) {
+			value = keyvals[i+1]
+		}
+
+		fmt.Fprintf(&b, " %v=%v", key, value)
+	}
+
+	return b.String()
+}
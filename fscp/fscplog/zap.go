@@ -0,0 +1,39 @@
+package fscplog
+
+import (
+	"go.uber.org/zap"
+
+	"github.com/freelan-developers/go-freelan/fscp"
+)
+
+// zapLogger adapts a *zap.SugaredLogger to fscp.Logger.
+type zapLogger struct {
+	logger *zap.SugaredLogger
+}
+
+// NewZapLogger returns an fscp.Logger that forwards every event to logger
+// as the log message, with its keyvals passed through as structured
+// fields. A nil logger uses zap.NewNop().Sugar().
+func NewZapLogger(logger *zap.SugaredLogger) fscp.Logger {
+	if logger == nil {
+		logger = zap.NewNop().Sugar()
+	}
+
+	return zapLogger{logger: logger}
+}
+
+func (l zapLogger) Debug(event string, keyvals ...interface{}) {
+	l.logger.Debugw(event, keyvals...)
+}
+
+func (l zapLogger) Info(event string, keyvals ...interface{}) {
+	l.logger.Infow(event, keyvals...)
+}
+
+func (l zapLogger) Warn(event string, keyvals ...interface{}) {
+	l.logger.Warnw(event, keyvals...)
+}
+
+func (l zapLogger) Error(event string, keyvals ...interface{}) {
+	l.logger.Errorw(event, keyvals...)
+}
@@ -56,7 +56,7 @@ func TestRealConnection(t *testing.T) {
 		client.Close()
 	}()
 
-	clientConn, err := client.Connect(ctx, remoteAddr)
+	clientConn, err := client.DialContext(ctx, remoteAddr)
 
 	if err != nil {
 		t.Fatalf("client connecting to %s: %s", remoteAddr, err)
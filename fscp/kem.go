@@ -0,0 +1,25 @@
+package fscp
+
+// pqKEM abstracts a post-quantum key encapsulation mechanism, so the
+// algorithm backing a hybrid EllipticCurve can be swapped without touching
+// Session.
+type pqKEM interface {
+	// GenerateKeyPair returns a fresh (public, private) key pair.
+	GenerateKeyPair() (publicKey, privateKey []byte, err error)
+
+	// Encapsulate derives a shared secret for publicKey and returns the
+	// ciphertext its owner must decapsulate to recover that same secret.
+	Encapsulate(publicKey []byte) (ciphertext, sharedSecret []byte, err error)
+
+	// Decapsulate recovers the shared secret Encapsulate produced against
+	// privateKey's matching public key.
+	Decapsulate(privateKey, ciphertext []byte) (sharedSecret []byte, err error)
+
+	// PublicKeySize returns the encoded length, in bytes, of a public key
+	// returned by GenerateKeyPair.
+	PublicKeySize() int
+
+	// CiphertextSize returns the encoded length, in bytes, of a ciphertext
+	// returned by Encapsulate.
+	CiphertextSize() int
+}
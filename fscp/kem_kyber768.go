@@ -0,0 +1,65 @@
+package fscp
+
+import (
+	"fmt"
+
+	"github.com/cloudflare/circl/kem/kyber/kyber768"
+)
+
+// kyber768KEM implements pqKEM on top of CIRCL's Kyber768, NIST's selected
+// post-quantum key encapsulation mechanism.
+type kyber768KEM struct{}
+
+func (kyber768KEM) GenerateKeyPair() (publicKey, privateKey []byte, err error) {
+	pub, priv, err := kyber768.Scheme().GenerateKeyPair()
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("generating Kyber768 key pair: %s", err)
+	}
+
+	if publicKey, err = pub.MarshalBinary(); err != nil {
+		return nil, nil, fmt.Errorf("marshaling Kyber768 public key: %s", err)
+	}
+
+	if privateKey, err = priv.MarshalBinary(); err != nil {
+		return nil, nil, fmt.Errorf("marshaling Kyber768 private key: %s", err)
+	}
+
+	return publicKey, privateKey, nil
+}
+
+func (kyber768KEM) Encapsulate(publicKey []byte) (ciphertext, sharedSecret []byte, err error) {
+	pub, err := kyber768.Scheme().UnmarshalBinaryPublicKey(publicKey)
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing Kyber768 public key: %s", err)
+	}
+
+	ciphertext, sharedSecret, err = kyber768.Scheme().Encapsulate(pub)
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("encapsulating Kyber768 shared secret: %s", err)
+	}
+
+	return ciphertext, sharedSecret, nil
+}
+
+func (kyber768KEM) Decapsulate(privateKey, ciphertext []byte) (sharedSecret []byte, err error) {
+	priv, err := kyber768.Scheme().UnmarshalBinaryPrivateKey(privateKey)
+
+	if err != nil {
+		return nil, fmt.Errorf("parsing Kyber768 private key: %s", err)
+	}
+
+	sharedSecret, err = kyber768.Scheme().Decapsulate(priv, ciphertext)
+
+	if err != nil {
+		return nil, fmt.Errorf("decapsulating Kyber768 shared secret: %s", err)
+	}
+
+	return sharedSecret, nil
+}
+
+func (kyber768KEM) PublicKeySize() int { return kyber768.Scheme().PublicKeySize() }
+
+func (kyber768KEM) CiphertextSize() int { return kyber768.Scheme().CiphertextSize() }
@@ -0,0 +1,85 @@
+package fscp
+
+import (
+	"crypto"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// protocolVersion identifies the FSCP wire format deriveSessionKeys' salt
+// is tied to, so that a future protocol revision derives unrelated keys
+// from the same ECDH shared secret even if every other input stayed the
+// same.
+const protocolVersion = 3
+
+// deriveSessionKeys expands shared, the ECDH(E) shared secret computed by
+// Session.SetRemote, into the AES-GCM (or ChaCha20-Poly1305) key and
+// nonce prefix for each direction of the session, via HKDF-Extract/Expand
+// (RFC 5869) keyed by suite's hash function.
+//
+// info binds the direction ("fscp enc"/"fscp dec"), both host
+// identifiers and both session numbers to each output, ordered sender
+// first: encKey/encIV are derived as (localHID, localSID) -> (remoteHID,
+// remoteSID), decKey/decIV as the reverse. The two peers compute the
+// same four values with localHID/localSID and remoteHID/remoteSID
+// swapped, so one side's encKey is the other side's decKey.
+func deriveSessionKeys(shared []byte, suite CipherSuite, localHID, remoteHID HostIdentifier, localSID, remoteSID SessionNumber) (encKey, decKey, encIV, decIV []byte, err error) {
+	h := suite.hash()
+
+	if h == 0 {
+		return nil, nil, nil, nil, fmt.Errorf("cannot derive session keys for %s", suite)
+	}
+
+	var salt [4]byte
+	binary.BigEndian.PutUint32(salt[:], protocolVersion)
+
+	extract := hkdf.Extract(h.New, shared, salt[:])
+	keySize := suite.BlockSize()
+
+	if encKey, err = expandSessionSecret(h, extract, "fscp enc", localHID, remoteHID, localSID, remoteSID, keySize); err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	if decKey, err = expandSessionSecret(h, extract, "fscp dec", remoteHID, localHID, remoteSID, localSID, keySize); err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	// 8 bytes: the remaining 4 bytes of the 12-byte GCM nonce carry the
+	// message's sequence number (see updateIV).
+	if encIV, err = expandSessionSecret(h, extract, "fscp enc nonce prefix", localHID, remoteHID, localSID, remoteSID, 8); err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	if decIV, err = expandSessionSecret(h, extract, "fscp dec nonce prefix", remoteHID, localHID, remoteSID, localSID, 8); err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	return encKey, decKey, encIV, decIV, nil
+}
+
+// expandSessionSecret runs one HKDF-Expand over extract, with an info
+// string combining label with senderHID/senderSID followed by
+// receiverHID/receiverSID, and returns the first n bytes of output.
+func expandSessionSecret(h crypto.Hash, extract []byte, label string, senderHID, receiverHID HostIdentifier, senderSID, receiverSID SessionNumber, n int) ([]byte, error) {
+	var senderSIDBytes, receiverSIDBytes [4]byte
+	binary.BigEndian.PutUint32(senderSIDBytes[:], uint32(senderSID))
+	binary.BigEndian.PutUint32(receiverSIDBytes[:], uint32(receiverSID))
+
+	info := make([]byte, 0, len(label)+len(senderHID)+len(receiverHID)+len(senderSIDBytes)+len(receiverSIDBytes))
+	info = append(info, label...)
+	info = append(info, senderHID[:]...)
+	info = append(info, receiverHID[:]...)
+	info = append(info, senderSIDBytes[:]...)
+	info = append(info, receiverSIDBytes[:]...)
+
+	secret := make([]byte, n)
+
+	if _, err := io.ReadFull(hkdf.Expand(h.New, extract, info), secret); err != nil {
+		return nil, fmt.Errorf("deriving %s: %s", label, err)
+	}
+
+	return secret, nil
+}
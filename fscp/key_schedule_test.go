@@ -0,0 +1,55 @@
+package fscp
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDeriveSessionKeysSymmetric(t *testing.T) {
+	shared := []byte("a shared secret, 32 bytes long!")
+	suite := ECDHERSAAES128GCMSHA256
+
+	var aHID, bHID HostIdentifier
+	aHID[0] = 0xaa
+	bHID[0] = 0xbb
+
+	aEncKey, aDecKey, aEncIV, aDecIV, err := deriveSessionKeys(shared, suite, aHID, bHID, 1, 1)
+
+	if err != nil {
+		t.Fatalf("deriving A's keys: %s", err)
+	}
+
+	bEncKey, bDecKey, bEncIV, bDecIV, err := deriveSessionKeys(shared, suite, bHID, aHID, 1, 1)
+
+	if err != nil {
+		t.Fatalf("deriving B's keys: %s", err)
+	}
+
+	if !bytes.Equal(aEncKey, bDecKey) {
+		t.Error("A's encryption key should equal B's decryption key")
+	}
+
+	if !bytes.Equal(aDecKey, bEncKey) {
+		t.Error("A's decryption key should equal B's encryption key")
+	}
+
+	if !bytes.Equal(aEncIV, bDecIV) {
+		t.Error("A's encryption nonce prefix should equal B's decryption nonce prefix")
+	}
+
+	if !bytes.Equal(aDecIV, bEncIV) {
+		t.Error("A's decryption nonce prefix should equal B's encryption nonce prefix")
+	}
+
+	if bytes.Equal(aEncKey, aDecKey) {
+		t.Error("the two directions should not share a key")
+	}
+}
+
+func TestDeriveSessionKeysRejectsNullCipherSuite(t *testing.T) {
+	var aHID, bHID HostIdentifier
+
+	if _, _, _, _, err := deriveSessionKeys([]byte("secret"), NullCipherSuite, aHID, bHID, 1, 1); err == nil {
+		t.Error("expected an error but got none")
+	}
+}
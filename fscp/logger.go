@@ -0,0 +1,87 @@
+package fscp
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Logger receives structured log events from a Client or Conn: handshake
+// progress, session negotiation, dropped frames, and similar operational
+// detail that used to only be available through debugPrintf. Set one on
+// ClientOptions (or later via Client.SetLogger/Conn.SetLogger) to route
+// these events to syslog, a JSON collector, or any other sink instead of
+// go-freelan's built-in FREELAN_FSCP_DEBUG stderr dump.
+//
+// Methods take an event name followed by an alternating list of string
+// keys and arbitrary values, in the spirit of go-hclog and
+// zap.SugaredLogger, so adapters can forward them verbatim without having
+// to parse a formatted message back apart.
+type Logger interface {
+	Debug(event string, keyvals ...interface{})
+	Info(event string, keyvals ...interface{})
+	Warn(event string, keyvals ...interface{})
+	Error(event string, keyvals ...interface{})
+}
+
+// discardLogger is the Logger used whenever none was configured and the
+// FREELAN_FSCP_DEBUG fallback is disabled.
+type discardLogger struct{}
+
+func (discardLogger) Debug(event string, keyvals ...interface{}) {}
+func (discardLogger) Info(event string, keyvals ...interface{})  {}
+func (discardLogger) Warn(event string, keyvals ...interface{})  {}
+func (discardLogger) Error(event string, keyvals ...interface{}) {}
+
+// envLogger is the default Logger: it reproduces the historical
+// FREELAN_FSCP_DEBUG=1 behavior by writing every event, at every level, to
+// os.Stderr, and does nothing when the environment variable isn't set.
+// It exists so that a program doing nothing beyond setting that variable
+// keeps working exactly as before the Logger interface was introduced.
+type envLogger struct{}
+
+func (l envLogger) Debug(event string, keyvals ...interface{}) { l.log("DEBUG", event, keyvals) }
+func (l envLogger) Info(event string, keyvals ...interface{})  { l.log("INFO", event, keyvals) }
+func (l envLogger) Warn(event string, keyvals ...interface{})  { l.log("WARN", event, keyvals) }
+func (l envLogger) Error(event string, keyvals ...interface{}) { l.log("ERROR", event, keyvals) }
+
+func (envLogger) log(level, event string, keyvals []interface{}) {
+	if !debug {
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "[%s] %s\n", level, formatEvent(event, keyvals))
+}
+
+// formatEvent renders event and keyvals as a single logfmt-like line, e.g.
+// `session_established session_number=1 cipher_suite=ECDHERSAAES256GCMSHA384`.
+// An odd keyvals length or a missing value is rendered as "<missing>"
+// rather than panicking, since this is called from error paths.
+func formatEvent(event string, keyvals []interface{}) string {
+	var b strings.Builder
+
+	b.WriteString(event)
+
+	for i := 0; i < len(keyvals); i += 2 {
+		key := keyvals[i]
+		value := interface{}("<missing>")
+
+		if i+1 < len(keyvals) {
+			value = keyvals[i+1]
+		}
+
+		fmt.Fprintf(&b, " %v=%v", key, value)
+	}
+
+	return b.String()
+}
+
+// loggerOrDiscard returns l, or discardLogger{} if l is nil, so callers can
+// log unconditionally.
+func loggerOrDiscard(l Logger) Logger {
+	if l == nil {
+		return discardLogger{}
+	}
+
+	return l
+}
@@ -0,0 +1,54 @@
+package fscp
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestMessageCodecRejectsOversizedPayload(t *testing.T) {
+	buf := &bytes.Buffer{}
+	buf.Write([]byte{byte(MessageVersion3), byte(MessageTypeHelloRequest), 0x00, 0x10})
+	buf.Write(make([]byte, 4))
+
+	codec := MessageCodec{MaxMessageSize: 8}
+
+	if _, _, err := codec.ReadMessage(buf, nil); err == nil {
+		t.Error("expected an error but got none")
+	}
+}
+
+func TestMessageFramerReadsConsecutiveMessages(t *testing.T) {
+	buf := &bytes.Buffer{}
+	codec := MessageCodec{}
+
+	for i := 0; i < 3; i++ {
+		if err := codec.WriteMessage(buf, MessageTypeHelloRequest, &messageHello{UniqueNumber: UniqueNumber(i)}, nil); err != nil {
+			t.Fatalf("writing message %d: %s", i, err)
+		}
+	}
+
+	framer := NewMessageFramer(buf, codec, nil)
+
+	for i := 0; i < 3; i++ {
+		_, msg, err := framer.ReadMessage()
+
+		if err != nil {
+			t.Fatalf("reading message %d: %s", i, err)
+		}
+
+		hello, ok := msg.(*messageHello)
+
+		if !ok {
+			t.Fatalf("expected a *messageHello but got %T", msg)
+		}
+
+		if hello.UniqueNumber != UniqueNumber(i) {
+			t.Errorf("expected unique number %d but got %d", i, hello.UniqueNumber)
+		}
+	}
+
+	if _, _, err := framer.ReadMessage(); err != io.EOF && err == nil {
+		t.Error("expected an error reading past the last message")
+	}
+}
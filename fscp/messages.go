@@ -29,6 +29,8 @@ const (
 	MessageTypeSessionRequest MessageType = 0x03
 	// MessageTypeSession is a SESSION message.
 	MessageTypeSession MessageType = 0x04
+	// MessageTypeAlert is an ALERT message.
+	MessageTypeAlert MessageType = 0x05
 	// MessageTypeData is a DATA message.
 	MessageTypeData = 0x70
 	// MessageTypeContactRequest is a CONTACT REQUEST message.
@@ -51,6 +53,8 @@ func (m MessageType) String() string {
 		return "SESSION (request)"
 	case MessageTypeSession:
 		return "SESSION"
+	case MessageTypeAlert:
+		return "ALERT"
 	case MessageTypeData:
 		return "DATA"
 	case MessageTypeContactRequest:
@@ -69,81 +73,130 @@ type lenReader interface {
 	Len() int
 }
 
-// Write a message header to the specified writer.
-func writeHeader(b *bytes.Buffer, t MessageType, payloadSize int) (err error) {
-	b.Grow(4 + payloadSize)
+// DefaultMaxMessageSize is the default upper bound a MessageCodec places
+// on a message's declared payload size: the largest value the wire
+// format's 16-bit length prefix can express.
+const DefaultMaxMessageSize = 1<<16 - 1
 
-	if err = binary.Write(b, binary.BigEndian, uint8(3)); err != nil {
-		return err
+// MessageCodec reads and writes FSCP messages against a stream.
+//
+// The zero value is ready to use and enforces DefaultMaxMessageSize. A
+// Conn's underlying transport is a UDP-style datagram stream, so its
+// reads and writes go through a MessageCodec against an in-memory
+// *bytes.Buffer/*bytes.Reader holding a whole datagram; MessageFramer
+// drives the same MessageCodec against a genuine byte stream, such as a
+// future TCP transport, where a message's bytes may arrive over several
+// reads.
+type MessageCodec struct {
+	// MaxMessageSize caps the payload size a header may declare (and so,
+	// transitively, every length-prefixed sub-field deserialize reads out
+	// of it): ReadMessage refuses to allocate a payload buffer larger
+	// than this, so a peer cannot turn a crafted length prefix into an
+	// unbounded allocation. Zero, or a value above DefaultMaxMessageSize,
+	// selects DefaultMaxMessageSize.
+	MaxMessageSize int
+}
+
+func (c MessageCodec) maxMessageSize() int {
+	if c.MaxMessageSize <= 0 || c.MaxMessageSize > DefaultMaxMessageSize {
+		return DefaultMaxMessageSize
+	}
+
+	return c.MaxMessageSize
+}
+
+func (c MessageCodec) writeHeader(w io.Writer, t MessageType, payloadSize int) (err error) {
+	if payloadSize > c.maxMessageSize() {
+		return fmt.Errorf("message payload of %d byte(s) exceeds the maximum of %d", payloadSize, c.maxMessageSize())
 	}
 
-	if err = binary.Write(b, binary.BigEndian, t); err != nil {
+	if err = binary.Write(w, binary.BigEndian, uint8(MessageVersion3)); err != nil {
 		return err
 	}
 
-	if err = binary.Write(b, binary.BigEndian, uint16(payloadSize)); err != nil {
+	if err = binary.Write(w, binary.BigEndian, t); err != nil {
 		return err
 	}
 
-	return nil
+	return binary.Write(w, binary.BigEndian, uint16(payloadSize))
 }
 
-func writeMessage(b *bytes.Buffer, t MessageType, msg serializable) (err error) {
-	if err = writeHeader(b, t, msg.serializationSize()); err != nil {
+// WriteMessage writes t's header followed by msg's serialized payload to w.
+func (c MessageCodec) WriteMessage(w io.Writer, t MessageType, msg serializable, tr Tracer) (err error) {
+	size := msg.serializationSize()
+
+	if err = c.writeHeader(w, t, size); err != nil {
+		return err
+	}
+
+	if err = msg.serialize(w); err != nil {
 		return err
 	}
 
-	return msg.serialize(b)
+	traceOrDiscard(tr).OnMessageSent(t, 4+size)
+
+	return nil
 }
 
-func writeDataMessage(b *bytes.Buffer, msg *messageData) error {
-	return writeMessage(b, MessageTypeData+MessageType(msg.Channel), msg)
+// WriteDataMessage writes msg to w as a DATA message on its Channel.
+func (c MessageCodec) WriteDataMessage(w io.Writer, msg *messageData, tr Tracer) error {
+	return c.WriteMessage(w, MessageTypeData+MessageType(msg.Channel), msg, tr)
 }
 
-func readHeader(b lenReader) (t MessageType, payloadSize int, err error) {
-	if b.Len() < 4 {
-		err = fmt.Errorf("unable to parse header: only %d byte(s) when %d or more were expected", b.Len(), 4)
-		return
+func (c MessageCodec) readHeader(r io.Reader) (t MessageType, payloadSize int, err error) {
+	var header [4]byte
+
+	if _, err = io.ReadFull(r, header[:]); err != nil {
+		return 0, 0, fmt.Errorf("reading header: %s", err)
 	}
 
-	var version MessageVersion
+	if version := MessageVersion(header[0]); version != MessageVersion3 {
+		return 0, 0, fmt.Errorf("unexpected version %d when %d was expected", version, MessageVersion3)
+	}
 
-	binary.Read(b, binary.BigEndian, &version)
+	t = MessageType(header[1])
+	payloadSize = int(binary.BigEndian.Uint16(header[2:4]))
 
-	if version != MessageVersion3 {
-		err = fmt.Errorf("error when parsing header: unexpected version %d when %d was expected", version, MessageVersion3)
-		return
+	if payloadSize > c.maxMessageSize() {
+		return 0, 0, fmt.Errorf("payload size %d exceeds the maximum of %d", payloadSize, c.maxMessageSize())
 	}
 
-	var size uint16
+	return t, payloadSize, nil
+}
 
-	if err = binary.Read(b, binary.BigEndian, &t); err != nil {
-		err = fmt.Errorf("reading message type: %s", err)
-		return
-	}
+// ReadMessage reads one message's header and payload from r, using
+// io.ReadFull to consume exactly the declared payload size once it has
+// been checked against MaxMessageSize.
+func (c MessageCodec) ReadMessage(r io.Reader, tr Tracer) (t MessageType, msg deserializable, err error) {
+	var payloadSize int
 
-	if err = binary.Read(b, binary.BigEndian, &size); err != nil {
-		err = fmt.Errorf("reading payload size: %s", err)
-		return
+	if t, payloadSize, err = c.readHeader(r); err != nil {
+		return 0, nil, fmt.Errorf("parsing header: %s", err)
 	}
 
-	payloadSize = int(size)
-
-	return
-}
+	payload := make([]byte, payloadSize)
 
-func readMessage(b lenReader) (t MessageType, msg deserializable, err error) {
-	var payloadSize int
+	if _, err = io.ReadFull(r, payload); err != nil {
+		return 0, nil, fmt.Errorf("reading payload: %s", err)
+	}
 
-	if t, payloadSize, err = readHeader(b); err != nil {
-		err = fmt.Errorf("parsing header: %s", err)
-		return
-	} else if b.Len() < payloadSize {
-		err = fmt.Errorf("parsing body: buffer is supposed to be at least %d byte(s) long but is only %d", payloadSize, b.Len())
-		return
+	if msg, err = parseMessagePayload(t, bytes.NewReader(payload)); err != nil {
+		return 0, nil, err
 	}
 
-	if t&MessageTypeData == MessageTypeData {
+	traceOrDiscard(tr).OnMessageReceived(t, 4+payloadSize)
+
+	return t, msg, nil
+}
+
+// parseMessagePayload builds the deserializable matching t and
+// deserializes it from b, which holds exactly one message's payload.
+func parseMessagePayload(t MessageType, b lenReader) (msg deserializable, err error) {
+	// Wire types in [MessageTypeData, MessageTypeContactRequest) are DATA
+	// messages, with the channel folded into the low bits of the type
+	// byte; a bitmask test here would also catch 0xfd-0xff, since their high
+	// bits happen to overlap MessageTypeData's.
+	if t >= MessageTypeData && t < MessageTypeContactRequest {
 		msg = &messageData{
 			Channel: uint8(t - MessageTypeData),
 		}
@@ -157,21 +210,44 @@ func readMessage(b lenReader) (t MessageType, msg deserializable, err error) {
 			msg = &messageSessionRequest{}
 		case MessageTypeSession:
 			msg = &messageSession{}
+		case MessageTypeAlert:
+			msg = &messageAlert{}
 		case MessageTypeContactRequest, MessageTypeContact, MessageTypeKeepAlive:
 			msg = &messageData{
 				Channel: 0,
 			}
 		default:
-			err = fmt.Errorf("parsing body: unknown message type '%02x'", t)
-			return
+			return nil, fmt.Errorf("parsing body: unknown message type '%02x'", t)
 		}
 	}
 
 	if err = msg.deserialize(b); err != nil {
-		err = fmt.Errorf("failed to deserialize %s message: %s", t, err)
+		return nil, fmt.Errorf("failed to deserialize %s message: %s", t, err)
 	}
 
-	return
+	return msg, nil
+}
+
+// MessageFramer reads messages one at a time from a stream, such as a
+// future TCP transport, where - unlike the UDP datagrams Conn decodes
+// today - successive messages share one byte stream and aren't already
+// delivered as one read per message.
+type MessageFramer struct {
+	r      io.Reader
+	codec  MessageCodec
+	tracer Tracer
+}
+
+// NewMessageFramer returns a MessageFramer that reads consecutive
+// messages from r using codec, tracing each one via tr.
+func NewMessageFramer(r io.Reader, codec MessageCodec, tr Tracer) *MessageFramer {
+	return &MessageFramer{r: r, codec: codec, tracer: tr}
+}
+
+// ReadMessage reads the next message off the stream, blocking until a
+// full message has arrived.
+func (f *MessageFramer) ReadMessage() (MessageType, deserializable, error) {
+	return f.codec.ReadMessage(f.r, f.tracer)
 }
 
 type serializable interface {
@@ -210,27 +286,63 @@ func (m *messageHello) String() string {
 }
 
 // messagePresentation is a HELLO message.
+//
+// At most one of Certificate and CertificateV2 is set: they represent the two
+// certificate envelopes a peer may present, and are carried as two
+// independent length-prefixed blobs so that only one of them is ever
+// non-empty on the wire. The CertificateV2 blob is left out entirely when
+// CertificateV2 is nil, so such a presentation keeps the original
+// single-blob wire format.
 type messagePresentation struct {
-	Certificate *x509.Certificate
+	Certificate   *x509.Certificate
+	CertificateV2 *CertificateV2
 }
 
 func (m *messagePresentation) serialize(b io.Writer) error {
 	if m.Certificate == nil {
-		return binary.Write(b, binary.BigEndian, uint16(0))
+		if err := binary.Write(b, binary.BigEndian, uint16(0)); err != nil {
+			return err
+		}
+	} else {
+		binary.Write(b, binary.BigEndian, uint16(len(m.Certificate.Raw)))
+		b.Write(m.Certificate.Raw)
 	}
 
-	binary.Write(b, binary.BigEndian, uint16(len(m.Certificate.Raw)))
-	b.Write(m.Certificate.Raw)
+	if m.CertificateV2 == nil {
+		return nil
+	}
 
-	return nil
+	raw, err := m.CertificateV2.Marshal()
+
+	if err != nil {
+		return fmt.Errorf("marshaling v2 certificate: %s", err)
+	}
+
+	if err := binary.Write(b, binary.BigEndian, uint16(len(raw))); err != nil {
+		return err
+	}
+
+	_, err = b.Write(raw)
+
+	return err
 }
 
 func (m *messagePresentation) serializationSize() int {
-	if m.Certificate == nil {
-		return 2
+	size := 2
+
+	if m.Certificate != nil {
+		size += len(m.Certificate.Raw)
 	}
 
-	return 2 + len(m.Certificate.Raw)
+	if m.CertificateV2 != nil {
+		size += 2
+
+		if raw, err := m.CertificateV2.Marshal(); err == nil {
+			size += len(raw)
+		}
+	}
+
+	return size
 }
 
 func (m *messagePresentation) deserialize(b lenReader) (err error) {
@@ -256,17 +368,56 @@ func (m *messagePresentation) deserialize(b lenReader) (err error) {
 		}
 
 		m.Certificate, err = x509.ParseCertificate(der)
+
+		if err != nil {
+			return
+		}
+	}
+
+	// The CertificateV2 field was added after the initial wire format:
+	// peers that do not send it yet leave nothing to read here.
+	if b.Len() == 0 {
+		m.CertificateV2 = nil
+		return nil
+	}
+
+	if b.Len() < 2 {
+		return fmt.Errorf("buffer should be at least %d bytes long but is %d", 2, b.Len())
+	}
+
+	if err = binary.Read(b, binary.BigEndian, &size); err != nil {
+		return fmt.Errorf("reading v2 certificate size: %s", err)
 	}
 
+	if size == 0 {
+		m.CertificateV2 = nil
+		return nil
+	}
+
+	if b.Len() < int(size) {
+		return fmt.Errorf("buffer should be at least %d bytes long but is %d", size, b.Len())
+	}
+
+	raw := make([]byte, int(size))
+
+	if err = binary.Read(b, binary.BigEndian, raw); err != nil {
+		return
+	}
+
+	m.CertificateV2, err = ParseCertificateV2(raw)
+
 	return
 }
 
 func (m *messagePresentation) String() string {
-	if m.Certificate != nil {
+	switch {
+	case m.Certificate != nil:
 		return fmt.Sprintf("PRESENTATION [cert:%s]", m.Certificate.Subject)
+	case m.CertificateV2 != nil:
+		return fmt.Sprintf("PRESENTATION [cert-v2:%s]", m.CertificateV2.Subject)
+	default:
+		return fmt.Sprintf("PRESENTATION [cert:]")
 	}
-
-	return fmt.Sprintf("PRESENTATION [cert:]")
 }
 
 // SessionNumber represents a session number.
@@ -393,6 +544,10 @@ func (m *messageSessionRequest) deserialize(b lenReader) (err error) {
 		return fmt.Errorf("reading cipher suite size: %s", err)
 	}
 
+	if b.Len() < int(size) {
+		return fmt.Errorf("buffer should be at least %d bytes long but is %d", size, b.Len())
+	}
+
 	m.CipherSuites = make(CipherSuiteSlice, size)
 
 	for i := range m.CipherSuites {
@@ -405,6 +560,10 @@ func (m *messageSessionRequest) deserialize(b lenReader) (err error) {
 		return fmt.Errorf("reading elliptic curves size: %s", err)
 	}
 
+	if b.Len() < int(size) {
+		return fmt.Errorf("buffer should be at least %d bytes long but is %d", size, b.Len())
+	}
+
 	m.EllipticCurves = make(EllipticCurveSlice, size)
 
 	for i := range m.EllipticCurves {
@@ -420,6 +579,10 @@ func (m *messageSessionRequest) deserialize(b lenReader) (err error) {
 	if size == 0 {
 		m.Signature = nil
 	} else {
+		if b.Len() < int(size) {
+			return fmt.Errorf("buffer should be at least %d bytes long but is %d", size, b.Len())
+		}
+
 		m.Signature = make([]byte, size)
 		if err = binary.Read(b, binary.BigEndian, m.Signature); err != nil {
 			return fmt.Errorf("reading signature: %s", err)
@@ -561,6 +724,10 @@ func (m *messageSession) deserialize(b lenReader) (err error) {
 		return fmt.Errorf("reading public key size: %s", err)
 	}
 
+	if b.Len() < int(size) {
+		return fmt.Errorf("buffer should be at least %d bytes long but is %d", size, b.Len())
+	}
+
 	m.PublicKey = make([]byte, size)
 
 	if err = binary.Read(b, binary.BigEndian, m.PublicKey); err != nil {
@@ -571,6 +738,10 @@ func (m *messageSession) deserialize(b lenReader) (err error) {
 		return fmt.Errorf("reading signature size: %s", err)
 	}
 
+	if b.Len() < int(size) {
+		return fmt.Errorf("buffer should be at least %d bytes long but is %d", size, b.Len())
+	}
+
 	m.Signature = make([]byte, size)
 
 	if err = binary.Read(b, binary.BigEndian, m.Signature); err != nil {
@@ -584,13 +755,62 @@ func (m *messageSession) String() string {
 	return fmt.Sprintf("SESSION [sid:%08x,hid:%08x,cipher:%s,curve:%s]", m.SessionNumber, m.HostIdentifier, m.CipherSuite, m.EllipticCurve)
 }
 
+// messageAlert is an ALERT message, signaling a handshake failure or a
+// graceful close, mirroring TLS's alert subprotocol.
+type messageAlert struct {
+	Level       AlertLevel
+	Description AlertDescription
+}
+
+func (m *messageAlert) serialize(b io.Writer) (err error) {
+	if err = binary.Write(b, binary.BigEndian, m.Level); err != nil {
+		return fmt.Errorf("writing alert level: %s", err)
+	}
+
+	if err = binary.Write(b, binary.BigEndian, m.Description); err != nil {
+		return fmt.Errorf("writing alert description: %s", err)
+	}
+
+	return nil
+}
+
+func (m *messageAlert) serializationSize() int { return 2 }
+
+func (m *messageAlert) deserialize(b lenReader) (err error) {
+	if b.Len() != 2 {
+		return fmt.Errorf("buffer should be %d bytes long but is %d", 2, b.Len())
+	}
+
+	if err = binary.Read(b, binary.BigEndian, &m.Level); err != nil {
+		return fmt.Errorf("reading alert level: %s", err)
+	}
+
+	if err = binary.Read(b, binary.BigEndian, &m.Description); err != nil {
+		return fmt.Errorf("reading alert description: %s", err)
+	}
+
+	return nil
+}
+
+func (m *messageAlert) String() string {
+	return fmt.Sprintf("ALERT [level:%s,desc:%s]", m.Level, m.Description)
+}
+
 // A SequenceNumber is a 4 bytes sequence number.
 type SequenceNumber uint32
 
+// dataMessageTagLen is the length, in bytes, of the GCMTag field the
+// wire format always reserves for a DATA message, regardless of the
+// session's negotiated CipherSuite. Every CipherSuiteImpl registered so
+// far reports a TagLen of 16 for this reason; a suite with a different
+// TagLen would need its own wire-format revision, since, unlike
+// Ciphertext, GCMTag has no length prefix of its own.
+const dataMessageTagLen = 16
+
 type messageData struct {
 	Channel        uint8
 	SequenceNumber SequenceNumber
-	GCMTag         [16]byte
+	GCMTag         []byte
 	Ciphertext     []byte
 }
 
@@ -615,19 +835,21 @@ func (m *messageData) serialize(b io.Writer) (err error) {
 }
 
 func (m *messageData) serializationSize() int {
-	return 4 + 16 + 2 + len(m.Ciphertext)
+	return 4 + dataMessageTagLen + 2 + len(m.Ciphertext)
 }
 
 func (m *messageData) deserialize(b lenReader) (err error) {
-	if b.Len() < 22 {
-		return fmt.Errorf("buffer should be at least %d bytes long but is %d", 22, b.Len())
+	if b.Len() < 4+dataMessageTagLen+2 {
+		return fmt.Errorf("buffer should be at least %d bytes long but is %d", 4+dataMessageTagLen+2, b.Len())
 	}
 
 	if err = binary.Read(b, binary.BigEndian, &m.SequenceNumber); err != nil {
 		return fmt.Errorf("reading sequence number: %s", err)
 	}
 
-	if err = binary.Read(b, binary.BigEndian, &m.GCMTag); err != nil {
+	m.GCMTag = make([]byte, dataMessageTagLen)
+
+	if err = binary.Read(b, binary.BigEndian, m.GCMTag); err != nil {
 		return fmt.Errorf("reading GCM tag: %s", err)
 	}
 
@@ -637,6 +859,10 @@ func (m *messageData) deserialize(b lenReader) (err error) {
 		return fmt.Errorf("reading ciphertext size: %s", err)
 	}
 
+	if b.Len() < int(size) {
+		return fmt.Errorf("buffer should be at least %d bytes long but is %d", size, b.Len())
+	}
+
 	m.Ciphertext = make([]byte, size)
 
 	if err = binary.Read(b, binary.BigEndian, m.Ciphertext); err != nil {
@@ -14,6 +14,213 @@ import (
 	"testing"
 )
 
+// FuzzMessageHelloDeserialize checks that messageHello.deserialize never
+// panics, mirroring FuzzMessageAlertDeserialize in alert_test.go.
+func FuzzMessageHelloDeserialize(f *testing.F) {
+	f.Add([]byte{0x12, 0x34, 0x56, 0x78})
+	f.Add([]byte{})
+	f.Add([]byte{0x00, 0x00, 0x00})
+	f.Add([]byte{0x00, 0x00, 0x00, 0x00, 0x00})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		msg := &messageHello{}
+
+		_ = msg.deserialize(bytes.NewReader(data))
+	})
+}
+
+// FuzzMessagePresentationDeserialize checks that
+// messagePresentation.deserialize never panics, however its declared
+// certificate/certificate-v2 sizes disagree with the amount of data
+// actually remaining in the buffer.
+func FuzzMessagePresentationDeserialize(f *testing.F) {
+	f.Add([]byte{0x00, 0x00, 0x00, 0x00})
+	f.Add(append([]byte{0x05, 0xd4}, CertificateAlice.Raw...))
+	f.Add([]byte{0xff, 0xff})
+	f.Add([]byte{0x00, 0x02, 0xaa})
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		msg := &messagePresentation{}
+
+		_ = msg.deserialize(bytes.NewReader(data))
+	})
+}
+
+// FuzzMessageSessionRequestDeserialize checks that
+// messageSessionRequest.deserialize never panics, in particular when its
+// declared CipherSuites/EllipticCurves/Signature sizes exceed what is
+// actually left in the buffer.
+func FuzzMessageSessionRequestDeserialize(f *testing.F) {
+	f.Add([]byte{
+		0x22, 0x44, 0x66, 0x88,
+		0x01, 0x02, 0x03, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x02, 0x01, 0x02, 0x00, 0x03, 0x01, 0x02, 0x03,
+		0x00, 0x02, 0xaa, 0xbb,
+	})
+	f.Add([]byte{
+		0x22, 0x44, 0x66, 0x88,
+		0x01, 0x02, 0x03, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0xff, 0xff, 0x01, 0x02, 0xff, 0xff, 0x01, 0x02, 0x03,
+		0xff, 0xff,
+	})
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		msg := &messageSessionRequest{}
+
+		_ = msg.deserialize(bytes.NewReader(data))
+	})
+}
+
+// FuzzMessageSessionDeserialize checks that messageSession.deserialize
+// never panics, in particular when its declared PublicKey/Signature sizes
+// exceed what is actually left in the buffer.
+func FuzzMessageSessionDeserialize(f *testing.F) {
+	f.Add(append(
+		append(
+			[]byte{
+				0x22, 0x44, 0x66, 0x88,
+				0x01, 0x02, 0x03, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0x01, 0x02, 0x00, 0x00,
+				0x00, byte(len(SomePEMPublicKey)),
+			},
+			SomePEMPublicKey...,
+		),
+		[]byte{0x00, 0x02, 0xaa, 0xbb}...,
+	))
+	f.Add([]byte{
+		0x22, 0x44, 0x66, 0x88,
+		0x01, 0x02, 0x03, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x01, 0x02, 0x00, 0x00,
+		0xff, 0xff, 0xff, 0xff,
+	})
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		msg := &messageSession{}
+
+		_ = msg.deserialize(bytes.NewReader(data))
+	})
+}
+
+// FuzzMessageDataDeserialize checks that messageData.deserialize never
+// panics, in particular when its declared Ciphertext size exceeds what is
+// actually left in the buffer.
+func FuzzMessageDataDeserialize(f *testing.F) {
+	f.Add([]byte{
+		0x22, 0x44, 0x66, 0x88,
+		0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08,
+		0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08,
+		0x00, 0x02, 0xaa, 0xbb,
+	})
+	f.Add([]byte{
+		0x22, 0x44, 0x66, 0x88,
+		0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08,
+		0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08,
+		0xff, 0xff,
+	})
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		msg := &messageData{}
+
+		_ = msg.deserialize(bytes.NewReader(data))
+	})
+}
+
+// FuzzReadMessage checks that MessageCodec.ReadMessage never panics,
+// regardless of the header and payload bytes it is given. Its seeds are a
+// few of the wire-format vectors TestSerialization checks, plus malformed
+// headers.
+func FuzzReadMessage(f *testing.F) {
+	f.Add([]byte{0x03, 0x00, 0x00, 0x04, 0x12, 0x34, 0x56, 0x78})
+	f.Add([]byte{0x03, 0x02, 0x00, 0x02, 0x00, 0x00})
+	f.Add([]byte{0x03, 0x05, 0x00, 0x02, 0x02, 0x03})
+	f.Add([]byte{0x03, 0xfd, 0x00, 0x00})
+	f.Add([]byte{0x03, 0xff, 0x00, 0x00})
+	f.Add([]byte{0x05, 0xff, 0xff, 0xff, 0xff})
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		codec := MessageCodec{}
+
+		_, _, _ = codec.ReadMessage(bytes.NewReader(data), discardTracer{})
+	})
+}
+
+// FuzzRoundTripMessage checks that every message ReadMessage manages to
+// decode survives a re-serialize/re-decode round-trip unchanged: writing
+// it back out and reading it again must produce a message deep-equal to
+// the first one, for every message type. Inputs ReadMessage rejects are
+// skipped, since there is nothing to round-trip.
+func FuzzRoundTripMessage(f *testing.F) {
+	f.Add([]byte{0x03, 0x00, 0x00, 0x04, 0x12, 0x34, 0x56, 0x78})
+	f.Add([]byte{0x03, 0x02, 0x00, 0x02, 0x00, 0x00})
+	f.Add([]byte{0x03, 0x05, 0x00, 0x02, 0x02, 0x03})
+	f.Add([]byte{0x03, 0x72, 0x00, 0x18,
+		0x22, 0x44, 0x66, 0x88,
+		0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08,
+		0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08,
+		0x00, 0x02, 0xaa, 0xbb,
+	})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		codec := MessageCodec{}
+
+		mt, msg, err := codec.ReadMessage(bytes.NewReader(data), discardTracer{})
+
+		if err != nil {
+			return
+		}
+
+		sm, ok := msg.(serializable)
+
+		if !ok {
+			t.Fatalf("%T does not implement serializable", msg)
+		}
+
+		var buf bytes.Buffer
+
+		if err := codec.WriteMessage(&buf, mt, sm, discardTracer{}); err != nil {
+			t.Fatalf("re-serializing a successfully decoded %s message: %s", mt, err)
+		}
+
+		_, msg2, err := codec.ReadMessage(bytes.NewReader(buf.Bytes()), discardTracer{})
+
+		if err != nil {
+			t.Fatalf("re-decoding a re-serialized %s message: %s", mt, err)
+		}
+
+		if !reflect.DeepEqual(msg, msg2) {
+			t.Fatalf("round-trip mismatch for a %s message:\n- %v\n+ %v", mt, msg, msg2)
+		}
+	})
+}
+
+// recordingTracer remembers the arguments of the last OnMessageSent/
+// OnMessageReceived call, so tests can assert that writeMessage/readMessage
+// actually fire the hooks.
+type recordingTracer struct {
+	discardTracer
+	sentType     MessageType
+	sentSize     int
+	receivedType MessageType
+	receivedSize int
+}
+
+func (t *recordingTracer) OnMessageSent(mt MessageType, size int) {
+	t.sentType, t.sentSize = mt, size
+}
+
+func (t *recordingTracer) OnMessageReceived(mt MessageType, size int) {
+	t.receivedType, t.receivedSize = mt, size
+}
+
 func mustReadCertificateFile(path string) (cert *x509.Certificate) {
 	b, err := ioutil.ReadFile(path)
 
@@ -182,7 +389,7 @@ func TestSerialization(t *testing.T) {
 				HostIdentifier: SomeHostIdentifier,
 				CipherSuite:    ECDHERSAAES128GCMSHA256,
 				EllipticCurve:  SECP384R1,
-				PublicKey:      SomePublicKey,
+				PublicKey:      SomePEMPublicKey,
 				Signature:      []byte{0xaa, 0xbb},
 			},
 			MessageType: MessageTypeSession,
@@ -205,6 +412,18 @@ func TestSerialization(t *testing.T) {
 			),
 			ExpectedString: "SESSION [sid:22446688,hid:0102030400000000000000000000000000000000000000000000000000000000,cipher:ECDHERSAAES128GCMSHA256,curve:SECP384R1]",
 		},
+		{
+			Message: &messageAlert{
+				Level:       AlertLevelFatal,
+				Description: AlertHandshakeFailure,
+			},
+			MessageType: MessageTypeAlert,
+			Expected: []byte{
+				0x03, 0x05, 0x00, 0x02,
+				0x02, 0x03,
+			},
+			ExpectedString: "ALERT [level:fatal,desc:handshake_failure]",
+		},
 		{
 			Message: &messageData{
 				Channel:        0x02,
@@ -230,19 +449,26 @@ func TestSerialization(t *testing.T) {
 	for _, testCase := range testCases {
 		t.Run(fmt.Sprintf("%s", testCase.MessageType), func(t *testing.T) {
 			buf := &bytes.Buffer{}
+			sendTracer := &recordingTracer{}
+			codec := MessageCodec{}
 
 			if msg, _ := testCase.Message.(*messageData); msg != nil {
-				writeDataMessage(buf, msg)
+				codec.WriteDataMessage(buf, msg, sendTracer)
 			} else {
-				writeMessage(buf, testCase.MessageType, testCase.Message)
+				codec.WriteMessage(buf, testCase.MessageType, testCase.Message, sendTracer)
 			}
 
 			if bytes.Compare(buf.Bytes(), testCase.Expected) != 0 {
 				t.Errorf("\n- %v\n+ %v", hex.EncodeToString(testCase.Expected), hex.EncodeToString(buf.Bytes()))
 			}
 
+			if sendTracer.sentSize != len(testCase.Expected) {
+				t.Errorf("OnMessageSent: expected size `%v`, got: `%v`", len(testCase.Expected), sendTracer.sentSize)
+			}
+
 			r := bytes.NewReader(buf.Bytes())
-			mt, msg, err := readMessage(r)
+			receiveTracer := &recordingTracer{}
+			mt, msg, err := codec.ReadMessage(r, receiveTracer)
 
 			if err != nil {
 				t.Fatalf("expected no error but got: %s", err)
@@ -260,6 +486,18 @@ func TestSerialization(t *testing.T) {
 				}
 			}
 
+			if sendTracer.sentType != mt {
+				t.Errorf("OnMessageSent: expected type `%v`, got: `%v`", mt, sendTracer.sentType)
+			}
+
+			if receiveTracer.receivedType != mt {
+				t.Errorf("OnMessageReceived: expected type `%v`, got: `%v`", mt, receiveTracer.receivedType)
+			}
+
+			if receiveTracer.receivedSize != len(testCase.Expected) {
+				t.Errorf("OnMessageReceived: expected size `%v`, got: `%v`", len(testCase.Expected), receiveTracer.receivedSize)
+			}
+
 			if !reflect.DeepEqual(msg, testCase.Message) {
 				t.Errorf("\n- %v\n+ %v", testCase.Message, msg)
 			}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"syscall"
 	"time"
 )
 
@@ -77,7 +78,7 @@ func ListenFSCP(network string, addr *Addr) (*Client, error) {
 				return nil, err
 			}
 
-			return NewClient(conn)
+			return NewClient(NewUDPTransport(conn), nil, nil)
 		default:
 			return nil, &net.OpError{Op: "listen", Net: network, Addr: addr, Err: fmt.Errorf("unsupported transport address for FSCP: %#v", addr)}
 		}
@@ -89,6 +90,31 @@ func ListenFSCP(network string, addr *Addr) (*Client, error) {
 // A Dialer offers connection dialing primitives.
 type Dialer struct {
 	Timeout time.Duration
+
+	// CalculatedRemotes, if set, lets DialOverlay synthesize candidate
+	// transport addresses for a peer from its overlay IP address instead of
+	// requiring a pre-known transport address for it.
+	CalculatedRemotes []CalculatedRemote
+
+	// Prefer controls which address family is tried first when dialing a
+	// hostname that resolves to both IPv4 and IPv6 addresses. It defaults to
+	// DualStack.
+	Prefer Preference
+
+	// FallbackDelay is the time to wait before racing the next candidate
+	// address, RFC 8305-style ("Happy Eyeballs"). It defaults to
+	// DefaultFallbackDelay.
+	FallbackDelay time.Duration
+
+	// LocalAddr, if set, is the local address used when dialing, in place
+	// of DefaultAddr.
+	LocalAddr *Addr
+
+	// Control, if set, is called after creating the underlying UDP socket
+	// but before binding it, the same way net.Dialer.Control does. It can be
+	// used to set socket options such as SO_MARK or to bind to a specific
+	// interface.
+	Control func(network, address string, c syscall.RawConn) error
 }
 
 // DefaultTimeout is the default time to wait for dialing connections.
@@ -106,50 +132,68 @@ func (d Dialer) getTimeout() time.Duration {
 }
 
 // Dial dials a new connection.
+//
+// When addr is a hostname that resolves to several addresses, all of them
+// are tried per d.Prefer and d.FallbackDelay.
 func (d *Dialer) Dial(network, addr string) (net.Conn, error) {
 	switch network {
 	case Network:
-		addr, err := ResolveFSCPAddr(network, addr)
+		raddrs, err := ResolveFSCPAddrs(network, addr)
 
 		if err != nil {
 			return nil, &net.OpError{Op: "dial", Net: network, Err: err}
 		}
 
-		return d.DialFSCP(network, nil, addr)
+		return d.DialFSCP(network, nil, raddrs...)
 	default:
 		return net.Dial(network, addr)
 	}
 }
 
 // DialFSCP dials a new FSCP connection.
-func (d *Dialer) DialFSCP(network string, laddr *Addr, raddr *Addr) (*Conn, error) {
+//
+// When more than one raddr is given, they are ordered per d.Prefer and
+// raced with a d.FallbackDelay stagger, RFC 8305-style ("Happy Eyeballs"):
+// the first one to complete its handshake wins.
+func (d *Dialer) DialFSCP(network string, laddr *Addr, raddrs ...*Addr) (*Conn, error) {
 	switch network {
 	case Network:
-		if laddr == nil {
-			laddr = DefaultAddr
+		if len(raddrs) == 0 {
+			return nil, &net.OpError{Op: "dial", Net: network, Err: fmt.Errorf("no candidate address to dial")}
 		}
 
-		client, err := ListenFSCP(network, laddr)
+		raddrs = d.Prefer.order(raddrs)
 
-		if err != nil {
-			return nil, err
+		if len(raddrs) == 1 {
+			return d.dialOne(network, laddr, raddrs[0])
 		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), d.getTimeout())
-		defer cancel()
-
-		return client.Connect(ctx, raddr)
+		return d.raceDial(network, laddr, raddrs)
 	default:
-		return nil, &net.OpError{Op: "dial", Net: network, Addr: raddr, Err: fmt.Errorf("unsupported network: %s", network)}
+		return nil, &net.OpError{Op: "dial", Net: network, Err: fmt.Errorf("unsupported network: %s", network)}
 	}
 }
 
+// dialOne dials a single candidate address.
+func (d *Dialer) dialOne(network string, laddr *Addr, raddr *Addr) (*Conn, error) {
+	client, err := d.listen(network, laddr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), d.getTimeout())
+	defer cancel()
+
+	return client.DialContext(ctx, raddr)
+}
+
 // Dial dials a new FSCP connection using the default Dialer.
 func Dial(network, addr string) (net.Conn, error) {
 	return DefaultDialer.Dial(network, addr)
 }
 
-// DialFSCP dials a new FSCP connection.
-func DialFSCP(network string, laddr *Addr, raddr *Addr) (*Conn, error) {
-	return DefaultDialer.DialFSCP(network, laddr, raddr)
+// DialFSCP dials a new FSCP connection using the default Dialer.
+func DialFSCP(network string, laddr *Addr, raddrs ...*Addr) (*Conn, error) {
+	return DefaultDialer.DialFSCP(network, laddr, raddrs...)
 }
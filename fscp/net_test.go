@@ -10,13 +10,29 @@ func TestConnection(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 	defer cancel()
 
-	server, err := Listen(Network, ":5000")
+	network := NewInMemoryNetwork()
+
+	serverTransport, err := network.Listen("server")
+
+	if err != nil {
+		t.Fatalf("expected no error: %s", err)
+	}
+
+	clientTransport, err := network.Listen("client")
+
+	if err != nil {
+		serverTransport.Close()
+		t.Fatalf("expected no error: %s", err)
+	}
+
+	server, err := NewClient(serverTransport, nil, nil)
 
 	if err != nil {
+		clientTransport.Close()
 		t.Fatalf("expected no error: %s", err)
 	}
 
-	client, err := Listen(Network, ":5001")
+	client, err := NewClient(clientTransport, nil, nil)
 
 	if err != nil {
 		server.Close()
@@ -33,13 +49,9 @@ func TestConnection(t *testing.T) {
 	}()
 
 	go func() {
-		addr, err := ResolveFSCPAddr(Network, "localhost:5000")
-
-		if err != nil {
-			t.Fatalf("expected no error: %s", err)
-		}
+		addr := serverTransport.LocalAddr()
 
-		clientConn, err := client.(*Client).Connect(ctx, addr)
+		clientConn, err := client.DialContext(ctx, addr)
 
 		if err != nil {
 			t.Fatalf("client connecting to %s: %s", addr, err)
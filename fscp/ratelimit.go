@@ -0,0 +1,89 @@
+package fscp
+
+import (
+	"sync"
+	"time"
+)
+
+// tokenBucket is a classic token-bucket rate limiter: it holds up to
+// capacity tokens, refilled at rate tokens per second, and Allow reports
+// whether a token was available to spend.
+type tokenBucket struct {
+	mu       sync.Mutex
+	capacity float64
+	rate     float64
+	tokens   float64
+	last     time.Time
+}
+
+func newTokenBucket(capacity float64, rate float64) *tokenBucket {
+	return &tokenBucket{
+		capacity: capacity,
+		rate:     rate,
+		tokens:   capacity,
+		last:     time.Now(),
+	}
+}
+
+// Allow spends one token if one is available and reports whether it did.
+func (b *tokenBucket) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+
+	return true
+}
+
+// peerLimiter hands out a per-peer tokenBucket, creating it lazily on first
+// use so peers that never send anything never cost any memory.
+type peerLimiter struct {
+	burst     float64
+	perSecond float64
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+}
+
+func newPeerLimiter(burst int, perSecond float64) *peerLimiter {
+	return &peerLimiter{
+		burst:     float64(burst),
+		perSecond: perSecond,
+		buckets:   map[string]*tokenBucket{},
+	}
+}
+
+// Allow reports whether a frame from the peer identified by key may
+// proceed, consuming one of that peer's tokens if so.
+func (l *peerLimiter) Allow(key string) bool {
+	l.mu.Lock()
+	bucket, ok := l.buckets[key]
+
+	if !ok {
+		bucket = newTokenBucket(l.burst, l.perSecond)
+		l.buckets[key] = bucket
+	}
+	l.mu.Unlock()
+
+	return bucket.Allow()
+}
+
+// forget discards the bucket tracked for key, so it no longer counts
+// towards the limiter's memory use once the peer's connection is gone.
+func (l *peerLimiter) forget(key string) {
+	l.mu.Lock()
+	delete(l.buckets, key)
+	l.mu.Unlock()
+}
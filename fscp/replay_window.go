@@ -0,0 +1,94 @@
+package fscp
+
+import "fmt"
+
+// ReplayWindow implements a sliding-window replay detector à la IPsec/ESP
+// (RFC 6479): sequence numbers within Size of the highest one committed so
+// far are accepted at most once; anything older is rejected. Session uses
+// one to guard its DATA channel, but the type carries no session state of
+// its own, so it is just as usable to guard a channel multiplexed over
+// Conn.Channel independently of the session's own sequence space.
+//
+// The zero value is ready to use and accepts the first sequence number it
+// is asked to Commit as its initial ceiling.
+type ReplayWindow struct {
+	// Size is the width, in sequence numbers, of the window. It is
+	// clamped to the [1, 64] range the seen bitmap can represent; zero
+	// means DefaultWindowSize.
+	Size SequenceNumber
+
+	ceiling     SequenceNumber
+	seen        uint64
+	initialized bool
+}
+
+// Check reports whether seq falls within the window and has not already
+// been committed, without modifying the window.
+//
+// Callers should verify a message's authenticity (e.g. its AEAD tag)
+// before calling Check, and call Commit only once that verification also
+// passes; otherwise a forged sequence number could be used to probe which
+// ones have already been seen.
+func (w *ReplayWindow) Check(seq SequenceNumber) error {
+	if !w.initialized {
+		return nil
+	}
+
+	switch {
+	case seq > w.ceiling:
+		return nil
+	case w.ceiling-seq >= w.size():
+		return fmt.Errorf("%w: %d is outside the replay window (ceiling %d)", ErrOutdatedMessage, seq, w.ceiling)
+	default:
+		if w.seen&(uint64(1)<<(w.ceiling-seq)) != 0 {
+			return fmt.Errorf("%w: sequence number %d was already seen", ErrReplayedMessage, seq)
+		}
+	}
+
+	return nil
+}
+
+// Commit records seq as accepted, sliding the window forward if seq is a
+// new ceiling. It assumes Check(seq) was just called and returned no
+// error.
+func (w *ReplayWindow) Commit(seq SequenceNumber) {
+	if !w.initialized {
+		w.initialized = true
+		w.ceiling = seq
+		w.seen = 1
+
+		return
+	}
+
+	if seq > w.ceiling {
+		shift := seq - w.ceiling
+
+		if shift >= 64 {
+			w.seen = 0
+		} else {
+			w.seen <<= shift
+		}
+
+		w.seen |= 1
+		w.ceiling = seq
+
+		return
+	}
+
+	w.seen |= uint64(1) << (w.ceiling - seq)
+}
+
+// Ceiling returns the highest sequence number Commit has recorded so far.
+func (w *ReplayWindow) Ceiling() SequenceNumber {
+	return w.ceiling
+}
+
+// size returns w.Size, clamped to the [1, 64] range the seen bitmap can
+// represent.
+func (w *ReplayWindow) size() SequenceNumber {
+	if w.Size <= 0 || w.Size > 64 {
+		return DefaultWindowSize
+	}
+
+	return w.Size
+}
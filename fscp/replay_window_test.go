@@ -0,0 +1,77 @@
+package fscp
+
+import (
+	"errors"
+	"testing"
+)
+
+func acceptReplay(t *testing.T, w *ReplayWindow, seq SequenceNumber) {
+	t.Helper()
+
+	if err := w.Check(seq); err != nil {
+		t.Fatalf("expected %d to be accepted but got: %s", seq, err)
+	}
+
+	w.Commit(seq)
+}
+
+func TestReplayWindowInOrder(t *testing.T) {
+	w := &ReplayWindow{}
+
+	for seq := SequenceNumber(0); seq < 10; seq++ {
+		acceptReplay(t, w, seq)
+	}
+
+	if w.Ceiling() != 9 {
+		t.Errorf("expected a ceiling of 9 but got %d", w.Ceiling())
+	}
+}
+
+func TestReplayWindowRejectsReplay(t *testing.T) {
+	w := &ReplayWindow{}
+
+	acceptReplay(t, w, 5)
+
+	if err := w.Check(5); !errors.Is(err, ErrReplayedMessage) {
+		t.Errorf("expected ErrReplayedMessage but got: %v", err)
+	}
+}
+
+func TestReplayWindowAcceptsOutOfOrderWithinWindow(t *testing.T) {
+	w := &ReplayWindow{}
+
+	acceptReplay(t, w, 10)
+	acceptReplay(t, w, 8)
+
+	if err := w.Check(8); !errors.Is(err, ErrReplayedMessage) {
+		t.Errorf("expected ErrReplayedMessage but got: %v", err)
+	}
+
+	if w.Ceiling() != 10 {
+		t.Errorf("expected the ceiling to stay at 10 but got %d", w.Ceiling())
+	}
+}
+
+func TestReplayWindowRejectsOutdated(t *testing.T) {
+	w := &ReplayWindow{Size: 4}
+
+	acceptReplay(t, w, 100)
+
+	if err := w.Check(95); !errors.Is(err, ErrOutdatedMessage) {
+		t.Errorf("expected ErrOutdatedMessage but got: %v", err)
+	}
+}
+
+func TestReplayWindowSlidesForward(t *testing.T) {
+	w := &ReplayWindow{Size: 4}
+
+	acceptReplay(t, w, 0)
+	acceptReplay(t, w, 10)
+
+	// 0 is now well outside the 4-wide window anchored at 10.
+	if err := w.Check(0); !errors.Is(err, ErrOutdatedMessage) {
+		t.Errorf("expected ErrOutdatedMessage but got: %v", err)
+	}
+
+	acceptReplay(t, w, 9)
+}
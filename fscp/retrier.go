@@ -1,51 +1,55 @@
 package fscp
 
 import (
+	"math"
+	"math/rand"
 	"sync"
 	"time"
 )
 
-// A Retrier retries a given operation until it is satisfied.
+// A Retrier runs Operation on a timer until Stop is called or it gives up.
+// A successful attempt does not stop it: it only resets the attempt count
+// (see Reset).
+//
+// It gives up when MaxAttempts is reached or ShouldRetry rejects the
+// most recent error, whichever happens first; OnFailure is then called
+// with that error and the Retrier stops itself. With MaxAttempts and
+// ShouldRetry both left nil, a Retrier never gives up on its own and
+// retries indefinitely, which is almost always what a network operation
+// like a HELLO/PRESENTATION retransmit wants.
 type Retrier struct {
 	Operation func() error
 	OnFailure func(error)
-	Period    time.Duration
-	once      sync.Once
-	closed    chan struct{}
-}
 
-// Start the retrier.
-func (r *Retrier) Start() {
-	r.closed = make(chan struct{})
+	// Period is the fixed interval between attempts when Backoff is
+	// nil. Kept for Retriers configured before Backoff existed.
+	Period time.Duration
 
-	if err := r.Operation(); err != nil {
-		r.OnFailure(err)
-		return
-	}
+	// Backoff computes the delay before each retry following a failed
+	// attempt. If nil, every attempt waits Period.
+	Backoff Backoff
 
-	timer := time.NewTimer(r.Period)
+	// MaxAttempts caps the number of attempts the Retrier makes
+	// (including the first) before giving up. Zero means unlimited.
+	MaxAttempts int
 
-	go func() {
-		defer timer.Stop()
+	// ShouldRetry reports whether a failed attempt is worth retrying.
+	// If nil, every error is retried, subject to MaxAttempts. Returning
+	// false gives up immediately, as if MaxAttempts had just been
+	// reached.
+	ShouldRetry func(err error) bool
 
-		for {
-			select {
-			case <-r.closed:
-				if !timer.Stop() {
-					<-timer.C
-					return
-				}
-			case <-timer.C:
-				if err := r.Operation(); err != nil {
-					r.OnFailure(err)
-					r.Stop()
-					continue
-				}
+	once    sync.Once
+	closed  chan struct{}
+	attempt int
+}
 
-				timer.Reset(r.Period)
-			}
-		}
-	}()
+// Start the retrier.
+func (r *Retrier) Start() {
+	r.closed = make(chan struct{})
+	r.attempt = 0
+
+	go r.run()
 }
 
 // Stop the retrier.
@@ -59,3 +63,190 @@ func (r *Retrier) Stop() bool {
 
 	return closed
 }
+
+// Reset clears the attempt count a Backoff or MaxAttempts would
+// otherwise keep accumulating, as though the Retrier had just been
+// started. The Retrier calls it itself whenever Operation succeeds, so a
+// later, unrelated failure starts its own backoff and attempt budget
+// from scratch rather than inheriting an earlier streak's.
+//
+// Reset is not safe to call from any goroutine other than the one
+// running Operation (e.g. from within Operation itself, before it
+// returns); calling it from elsewhere races with the Retrier's own
+// bookkeeping.
+func (r *Retrier) Reset() {
+	r.attempt = 0
+
+	if jitter, ok := r.Backoff.(*DecorrelatedJitterBackoff); ok {
+		jitter.reset()
+	}
+}
+
+// run drives the attempt loop: an immediate first attempt, then one
+// attempt per timer tick, until the Retrier gives up or Stop is called.
+func (r *Retrier) run() {
+	err, done := r.step()
+
+	if done {
+		return
+	}
+
+	timer := time.NewTimer(r.nextDelay(err))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-r.closed:
+			// Whether the timer had already fired or not, we're done
+			// either way: draining a pending tick (if any) just avoids
+			// leaking it, it is never a reason to keep looping.
+			if !timer.Stop() {
+				<-timer.C
+			}
+
+			return
+		case <-timer.C:
+			err, done = r.step()
+
+			if done {
+				return
+			}
+
+			timer.Reset(r.nextDelay(err))
+		}
+	}
+}
+
+// step runs a single attempt of Operation, returning the error it
+// produced (nil on success) and whether the Retrier should stop
+// altogether.
+func (r *Retrier) step() (error, bool) {
+	r.attempt++
+
+	if err := r.Operation(); err != nil {
+		if r.giveUp(err) {
+			r.OnFailure(err)
+			r.Stop()
+			return err, true
+		}
+
+		return err, false
+	}
+
+	r.Reset()
+
+	return nil, false
+}
+
+// giveUp reports whether err, the error the latest attempt just
+// produced, should end the Retrier rather than schedule another one.
+func (r *Retrier) giveUp(err error) bool {
+	if r.MaxAttempts > 0 && r.attempt >= r.MaxAttempts {
+		return true
+	}
+
+	return r.ShouldRetry != nil && !r.ShouldRetry(err)
+}
+
+// nextDelay returns how long to wait before the next attempt, given err,
+// the error the previous one produced (nil if there hasn't been one
+// yet).
+func (r *Retrier) nextDelay(err error) time.Duration {
+	if r.Backoff != nil {
+		return r.Backoff.Next(r.attempt, err)
+	}
+
+	return r.Period
+}
+
+// A Backoff computes how long a Retrier should wait before its next
+// attempt.
+type Backoff interface {
+	// Next returns the delay before attempt (1-based: the attempt that
+	// just ran), given lastErr, the error it returned.
+	Next(attempt int, lastErr error) time.Duration
+}
+
+// ConstantBackoff waits the same Period before every attempt, matching a
+// Retrier with no Backoff set.
+type ConstantBackoff struct {
+	Period time.Duration
+}
+
+// Next implements Backoff.
+func (b ConstantBackoff) Next(attempt int, lastErr error) time.Duration {
+	return b.Period
+}
+
+// ExponentialBackoff waits Initial * Multiplier^(attempt-1) before each
+// attempt, capped at Max.
+type ExponentialBackoff struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+}
+
+// Next implements Backoff.
+func (b ExponentialBackoff) Next(attempt int, lastErr error) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	d := float64(b.Initial) * math.Pow(b.Multiplier, float64(attempt-1))
+
+	if b.Max > 0 && d > float64(b.Max) {
+		return b.Max
+	}
+
+	return time.Duration(d)
+}
+
+// DecorrelatedJitterBackoff implements AWS's "decorrelated jitter"
+// strategy: each delay is drawn uniformly from [Base, previous delay *
+// 3], capped at Cap. It needs the previous delay to compute the next
+// one, so, unlike ConstantBackoff and ExponentialBackoff, a
+// DecorrelatedJitterBackoff must not be shared between Retriers running
+// concurrently.
+type DecorrelatedJitterBackoff struct {
+	Base time.Duration
+	Cap  time.Duration
+
+	mu   sync.Mutex
+	prev time.Duration
+}
+
+// Next implements Backoff.
+func (b *DecorrelatedJitterBackoff) Next(attempt int, lastErr error) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	prev := b.prev
+
+	if prev < b.Base {
+		prev = b.Base
+	}
+
+	high := prev * 3
+	d := b.Base
+
+	if high > b.Base {
+		d += time.Duration(rand.Int63n(int64(high - b.Base)))
+	}
+
+	if d > b.Cap {
+		d = b.Cap
+	}
+
+	b.prev = d
+
+	return d
+}
+
+// reset clears the previous delay, so the next call to Next draws from
+// [Base, Base*3] again, as if this were the first attempt.
+func (b *DecorrelatedJitterBackoff) reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.prev = 0
+}
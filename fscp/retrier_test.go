@@ -49,12 +49,14 @@ func TestRetrierInitialFailure(t *testing.T) {
 
 	retrier := &Retrier{
 		Operation: func() error {
+			a++
 			return errors.New("fail")
 		},
 		OnFailure: func(err error) {
 			failed = err
 		},
-		Period: time.Millisecond,
+		Period:      time.Millisecond,
+		MaxAttempts: 1,
 	}
 
 	retrier.Start()
@@ -62,18 +64,14 @@ func TestRetrierInitialFailure(t *testing.T) {
 
 	time.Sleep(time.Millisecond * 10)
 
-	if b := retrier.Stop(); !b {
-		t.Fatalf("true was expected")
-	}
-
-	if a != 0 {
-		t.Errorf("0 was expected but got %d", a)
-	}
-
 	if b := retrier.Stop(); b {
 		t.Fatalf("false was expected")
 	}
 
+	if a != 1 {
+		t.Errorf("1 was expected but got %d", a)
+	}
+
 	if failed == nil {
 		t.Errorf("expected an error")
 	}
@@ -96,7 +94,8 @@ func TestRetrierFailure(t *testing.T) {
 		OnFailure: func(err error) {
 			failed = err
 		},
-		Period: time.Millisecond,
+		Period:      time.Millisecond,
+		MaxAttempts: 2,
 	}
 
 	retrier.Start()
@@ -108,15 +107,145 @@ func TestRetrierFailure(t *testing.T) {
 		t.Fatalf("false was expected")
 	}
 
-	if a != 2 {
-		t.Errorf("2 was expected but got %d", a)
+	// The first attempt succeeds, which resets the attempt count; it
+	// then takes MaxAttempts (2) consecutive failures to give up, for 3
+	// calls to Operation in total.
+	if a != 3 {
+		t.Errorf("3 was expected but got %d", a)
 	}
 
-	if b := retrier.Stop(); b {
-		t.Fatalf("false was expected")
+	if failed == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+func TestRetrierRetriesIndefinitelyByDefault(t *testing.T) {
+	var failed error
+	a := 0
+
+	retrier := &Retrier{
+		Operation: func() error {
+			a++
+			return errors.New("fail")
+		},
+		OnFailure: func(err error) {
+			failed = err
+		},
+		Period: time.Millisecond,
+	}
+
+	retrier.Start()
+	defer retrier.Stop()
+
+	time.Sleep(time.Millisecond * 10)
+
+	if failed != nil {
+		t.Errorf("expected no failure yet, since MaxAttempts and ShouldRetry are unset, but got: %s", failed)
+	}
+
+	if a < 3 {
+		t.Errorf("at least 3 attempts were expected but got %d", a)
+	}
+}
+
+func TestRetrierShouldRetryAbortsImmediately(t *testing.T) {
+	var failed error
+	a := 0
+
+	retrier := &Retrier{
+		Operation: func() error {
+			a++
+			return errors.New("fail")
+		},
+		OnFailure: func(err error) {
+			failed = err
+		},
+		Period:      time.Millisecond,
+		ShouldRetry: func(err error) bool { return false },
+	}
+
+	retrier.Start()
+	defer retrier.Stop()
+
+	time.Sleep(time.Millisecond * 10)
+
+	if a != 1 {
+		t.Errorf("exactly 1 attempt was expected but got %d", a)
 	}
 
 	if failed == nil {
 		t.Errorf("expected an error")
 	}
 }
+
+// TestRetrierResetOnSuccess drives step (the single-attempt primitive
+// run loops over) directly, rather than through Start's timer goroutine,
+// so the success-then-failure sequence it needs to exercise is
+// deterministic rather than racing real time.
+func TestRetrierResetOnSuccess(t *testing.T) {
+	fail := true
+	a := 0
+
+	retrier := &Retrier{
+		Operation: func() error {
+			a++
+
+			if fail {
+				return errors.New("fail")
+			}
+
+			return nil
+		},
+		OnFailure:   func(err error) {},
+		MaxAttempts: 2,
+	}
+	retrier.closed = make(chan struct{})
+
+	if _, done := retrier.step(); done {
+		t.Fatal("did not expect to give up after a single failure")
+	}
+
+	fail = false
+
+	if _, done := retrier.step(); done {
+		t.Fatal("did not expect a successful attempt to give up")
+	}
+
+	fail = true
+
+	if _, done := retrier.step(); done {
+		t.Fatal("expected the attempt count to have been reset by the intervening success")
+	}
+
+	if _, done := retrier.step(); !done {
+		t.Fatal("expected the retrier to give up after MaxAttempts consecutive failures")
+	}
+
+	if a != 4 {
+		t.Errorf("expected 4 calls to Operation, got %d", a)
+	}
+}
+
+func TestExponentialBackoffCapsAtMax(t *testing.T) {
+	b := ExponentialBackoff{Initial: time.Millisecond, Max: 10 * time.Millisecond, Multiplier: 2}
+
+	if got := b.Next(1, nil); got != time.Millisecond {
+		t.Errorf("Next(1) = %s, want %s", got, time.Millisecond)
+	}
+
+	if got := b.Next(10, nil); got != 10*time.Millisecond {
+		t.Errorf("Next(10) = %s, want the Max of %s", got, 10*time.Millisecond)
+	}
+}
+
+func TestDecorrelatedJitterBackoffStaysWithinBounds(t *testing.T) {
+	b := &DecorrelatedJitterBackoff{Base: time.Millisecond, Cap: 100 * time.Millisecond}
+
+	for i := 1; i <= 20; i++ {
+		d := b.Next(i, nil)
+
+		if d < b.Base || d > b.Cap {
+			t.Fatalf("Next(%d) = %s, want a value within [%s, %s]", i, d, b.Base, b.Cap)
+		}
+	}
+}
@@ -5,6 +5,7 @@ package fscp
 
 import (
 	"crypto"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/hmac"
 	"crypto/rand"
@@ -33,21 +34,55 @@ const (
 	ECDHERSAAES128GCMSHA256 CipherSuite = 0x01
 	// ECDHERSAAES256GCMSHA384 is the ECDHE-RSA-AES-256-GCM-SHA384 cipher suite.
 	ECDHERSAAES256GCMSHA384 CipherSuite = 0x02
+	// ECDHEED25519CHACHA20POLY1305SHA256 is the ECDHE-Ed25519-ChaCha20-Poly1305-SHA256 cipher suite.
+	ECDHEED25519CHACHA20POLY1305SHA256 CipherSuite = 0x03
+	// ECDHEED25519AES256GCMSHA384 is the ECDHE-Ed25519-AES-256-GCM-SHA384 cipher suite.
+	ECDHEED25519AES256GCMSHA384 CipherSuite = 0x04
+	// ECDHERSACHACHA20POLY1305SHA256 is the ECDHE-RSA-ChaCha20-Poly1305-SHA256 cipher suite.
+	ECDHERSACHACHA20POLY1305SHA256 CipherSuite = 0x05
 )
 
-// BlockSize returns the block size.
+// BlockSize returns the length, in bytes, of the key s's cipher suite
+// registry entry expects, or 0 for NullCipherSuite.
 func (s CipherSuite) BlockSize() int {
-	switch s {
-	case NullCipherSuite:
+	if s == NullCipherSuite {
 		return 0
-	case ECDHERSAAES128GCMSHA256:
-		return 16
-	case ECDHERSAAES256GCMSHA384:
-		return 32
 	}
 
-	panic(fmt.Errorf("Unknown cipher suite: %s", s))
+	return s.impl().KeyLen()
+}
+
+// TagLen returns the length, in bytes, of the authentication tag s's
+// AEAD appends to a sealed message, or 0 for NullCipherSuite.
+func (s CipherSuite) TagLen() int {
+	if s == NullCipherSuite {
+		return 0
+	}
+
+	return s.impl().TagLen()
+}
+
+// hash returns the hash function s's key schedule (see
+// deriveSessionKeys) is built on.
+func (s CipherSuite) hash() crypto.Hash {
+	if s == NullCipherSuite {
+		return 0
+	}
+
+	return s.impl().Hash()
+}
+
+// impl returns the CipherSuiteImpl registered for s, panicking if none
+// is, the same way the hardcoded switches this replaced did for an
+// unrecognized CipherSuite.
+func (s CipherSuite) impl() CipherSuiteImpl {
+	impl := cipherSuiteImpl(s)
 
+	if impl == nil {
+		panic(fmt.Errorf("Unknown cipher suite: %s", s))
+	}
+
+	return impl
 }
 
 // CipherSuiteSlice represents a slice of cipher suites.
@@ -96,12 +131,37 @@ const (
 	SECP384R1 EllipticCurve = 0x02
 	// SECP521R1 is the SECP521R1 elliptic curve.
 	SECP521R1 EllipticCurve = 0x03
+	// KYBER768_SECP384R1 pairs classical ECDHE over SECP384R1 with a
+	// Kyber768 post-quantum key encapsulation, protecting the session
+	// against an attacker who records today's traffic to decrypt it once a
+	// cryptographically relevant quantum computer exists.
+	//
+	// Unusable as of yet: SetRemote never sends the KEM ciphertext back to
+	// its generating peer, so both sides derive different session keys.
+	// Excluded from DefaultEllipticCurves until that round trip exists.
+	KYBER768_SECP384R1 EllipticCurve = 0x04
+	// NEWHOPE_SECP521R1 pairs classical ECDHE over SECP521R1 with a
+	// post-quantum key encapsulation. It is currently backed by the same
+	// Kyber768 implementation as KYBER768_SECP384R1, behind the pqKEM
+	// interface, pending a dedicated NewHope backend.
+	//
+	// Unusable as of yet, for the same reason as KYBER768_SECP384R1: see
+	// its doc comment.
+	NEWHOPE_SECP521R1 EllipticCurve = 0x05
 )
 
 // EllipticCurveSlice represents a slice of elliptic curves.
 type EllipticCurveSlice []EllipticCurve
 
-// DefaultEllipticCurves returns the default elliptic curves.
+// DefaultEllipticCurves returns the default elliptic curves, in order of
+// preference: SECP384R1, then SECP521R1.
+//
+// KYBER768_SECP384R1 and NEWHOPE_SECP521R1 are deliberately excluded: their
+// SetRemote handshake never sends the KEM encapsulation ciphertext back to
+// the peer that generated the KEM key pair, so the two sides derive
+// different session keys and can never decrypt each other's DATA messages.
+// Negotiate them explicitly via ClientSecurity.EllipticCurves only once
+// that round trip is wired up.
 func DefaultEllipticCurves() EllipticCurveSlice {
 	return EllipticCurveSlice{
 		SECP384R1,
@@ -112,15 +172,26 @@ func DefaultEllipticCurves() EllipticCurveSlice {
 // Curve returns the associated elliptic curve.
 func (c EllipticCurve) Curve() elliptic.Curve {
 	switch c {
-	case SECP384R1:
+	case SECP384R1, KYBER768_SECP384R1:
 		return elliptic.P384()
-	case SECP521R1:
+	case SECP521R1, NEWHOPE_SECP521R1:
 		return elliptic.P521()
 	default:
 		return nil
 	}
 }
 
+// kem returns the post-quantum key encapsulation mechanism paired with c, or
+// nil if c is a purely classical curve.
+func (c EllipticCurve) kem() pqKEM {
+	switch c {
+	case KYBER768_SECP384R1, NEWHOPE_SECP521R1:
+		return kyber768KEM{}
+	default:
+		return nil
+	}
+}
+
 // FindCommon returns the first elliptic curve that is found in both slices.
 func (s EllipticCurveSlice) FindCommon(others EllipticCurveSlice) EllipticCurve {
 	for _, value := range s {
@@ -195,20 +266,111 @@ func GenerateLocalCertificate() (*rsa.PrivateKey, *x509.Certificate, error) {
 	return priv, cert, err
 }
 
+// GenerateLocalEd25519Certificate generates a default local X509 certificate
+// signed with a freshly generated Ed25519 key for the current host.
+func GenerateLocalEd25519Certificate() (ed25519.PrivateKey, *x509.Certificate, error) {
+	hostname, err := os.Hostname()
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not determine local hostname: %s", err)
+	}
+
+	ca := &x509.Certificate{
+		SerialNumber: big.NewInt(1653),
+		Subject: pkix.Name{
+			CommonName: hostname,
+		},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		IsCA:                  true,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate Ed25519 private key: %s", err)
+	}
+
+	raw, err := x509.CreateCertificate(rand.Reader, ca, ca, pub, priv)
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create X509 certificate: %s", err)
+	}
+
+	cert, err := x509.ParseCertificate(raw)
+
+	return priv, cert, err
+}
+
 // ClientSecurity contains all the security settings of a client.
 type ClientSecurity struct {
-	Certificate    *x509.Certificate
-	PrivateKey     *rsa.PrivateKey
+	Certificate *x509.Certificate
+
+	// CertificateV2 is an alternative, compact certificate envelope that can
+	// be presented instead of Certificate. When both are set, Certificate
+	// takes precedence on the wire.
+	CertificateV2 *CertificateV2
+
+	// PrivateKey is the private key associated to Certificate (or
+	// CertificateV2, when it is the only one set).
+	//
+	// It must be either a *rsa.PrivateKey or a ed25519.PrivateKey, matching
+	// the public key embedded in the presented certificate.
+	PrivateKey     crypto.Signer
 	PresharedKey   []byte
 	CipherSuites   CipherSuiteSlice
 	EllipticCurves EllipticCurveSlice
 
 	RemoteClientSecurity *RemoteClientSecurity
+
+	// Tracer, if set, is notified of per-message protocol events (messages
+	// sent/received, decrypt failures, replay drops, rekeys) on every Conn
+	// created from this ClientSecurity. A nil Tracer disables tracing.
+	Tracer Tracer
+
+	// RekeyPolicy, if set, bounds how much a Conn's active Session may be
+	// used before a replacement is proactively negotiated. A nil
+	// RekeyPolicy leaves rekeying to the Session's own built-in
+	// sequence-number-based threshold (see Session.RekeyThreshold).
+	RekeyPolicy *RekeyPolicy
+
+	// ReplayWindowSize overrides the width, in sequence numbers, of the
+	// sliding replay-detection window each Session created from this
+	// ClientSecurity uses (see Session.WindowSize). Zero leaves the
+	// Session default of DefaultWindowSize in place.
+	ReplayWindowSize SequenceNumber
+}
+
+// RekeyPolicy bounds how much traffic, or how much time, a Conn's active
+// Session may carry before the Conn proactively negotiates a replacement
+// session, the way TLS 1.3 and WireGuard periodically rekey to limit the
+// damage a single compromised or nonce-exhausted key can do.
+//
+// Crossing any configured threshold makes Conn send a SESSION_REQUEST for
+// SessionNumber+1 on its own, the same way the initial handshake does; the
+// swap to the new Session only completes once the peer replies. A zero
+// value in any field disables that particular check.
+type RekeyPolicy struct {
+	// MaxBytes is the number of plaintext bytes a session may encrypt
+	// before a rekey is triggered.
+	MaxBytes uint64
+
+	// MaxMessages is the number of messages a session may encrypt before a
+	// rekey is triggered.
+	MaxMessages SequenceNumber
+
+	// MaxAge is the duration since the session was established after
+	// which a rekey is triggered, regardless of how much traffic flowed.
+	MaxAge time.Duration
 }
 
 // RemoteClientSecurity represents the remote client security.
 type RemoteClientSecurity struct {
-	Certificate *x509.Certificate
+	Certificate   *x509.Certificate
+	CertificateV2 *CertificateV2
 }
 
 // DefaultPresharedKeyPassphrase is the default preshared key passphrase.
@@ -265,18 +427,82 @@ func (s *ClientSecurity) supportedEllipticCurves() EllipticCurveSlice {
 	return s.EllipticCurves
 }
 
+// keyScheme signs and verifies messages on behalf of a given key type,
+// dispatching to the appropriate algorithm (RSA-PSS or Ed25519).
+type keyScheme interface {
+	sign(priv crypto.Signer, cleartext []byte) ([]byte, error)
+	verify(pub crypto.PublicKey, cleartext, signature []byte) error
+}
+
+type rsaPSSScheme struct{}
+
+func (rsaPSSScheme) sign(priv crypto.Signer, cleartext []byte) ([]byte, error) {
+	hashed := sha256.Sum256(cleartext)
+
+	// This is necessary for interoperability with the legacy freelan
+	// implementation.
+	options := &rsa.PSSOptions{
+		SaltLength: sha256.Size,
+	}
+
+	return priv.Sign(rand.Reader, hashed[:], options)
+}
+
+func (rsaPSSScheme) verify(pub crypto.PublicKey, cleartext, signature []byte) error {
+	rsaPub, ok := pub.(*rsa.PublicKey)
+
+	if !ok {
+		return fmt.Errorf("expected a RSA public key but got %T", pub)
+	}
+
+	hashed := sha256.Sum256(cleartext)
+
+	return rsa.VerifyPSS(rsaPub, crypto.SHA256, hashed[:], signature, nil)
+}
+
+type ed25519Scheme struct{}
+
+func (ed25519Scheme) sign(priv crypto.Signer, cleartext []byte) ([]byte, error) {
+	return priv.Sign(rand.Reader, cleartext, crypto.Hash(0))
+}
+
+func (ed25519Scheme) verify(pub crypto.PublicKey, cleartext, signature []byte) error {
+	ed25519Pub, ok := pub.(ed25519.PublicKey)
+
+	if !ok {
+		return fmt.Errorf("expected an Ed25519 public key but got %T", pub)
+	}
+
+	if !ed25519.Verify(ed25519Pub, cleartext, signature) {
+		return errors.New("Ed25519 signature does not match")
+	}
+
+	return nil
+}
+
+// schemeForPublicKey returns the keyScheme that must be used for the given
+// public key type.
+func schemeForPublicKey(pub crypto.PublicKey) (keyScheme, error) {
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		return rsaPSSScheme{}, nil
+	case ed25519.PublicKey:
+		return ed25519Scheme{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key type: %T", pub)
+	}
+}
+
 // Sign a message.
 func (s ClientSecurity) Sign(cleartext []byte) ([]byte, error) {
 	if s.PrivateKey != nil {
-		hashed := sha256.Sum256(cleartext)
+		scheme, err := schemeForPublicKey(s.PrivateKey.Public())
 
-		// This is necessary for interoperability with the legacy freelan
-		// implementation.
-		options := &rsa.PSSOptions{
-			SaltLength: sha256.Size,
+		if err != nil {
+			return nil, err
 		}
 
-		return rsa.SignPSS(rand.Reader, s.PrivateKey, crypto.SHA256, hashed[:], options)
+		return scheme.sign(s.PrivateKey, cleartext)
 	}
 
 	hash := hmac.New(sha256.New, s.PresharedKey)
@@ -292,9 +518,17 @@ func (s ClientSecurity) Verify(cleartext []byte, signature []byte) error {
 	}
 
 	if s.RemoteClientSecurity.Certificate != nil {
-		hashed := sha256.Sum256(cleartext)
+		scheme, err := schemeForPublicKey(s.RemoteClientSecurity.Certificate.PublicKey)
+
+		if err != nil {
+			return err
+		}
+
+		return scheme.verify(s.RemoteClientSecurity.Certificate.PublicKey, cleartext, signature)
+	}
 
-		return rsa.VerifyPSS(s.RemoteClientSecurity.Certificate.PublicKey.(*rsa.PublicKey), crypto.SHA256, hashed[:], signature, nil)
+	if s.RemoteClientSecurity.CertificateV2 != nil {
+		return ed25519Scheme{}.verify(ed25519.PublicKey(s.RemoteClientSecurity.CertificateV2.PublicKey), cleartext, signature)
 	}
 
 	hash := hmac.New(sha256.New, s.PresharedKey)
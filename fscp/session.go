@@ -1,14 +1,40 @@
 package fscp
 
 import (
-	"crypto/aes"
+	"bytes"
 	"crypto/cipher"
-	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"math"
+	"time"
+)
+
+// DefaultWindowSize is the default width, in sequence numbers, of a
+// Session's replay-detection window.
+const DefaultWindowSize = 64
+
+// DefaultRekeyThreshold is the default number of sequence numbers that may
+// be consumed by Encrypt before NeedsRekey starts reporting true.
+const DefaultRekeyThreshold = 1 << 31
+
+// ErrRekeyRequired is returned by Encrypt once LocalSequenceNumber has
+// reached its hard ceiling (2^32 - 1). Encrypting past that point would
+// force SequenceNumber to wrap and reuse a nonce, which destroys the cipher
+// suite's confidentiality guarantees, so Encrypt refuses instead. Callers
+// should watch NeedsRekey well before this point and negotiate a fresh
+// Session.
+var ErrRekeyRequired = errors.New("fscp: sequence number exhausted, a rekey is required")
+
+// ErrOutdatedMessage and ErrReplayedMessage are returned by Decrypt (wrapping
+// checkReplay) when a message falls outside the replay window or repeats a
+// sequence number already accepted within it.
+var (
+	ErrOutdatedMessage = errors.New("fscp: message is outside the replay window")
+	ErrReplayedMessage = errors.New("fscp: message was already seen")
 )
 
 // Session represents an outgoing or incoming session.
@@ -19,16 +45,53 @@ type Session struct {
 	CipherSuite          CipherSuite
 	EllipticCurve        EllipticCurve
 	LocalSequenceNumber  SequenceNumber
-	RemoteSequenceNumber SequenceNumber
-	PublicKey            *ecdsa.PublicKey
-	PrivateKey           []byte
-	RemotePublicKey      *ecdsa.PublicKey
-	LocalSessionKey      []byte
-	RemoteSessionKey     []byte
-	LocalIV              []byte
-	RemoteIV             []byte
-	LocalAEAD            cipher.AEAD
-	RemoteAEAD           cipher.AEAD
+	// WindowSize is the width, in sequence numbers, of the sliding window
+	// used to detect replayed messages in Decrypt. It is set to
+	// DefaultWindowSize by NewSession.
+	WindowSize SequenceNumber
+	// RekeyThreshold is the number of sequence numbers that may be consumed
+	// by Encrypt before NeedsRekey reports true. It is set to
+	// DefaultRekeyThreshold by NewSession.
+	RekeyThreshold SequenceNumber
+	// RemoteSequenceCeiling is the highest sequence number accepted so far.
+	RemoteSequenceCeiling SequenceNumber
+	// LocalBytesSent is the cumulative number of plaintext bytes passed to
+	// Encrypt, tracked so a ClientSecurity.RekeyPolicy can bound it.
+	LocalBytesSent uint64
+	// EstablishedAt is the time NewSession created this session, tracked
+	// so a ClientSecurity.RekeyPolicy.MaxAge can be enforced against it.
+	EstablishedAt time.Time
+	// replayWindow guards against replayed or outdated DATA messages. Its
+	// Size is kept in sync with WindowSize.
+	replayWindow ReplayWindow
+	// PublicKey is the wire encoding of the local contribution to the key
+	// exchange: the marshaled ECDHE public key and, for hybrid post-quantum
+	// curves, the local KEM public key, both length-prefixed and
+	// concatenated in that order.
+	PublicKey  []byte
+	PrivateKey []byte
+	// KEMPrivateKey is the local KEM private key, set only when
+	// EllipticCurve.kem() is non-nil.
+	KEMPrivateKey []byte
+	// RemotePublicKey holds the remote's raw PublicKey blob, once set by
+	// SetRemote.
+	RemotePublicKey  []byte
+	LocalSessionKey  []byte
+	RemoteSessionKey []byte
+	LocalIV          []byte
+	RemoteIV         []byte
+	LocalAEAD        cipher.AEAD
+	RemoteAEAD       cipher.AEAD
+
+	// Tracer, if set, is notified of Encrypt/Decrypt events (decrypt
+	// failures, replay drops). A nil Tracer disables tracing.
+	Tracer Tracer
+}
+
+// tracer returns s.Tracer, or a Tracer that discards every call if s.Tracer
+// is nil, so callers can invoke hooks unconditionally.
+func (s *Session) tracer() Tracer {
+	return traceOrDiscard(s.Tracer)
 }
 
 // NewSession instantiate a new session.
@@ -54,10 +117,13 @@ func NewSession(hostIdentifier HostIdentifier, sessionNumber SessionNumber, ciph
 		return nil, fmt.Errorf("failed to generate ECDHE key: %s", err)
 	}
 
-	publicKey := &ecdsa.PublicKey{
-		Curve: curve,
-		X:     x,
-		Y:     y,
+	publicKey := elliptic.Marshal(curve, x, y)
+	var kemPublicKey, kemPrivateKey []byte
+
+	if kem := ellipticCurve.kem(); kem != nil {
+		if kemPublicKey, kemPrivateKey, err = kem.GenerateKeyPair(); err != nil {
+			return nil, fmt.Errorf("failed to generate KEM key pair: %s", err)
+		}
 	}
 
 	return &Session{
@@ -65,17 +131,19 @@ func NewSession(hostIdentifier HostIdentifier, sessionNumber SessionNumber, ciph
 		SessionNumber:       sessionNumber,
 		CipherSuite:         cipherSuite,
 		EllipticCurve:       ellipticCurve,
-		PublicKey:           publicKey,
+		WindowSize:          DefaultWindowSize,
+		RekeyThreshold:      DefaultRekeyThreshold,
+		PublicKey:           marshalHybridPublicKey(publicKey, kemPublicKey),
 		PrivateKey:          d,
+		KEMPrivateKey:       kemPrivateKey,
+		EstablishedAt:       time.Now(),
 	}, nil
 }
 
 // SetRemote computes the session keys.
-func (s *Session) SetRemote(hostIdentifier HostIdentifier, publicKey *ecdsa.PublicKey) error {
+func (s *Session) SetRemote(hostIdentifier HostIdentifier, publicKey []byte) error {
 	if s.RemotePublicKey != nil {
-		if s.RemotePublicKey.Curve != publicKey.Curve ||
-			s.RemotePublicKey.X.Cmp(publicKey.X) != 0 ||
-			s.RemotePublicKey.Y.Cmp(publicKey.Y) != 0 {
+		if !bytes.Equal(s.RemotePublicKey, publicKey) {
 			return errors.New("the remote public key was set previously to a different value")
 		}
 
@@ -86,48 +154,66 @@ func (s *Session) SetRemote(hostIdentifier HostIdentifier, publicKey *ecdsa.Publ
 
 	curve := s.EllipticCurve.Curve()
 
-	// k should never be kept around for too long.
-	//
-	// We derive the keys from it and then discard it.
-	k, _ := curve.ScalarMult(publicKey.X, publicKey.Y, s.PrivateKey)
-
-	s.RemotePublicKey = publicKey
-
-	s.LocalSessionKey = make([]byte, s.CipherSuite.BlockSize())
-	s.RemoteSessionKey = make([]byte, s.CipherSuite.BlockSize())
-
-	prf12(s.LocalSessionKey, k.Bytes(), []byte("session key"), s.LocalHostIdentifier[:])
-	prf12(s.RemoteSessionKey, k.Bytes(), []byte("session key"), s.RemoteHostIdentifier[:])
-
-	localBlock, err := aes.NewCipher(s.LocalSessionKey)
+	ecdhePart, kemPart, err := unmarshalHybridPublicKey(publicKey)
 
 	if err != nil {
-		return fmt.Errorf("failed to instanciate block cipher: %s", err)
+		return fmt.Errorf("parsing remote public key: %s", err)
 	}
 
-	s.LocalAEAD, err = cipher.NewGCM(localBlock)
+	x, y := elliptic.Unmarshal(curve, ecdhePart)
 
-	if err != nil {
-		return fmt.Errorf("failed to instanciate GCM: %s", err)
+	if x == nil {
+		return errors.New("invalid remote ECDHE public key")
 	}
 
-	remoteBlock, err := aes.NewCipher(s.RemoteSessionKey)
+	// k should never be kept around for too long.
+	//
+	// We derive the keys from it and then discard it.
+	k, _ := curve.ScalarMult(x, y, s.PrivateKey)
+
+	secret := k.Bytes()
+
+	if kem := s.EllipticCurve.kem(); kem != nil {
+		// BROKEN: the peer generated its KEM key pair concurrently with
+		// ours and sent us its public key, so we encapsulate against it
+		// here, but the resulting ciphertext is never sent back to the
+		// peer, which has no way to recover this same shared secret via
+		// Decapsulate. Both sides silently derive different session keys.
+		// This is why DefaultEllipticCurves excludes every hybrid curve;
+		// do not negotiate one until the ciphertext round trip exists.
+		kemSharedSecret, _, err := kem.Encapsulate(kemPart)
+
+		if err != nil {
+			return fmt.Errorf("encapsulating KEM shared secret: %s", err)
+		}
 
-	if err != nil {
-		return fmt.Errorf("failed to instanciate block cipher: %s", err)
+		h := sha256.New()
+		h.Write(secret)
+		h.Write(kemSharedSecret)
+		h.Write(s.LocalHostIdentifier[:])
+		h.Write(s.RemoteHostIdentifier[:])
+		secret = h.Sum(nil)
 	}
 
-	s.RemoteAEAD, err = cipher.NewGCM(remoteBlock)
+	s.RemotePublicKey = publicKey
+
+	// The protocol negotiates a single session number shared by both
+	// peers (see messageSessionRequest), rather than independent
+	// per-direction ones, so it is passed for both the local and remote
+	// session number here.
+	s.LocalSessionKey, s.RemoteSessionKey, s.LocalIV, s.RemoteIV, err = deriveSessionKeys(secret, s.CipherSuite, s.LocalHostIdentifier, s.RemoteHostIdentifier, s.SessionNumber, s.SessionNumber)
 
 	if err != nil {
-		return fmt.Errorf("failed to instanciate GCM: %s", err)
+		return fmt.Errorf("deriving session keys: %s", err)
 	}
 
-	s.LocalIV = make([]byte, 8, 12)
-	s.RemoteIV = make([]byte, 8, 12)
+	if s.LocalAEAD, err = newAEAD(s.CipherSuite, s.LocalSessionKey); err != nil {
+		return err
+	}
 
-	prf12(s.LocalIV, k.Bytes(), []byte("nonce prefix"), s.LocalHostIdentifier[:])
-	prf12(s.RemoteIV, k.Bytes(), []byte("nonce prefix"), s.RemoteHostIdentifier[:])
+	if s.RemoteAEAD, err = newAEAD(s.CipherSuite, s.RemoteSessionKey); err != nil {
+		return err
+	}
 
 	// Preallocate the buffers so we can simply copy the sequence numbers
 	// without any allocation later on.
@@ -143,43 +229,157 @@ func (s *Session) SetRemote(hostIdentifier HostIdentifier, publicKey *ecdsa.Publ
 //
 // ciphertext will be modified after the call, regardless of the outcome.
 func (s *Session) Decrypt(msg *messageData) ([]byte, error) {
-	if msg.SequenceNumber <= s.RemoteSequenceNumber {
-		return nil, fmt.Errorf("outdated message: expected %d but got %d", s.RemoteSequenceNumber, msg.SequenceNumber)
-	}
-
 	// Sadly, the initial protocol design separates the GCM tag with the
 	// ciphertext length... forcing us to recreate a buffer.
-	msg.Ciphertext = append(msg.Ciphertext, msg.GCMTag[:]...)
+	msg.Ciphertext = append(msg.Ciphertext, msg.GCMTag...)
 
 	updateIV(s.RemoteIV, msg.SequenceNumber)
 
 	data, err := s.RemoteAEAD.Open(msg.Ciphertext[:0], s.RemoteIV, msg.Ciphertext, nil)
 
 	if err != nil {
+		s.tracer().OnDecryptFailure(err, msg.SequenceNumber)
+
 		return nil, err
 	}
 
-	s.RemoteSequenceNumber = msg.SequenceNumber
+	// The replay check only runs once the AEAD tag has been verified, so
+	// that a message with a forged or stale sequence number but no valid
+	// tag can't be used to probe which sequence numbers we've seen.
+	if err := s.checkReplay(msg.SequenceNumber); err != nil {
+		return nil, err
+	}
 
 	return data, nil
 }
 
+// checkReplay runs seq through s.replayWindow, tracing and reporting
+// ErrOutdatedMessage/ErrReplayedMessage for anything the window rejects,
+// and otherwise commits it and refreshes RemoteSequenceCeiling.
+func (s *Session) checkReplay(seq SequenceNumber) error {
+	s.replayWindow.Size = s.WindowSize
+
+	if err := s.replayWindow.Check(seq); err != nil {
+		s.tracer().OnReplayDropped(seq)
+
+		return err
+	}
+
+	s.replayWindow.Commit(seq)
+	s.RemoteSequenceCeiling = s.replayWindow.Ceiling()
+
+	return nil
+}
+
 // Encrypt a cleartext.
 //
 // This method is not thread-safe.
-func (s *Session) Encrypt(cleartext []byte) *messageData {
+//
+// It returns ErrRekeyRequired, without encrypting anything, once
+// LocalSequenceNumber has reached math.MaxUint32. Callers should not let
+// things get that far: check NeedsRekey after every call and negotiate a
+// fresh Session once it reports true.
+func (s *Session) Encrypt(cleartext []byte) (*messageData, error) {
+	if s.LocalSequenceNumber == math.MaxUint32 {
+		return nil, ErrRekeyRequired
+	}
+
 	s.LocalSequenceNumber++
 	updateIV(s.LocalIV, s.LocalSequenceNumber)
+	s.LocalBytesSent += uint64(len(cleartext))
 
 	cleartext = s.LocalAEAD.Seal(cleartext[:0], s.LocalIV, cleartext, nil)
+	tagLen := s.CipherSuite.TagLen()
 
 	return &messageData{
 		SequenceNumber: s.LocalSequenceNumber,
-		GCMTag:         cleartext[len(cleartext)-16:],
-		Ciphertext:     cleartext[:len(cleartext)-16],
+		GCMTag:         cleartext[len(cleartext)-tagLen:],
+		Ciphertext:     cleartext[:len(cleartext)-tagLen],
+	}, nil
+}
+
+// NeedsRekey reports whether LocalSequenceNumber has crossed RekeyThreshold,
+// the soft limit past which the owning Conn should negotiate a fresh
+// Session, well before Encrypt starts refusing with ErrRekeyRequired.
+func (s *Session) NeedsRekey() bool {
+	return s.LocalSequenceNumber >= s.rekeyThreshold()
+}
+
+// rekeyThreshold returns s.RekeyThreshold, defaulting to
+// DefaultRekeyThreshold when unset.
+func (s *Session) rekeyThreshold() SequenceNumber {
+	if s.RekeyThreshold == 0 {
+		return DefaultRekeyThreshold
 	}
+
+	return s.RekeyThreshold
 }
 
 func updateIV(iv []byte, sequenceNumber SequenceNumber) {
 	binary.BigEndian.PutUint32(iv[8:], uint32(sequenceNumber))
 }
+
+// newAEAD instantiates the AEAD the cipher suite registry associates
+// with suite, keyed by key.
+func newAEAD(suite CipherSuite, key []byte) (cipher.AEAD, error) {
+	impl := cipherSuiteImpl(suite)
+
+	if impl == nil {
+		return nil, fmt.Errorf("no cipher suite registered for %s", suite)
+	}
+
+	aead, err := impl.NewAEAD(key)
+
+	if err != nil {
+		return nil, fmt.Errorf("instanciating AEAD for %s: %s", suite, err)
+	}
+
+	return aead, nil
+}
+
+// marshalHybridPublicKey concatenates the ECDHE public key with the KEM
+// public key (if any), each prefixed with its length, for transmission in a
+// messageSession's PublicKey field.
+func marshalHybridPublicKey(ecdhePublicKey, kemPublicKey []byte) []byte {
+	result := make([]byte, 2, 2+len(ecdhePublicKey)+2+len(kemPublicKey))
+
+	binary.BigEndian.PutUint16(result, uint16(len(ecdhePublicKey)))
+	result = append(result, ecdhePublicKey...)
+
+	kemLen := make([]byte, 2)
+	binary.BigEndian.PutUint16(kemLen, uint16(len(kemPublicKey)))
+	result = append(result, kemLen...)
+	result = append(result, kemPublicKey...)
+
+	return result
+}
+
+// unmarshalHybridPublicKey splits a messageSession's PublicKey field back
+// into its ECDHE and (possibly empty) KEM parts.
+func unmarshalHybridPublicKey(data []byte) (ecdhePublicKey, kemPublicKey []byte, err error) {
+	if len(data) < 2 {
+		return nil, nil, errors.New("public key blob is too short")
+	}
+
+	ecdheLen := binary.BigEndian.Uint16(data)
+	data = data[2:]
+
+	if len(data) < int(ecdheLen) {
+		return nil, nil, errors.New("public key blob is too short for its ECDHE part")
+	}
+
+	ecdhePublicKey, data = data[:ecdheLen], data[ecdheLen:]
+
+	if len(data) < 2 {
+		return nil, nil, errors.New("public key blob is too short for its KEM part length")
+	}
+
+	kemLen := binary.BigEndian.Uint16(data)
+	data = data[2:]
+
+	if len(data) < int(kemLen) {
+		return nil, nil, errors.New("public key blob is too short for its KEM part")
+	}
+
+	return ecdhePublicKey, data[:kemLen], nil
+}
@@ -0,0 +1,109 @@
+package fscp
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+// newTestSessionPair returns two Sessions with matching keys, as if a and b
+// had just completed a SESSION_REQUEST/SESSION handshake with each other.
+func newTestSessionPair(t *testing.T) (a, b *Session) {
+	t.Helper()
+
+	var aHostID, bHostID HostIdentifier
+	aHostID[0] = 0x01
+	bHostID[0] = 0x02
+
+	a, err := NewSession(aHostID, 1, ECDHERSAAES128GCMSHA256, SECP384R1)
+
+	if err != nil {
+		t.Fatalf("creating session a: %s", err)
+	}
+
+	b, err = NewSession(bHostID, 1, ECDHERSAAES128GCMSHA256, SECP384R1)
+
+	if err != nil {
+		t.Fatalf("creating session b: %s", err)
+	}
+
+	if err := a.SetRemote(bHostID, b.PublicKey); err != nil {
+		t.Fatalf("a.SetRemote: %s", err)
+	}
+
+	if err := b.SetRemote(aHostID, a.PublicKey); err != nil {
+		t.Fatalf("b.SetRemote: %s", err)
+	}
+
+	return a, b
+}
+
+func TestSessionNeedsRekey(t *testing.T) {
+	session, _ := newTestSessionPair(t)
+
+	if session.NeedsRekey() {
+		t.Fatalf("expected a freshly created session not to need a rekey")
+	}
+
+	session.LocalSequenceNumber = DefaultRekeyThreshold - 1
+
+	if session.NeedsRekey() {
+		t.Errorf("expected no rekey to be needed just below RekeyThreshold")
+	}
+
+	session.LocalSequenceNumber = DefaultRekeyThreshold
+
+	if !session.NeedsRekey() {
+		t.Errorf("expected a rekey to be needed at RekeyThreshold")
+	}
+}
+
+func TestSessionNeedsRekeyCustomThreshold(t *testing.T) {
+	session, _ := newTestSessionPair(t)
+	session.RekeyThreshold = 10
+	session.LocalSequenceNumber = 9
+
+	if session.NeedsRekey() {
+		t.Errorf("expected no rekey to be needed below a custom RekeyThreshold")
+	}
+
+	session.LocalSequenceNumber = 10
+
+	if !session.NeedsRekey() {
+		t.Errorf("expected a rekey to be needed at a custom RekeyThreshold")
+	}
+}
+
+func TestSessionEncryptRefusesPastSequenceNumberExhaustion(t *testing.T) {
+	session, _ := newTestSessionPair(t)
+
+	session.LocalSequenceNumber = math.MaxUint32
+
+	if _, err := session.Encrypt([]byte("hello")); !errors.Is(err, ErrRekeyRequired) {
+		t.Fatalf("expected ErrRekeyRequired, got: %v", err)
+	}
+
+	if session.LocalSequenceNumber != math.MaxUint32 {
+		t.Errorf("expected LocalSequenceNumber to stay at its ceiling, got %d", session.LocalSequenceNumber)
+	}
+}
+
+func TestSessionEncryptDecryptRoundTrip(t *testing.T) {
+	a, b := newTestSessionPair(t)
+
+	msg, err := a.Encrypt([]byte("hello, world"))
+
+	if err != nil {
+		t.Fatalf("a.Encrypt: %s", err)
+	}
+
+	cleartext, err := b.Decrypt(msg)
+
+	if err != nil {
+		t.Fatalf("b.Decrypt: %s", err)
+	}
+
+	if string(cleartext) != "hello, world" {
+		t.Errorf("expected %q, got %q", "hello, world", cleartext)
+	}
+}
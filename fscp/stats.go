@@ -0,0 +1,74 @@
+package fscp
+
+import "sync/atomic"
+
+// Stats is a snapshot of a Client's dispatch-loop activity, returned by
+// Client.Stats.
+type Stats struct {
+	// FramesReceived is the number of frames read off the transport.
+	FramesReceived uint64
+	// FramesDropped is the number of frames discarded instead of being
+	// delivered to a connection: because a per-peer rate limit was
+	// exceeded, a decode worker's queue was full, or a connection's
+	// incoming queue was full.
+	FramesDropped uint64
+	// PerPeerQueueDepth is the number of messages currently queued, but
+	// not yet read, for each connected peer, keyed by remote address.
+	PerPeerQueueDepth map[string]int
+}
+
+// clientStats holds the counters backing Client.Stats. The counters are
+// updated with atomic operations so the hot dispatch path never blocks on a
+// lock just to report metrics.
+type clientStats struct {
+	framesReceived uint64
+	framesDropped  uint64
+}
+
+func (s *clientStats) receivedFrame() {
+	atomic.AddUint64(&s.framesReceived, 1)
+}
+
+func (s *clientStats) droppedFrame() {
+	atomic.AddUint64(&s.framesDropped, 1)
+}
+
+func (s *clientStats) snapshot() (framesReceived, framesDropped uint64) {
+	return atomic.LoadUint64(&s.framesReceived), atomic.LoadUint64(&s.framesDropped)
+}
+
+// ConnStats is a snapshot of a Conn's decrypt-path counters, returned by
+// Conn.Stats.
+type ConnStats struct {
+	// Replays is the number of DATA messages dropped because their
+	// sequence number was a duplicate or fell outside the replay window
+	// (see ClientSecurity.ReplayWindowSize).
+	Replays uint64
+	// DecryptFailures is the number of DATA messages dropped because they
+	// failed AEAD authentication outright, which the replay window never
+	// gets a chance to evaluate.
+	DecryptFailures uint64
+}
+
+// connStats holds the counters backing Conn.Stats. Like clientStats, the
+// counters are updated with atomic operations so the dispatch loop never
+// blocks on a lock just to report metrics.
+type connStats struct {
+	replays         uint64
+	decryptFailures uint64
+}
+
+func (s *connStats) droppedReplay() {
+	atomic.AddUint64(&s.replays, 1)
+}
+
+func (s *connStats) droppedDecryptFailure() {
+	atomic.AddUint64(&s.decryptFailures, 1)
+}
+
+func (s *connStats) snapshot() ConnStats {
+	return ConnStats{
+		Replays:         atomic.LoadUint64(&s.replays),
+		DecryptFailures: atomic.LoadUint64(&s.decryptFailures),
+	}
+}
@@ -0,0 +1,54 @@
+package fscp
+
+// Tracer receives structured notifications about per-message FSCP protocol
+// events, in the spirit of net/http/httptrace.ClientTrace. Set one on
+// ClientSecurity to wire up Prometheus counters, OpenTelemetry spans, or
+// similar observability without forking the library.
+//
+// Hooks are called synchronously from Conn's read/write paths and from
+// Session's encrypt/decrypt path; implementations should return quickly.
+// A nil Tracer is valid and disables tracing.
+type Tracer interface {
+	// OnMessageSent is called after a message of the given type and
+	// serialized size (header included) has been written to the wire.
+	OnMessageSent(t MessageType, size int)
+
+	// OnMessageReceived is called after a message of the given type and
+	// serialized size (header included) has been parsed off the wire.
+	OnMessageReceived(t MessageType, size int)
+
+	// OnDecryptFailure is called when Session.Decrypt fails to
+	// authenticate a message's AEAD tag.
+	OnDecryptFailure(err error, seq SequenceNumber)
+
+	// OnReplayDropped is called when a message is dropped because its
+	// sequence number falls outside (or was already seen within) the
+	// replay window.
+	OnReplayDropped(seq SequenceNumber)
+
+	// OnRekey is called once a Conn swaps oldSession out for newSession.
+	OnRekey(oldSession, newSession *Session)
+}
+
+// discardTracer is the Tracer used whenever none was configured.
+type discardTracer struct{}
+
+func (discardTracer) OnMessageSent(t MessageType, size int) {}
+
+func (discardTracer) OnMessageReceived(t MessageType, size int) {}
+
+func (discardTracer) OnDecryptFailure(err error, seq SequenceNumber) {}
+
+func (discardTracer) OnReplayDropped(seq SequenceNumber) {}
+
+func (discardTracer) OnRekey(oldSession, newSession *Session) {}
+
+// traceOrDiscard returns t, or discardTracer{} if t is nil, so callers can
+// invoke hooks unconditionally.
+func traceOrDiscard(t Tracer) Tracer {
+	if t == nil {
+		return discardTracer{}
+	}
+
+	return t
+}
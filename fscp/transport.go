@@ -0,0 +1,30 @@
+package fscp
+
+import "context"
+
+// Transport abstracts the datagram link a Client exchanges FSCP messages
+// over, so that a Client no longer requires a real net.PacketConn: frames
+// can just as well travel over a stream connection (TCP, TLS), a WebSocket,
+// or an in-memory link used in tests.
+type Transport interface {
+	// ReadFrame reads a single incoming frame and the address it came
+	// from. It must unblock and return an error once Close is called.
+	ReadFrame(ctx context.Context) (b []byte, addr *Addr, err error)
+
+	// WriteFrame sends a single frame to addr.
+	WriteFrame(b []byte, addr *Addr) error
+
+	// LocalAddr returns the transport's local address.
+	LocalAddr() *Addr
+
+	// Close shuts the transport down, unblocking any pending ReadFrame.
+	Close() error
+}
+
+// bufferReleaser is an optional interface a Transport may implement when
+// the buffers it hands out from ReadFrame come from a pool: once the
+// caller is done with a frame, it calls releaseBuffer so the backing
+// array can be reused instead of left for the garbage collector.
+type bufferReleaser interface {
+	releaseBuffer(b []byte)
+}
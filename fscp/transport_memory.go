@@ -0,0 +1,117 @@
+package fscp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// InMemoryNetwork connects in-memory Transports directly to one another,
+// without going through a real socket, so that tests can exercise a Client
+// without binding real UDP ports.
+type InMemoryNetwork struct {
+	mu      sync.Mutex
+	sockets map[string]*inMemoryTransport
+}
+
+// NewInMemoryNetwork creates an empty InMemoryNetwork.
+func NewInMemoryNetwork() *InMemoryNetwork {
+	return &InMemoryNetwork{sockets: map[string]*inMemoryTransport{}}
+}
+
+// Listen creates a new Transport bound to addr on the network. addr must be
+// unique within the network.
+func (n *InMemoryNetwork) Listen(addr string) (Transport, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if _, ok := n.sockets[addr]; ok {
+		return nil, fmt.Errorf("address already in use: %s", addr)
+	}
+
+	t := &inMemoryTransport{
+		network: n,
+		addr:    &Addr{TransportAddr: inMemoryAddr(addr)},
+		inbox:   make(chan inMemoryFrame, 64),
+		closed:  make(chan struct{}),
+	}
+
+	n.sockets[addr] = t
+
+	return t, nil
+}
+
+func (n *InMemoryNetwork) deliver(addr string, frame inMemoryFrame) error {
+	n.mu.Lock()
+	t, ok := n.sockets[addr]
+	n.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("no such address on the in-memory network: %s", addr)
+	}
+
+	select {
+	case t.inbox <- frame:
+		return nil
+	case <-t.closed:
+		return io.EOF
+	}
+}
+
+func (n *InMemoryNetwork) remove(addr string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	delete(n.sockets, addr)
+}
+
+// inMemoryAddr is a net.Addr backed by a plain string, used to key an
+// InMemoryNetwork's sockets.
+type inMemoryAddr string
+
+func (a inMemoryAddr) Network() string { return "fscp-memory" }
+func (a inMemoryAddr) String() string  { return string(a) }
+
+type inMemoryFrame struct {
+	b    []byte
+	from *Addr
+}
+
+type inMemoryTransport struct {
+	network *InMemoryNetwork
+	addr    *Addr
+	inbox   chan inMemoryFrame
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func (t *inMemoryTransport) ReadFrame(ctx context.Context) ([]byte, *Addr, error) {
+	select {
+	case frame := <-t.inbox:
+		return frame.b, frame.from, nil
+	case <-t.closed:
+		return nil, nil, io.EOF
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+}
+
+func (t *inMemoryTransport) WriteFrame(b []byte, addr *Addr) error {
+	dup := make([]byte, len(b))
+	copy(dup, b)
+
+	return t.network.deliver(addr.String(), inMemoryFrame{b: dup, from: t.addr})
+}
+
+func (t *inMemoryTransport) LocalAddr() *Addr { return t.addr }
+
+func (t *inMemoryTransport) Close() error {
+	t.closeOnce.Do(func() {
+		close(t.closed)
+		t.network.remove(t.addr.String())
+	})
+
+	return nil
+}
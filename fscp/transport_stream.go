@@ -0,0 +1,80 @@
+package fscp
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+)
+
+// streamTransport adapts a single point-to-point net.Conn (TCP, TLS, ...)
+// into a Transport by length-prefixing each frame, since stream connections
+// carry no message boundaries of their own. Unlike udpTransport, a
+// streamTransport only ever talks to the single peer at the other end of
+// conn.
+type streamTransport struct {
+	conn       net.Conn
+	remoteAddr *Addr
+}
+
+// newStreamTransport wraps conn, a connection already established with a
+// single peer, into a Transport.
+func newStreamTransport(conn net.Conn) Transport {
+	return &streamTransport{
+		conn:       conn,
+		remoteAddr: &Addr{TransportAddr: conn.RemoteAddr()},
+	}
+}
+
+// maxStreamFrameSize bounds the length prefix read off a streamTransport, to
+// avoid trying to allocate an enormous buffer for a corrupt or malicious
+// length field.
+const maxStreamFrameSize = 1 << 20
+
+func (t *streamTransport) ReadFrame(ctx context.Context) ([]byte, *Addr, error) {
+	var lengthBuf [4]byte
+
+	if _, err := io.ReadFull(t.conn, lengthBuf[:]); err != nil {
+		return nil, nil, err
+	}
+
+	length := binary.BigEndian.Uint32(lengthBuf[:])
+
+	if length > maxStreamFrameSize {
+		return nil, nil, fmt.Errorf("frame of %d bytes exceeds the %d byte limit", length, maxStreamFrameSize)
+	}
+
+	b := make([]byte, length)
+
+	if _, err := io.ReadFull(t.conn, b); err != nil {
+		return nil, nil, err
+	}
+
+	return b, t.remoteAddr, nil
+}
+
+func (t *streamTransport) WriteFrame(b []byte, addr *Addr) error {
+	if addr.String() != t.remoteAddr.String() {
+		return fmt.Errorf("stream transport only talks to %s, not %s", t.remoteAddr, addr)
+	}
+
+	var lengthBuf [4]byte
+	binary.BigEndian.PutUint32(lengthBuf[:], uint32(len(b)))
+
+	if _, err := t.conn.Write(lengthBuf[:]); err != nil {
+		return err
+	}
+
+	_, err := t.conn.Write(b)
+
+	return err
+}
+
+func (t *streamTransport) LocalAddr() *Addr {
+	return &Addr{TransportAddr: t.conn.LocalAddr()}
+}
+
+func (t *streamTransport) Close() error {
+	return t.conn.Close()
+}
@@ -0,0 +1,27 @@
+package fscp
+
+import (
+	"context"
+	"net"
+)
+
+// NewTCPTransport wraps an already-established TCP connection into a
+// Transport, length-prefixing FSCP messages since TCP carries no message
+// boundaries of its own.
+func NewTCPTransport(conn *net.TCPConn) Transport {
+	return newStreamTransport(conn)
+}
+
+// DialTCPTransport dials addr over TCP and wraps the resulting connection
+// into a Transport.
+func DialTCPTransport(ctx context.Context, addr string) (Transport, error) {
+	var d net.Dialer
+
+	conn, err := d.DialContext(ctx, "tcp", addr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newStreamTransport(conn), nil
+}
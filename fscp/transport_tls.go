@@ -0,0 +1,27 @@
+package fscp
+
+import (
+	"context"
+	"crypto/tls"
+)
+
+// NewTLSTransport wraps an already-established TLS connection into a
+// Transport, length-prefixing FSCP messages since TLS, like the TCP stream
+// it rides on, carries no message boundaries of its own.
+func NewTLSTransport(conn *tls.Conn) Transport {
+	return newStreamTransport(conn)
+}
+
+// DialTLSTransport dials addr over TLS and wraps the resulting connection
+// into a Transport.
+func DialTLSTransport(ctx context.Context, addr string, config *tls.Config) (Transport, error) {
+	d := tls.Dialer{Config: config}
+
+	conn, err := d.DialContext(ctx, "tcp", addr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newStreamTransport(conn.(*tls.Conn)), nil
+}
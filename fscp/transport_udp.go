@@ -0,0 +1,61 @@
+package fscp
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+// udpMTU is the size of the receive buffers udpTransport pools: large
+// enough for the Ethernet-scale MTUs FSCP is typically deployed under.
+const udpMTU = 1500
+
+// udpTransport is the default Transport, wrapping an arbitrary
+// net.PacketConn (typically a UDP socket).
+type udpTransport struct {
+	conn net.PacketConn
+	pool sync.Pool
+}
+
+// NewUDPTransport wraps conn into a Transport.
+func NewUDPTransport(conn net.PacketConn) Transport {
+	t := &udpTransport{conn: conn}
+	t.pool.New = func() interface{} { return make([]byte, udpMTU) }
+
+	return t
+}
+
+func (t *udpTransport) ReadFrame(ctx context.Context) ([]byte, *Addr, error) {
+	b := t.pool.Get().([]byte)
+
+	n, addr, err := t.conn.ReadFrom(b)
+
+	if err != nil {
+		t.pool.Put(b)
+
+		return nil, nil, err
+	}
+
+	return b[:n], &Addr{TransportAddr: addr}, nil
+}
+
+// releaseBuffer returns b, as previously handed out by ReadFrame, to the
+// pool. b's capacity, not its length, is what matters, so it's safe to
+// call with a frame that was sliced down during decoding.
+func (t *udpTransport) releaseBuffer(b []byte) {
+	t.pool.Put(b[:cap(b)])
+}
+
+func (t *udpTransport) WriteFrame(b []byte, addr *Addr) error {
+	_, err := t.conn.WriteTo(b, addr.TransportAddr)
+
+	return err
+}
+
+func (t *udpTransport) LocalAddr() *Addr {
+	return &Addr{TransportAddr: t.conn.LocalAddr()}
+}
+
+func (t *udpTransport) Close() error {
+	return t.conn.Close()
+}
@@ -0,0 +1,68 @@
+package fscp
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gorilla/websocket"
+)
+
+// websocketTransport adapts a single point-to-point *websocket.Conn into a
+// Transport. Like streamTransport, it only ever talks to the peer at the
+// other end of the connection, but needs no extra framing: WebSocket
+// already delivers whole messages.
+type websocketTransport struct {
+	conn       *websocket.Conn
+	remoteAddr *Addr
+}
+
+// NewWebSocketTransport wraps an already-established WebSocket connection
+// into a Transport.
+func NewWebSocketTransport(conn *websocket.Conn) Transport {
+	return &websocketTransport{
+		conn:       conn,
+		remoteAddr: &Addr{TransportAddr: conn.RemoteAddr()},
+	}
+}
+
+// DialWebSocketTransport dials urlStr and wraps the resulting connection
+// into a Transport.
+func DialWebSocketTransport(ctx context.Context, urlStr string) (Transport, error) {
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, urlStr, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewWebSocketTransport(conn), nil
+}
+
+func (t *websocketTransport) ReadFrame(ctx context.Context) ([]byte, *Addr, error) {
+	messageType, b, err := t.conn.ReadMessage()
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if messageType != websocket.BinaryMessage {
+		return nil, nil, fmt.Errorf("unexpected WebSocket message type: %d", messageType)
+	}
+
+	return b, t.remoteAddr, nil
+}
+
+func (t *websocketTransport) WriteFrame(b []byte, addr *Addr) error {
+	if addr.String() != t.remoteAddr.String() {
+		return fmt.Errorf("WebSocket transport only talks to %s, not %s", t.remoteAddr, addr)
+	}
+
+	return t.conn.WriteMessage(websocket.BinaryMessage, b)
+}
+
+func (t *websocketTransport) LocalAddr() *Addr {
+	return &Addr{TransportAddr: t.conn.LocalAddr()}
+}
+
+func (t *websocketTransport) Close() error {
+	return t.conn.Close()
+}
@@ -0,0 +1,92 @@
+package vnettest
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// clock is a manually-advanced, deterministic stand-in for wall-clock time.
+// A Network schedules frame deliveries against it instead of relying on real
+// timers, so tests can move simulated time forward in a reproducible order
+// regardless of host scheduling jitter.
+type clock struct {
+	mu     sync.Mutex
+	now    time.Time
+	seq    uint64
+	events eventHeap
+}
+
+func newClock() *clock {
+	return &clock{now: time.Unix(0, 0)}
+}
+
+// Now returns the clock's current simulated time.
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// schedule runs fn once the clock has advanced past at least delay.
+func (c *clock) schedule(delay time.Duration, fn func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.seq++
+	heap.Push(&c.events, &event{at: c.now.Add(delay), seq: c.seq, run: fn})
+}
+
+// Advance moves the clock forward by d, running every event scheduled to
+// fire at or before the new time, in the order they become due.
+func (c *clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	target := c.now
+
+	var due []*event
+
+	for c.events.Len() > 0 && !c.events[0].at.After(target) {
+		due = append(due, heap.Pop(&c.events).(*event))
+	}
+	c.mu.Unlock()
+
+	for _, e := range due {
+		e.run()
+	}
+}
+
+type event struct {
+	at  time.Time
+	seq uint64
+	run func()
+}
+
+type eventHeap []*event
+
+func (h eventHeap) Len() int { return len(h) }
+
+func (h eventHeap) Less(i, j int) bool {
+	if h[i].at.Equal(h[j].at) {
+		return h[i].seq < h[j].seq
+	}
+
+	return h[i].at.Before(h[j].at)
+}
+
+func (h eventHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *eventHeap) Push(x interface{}) {
+	*h = append(*h, x.(*event))
+}
+
+func (h *eventHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+
+	return e
+}
@@ -0,0 +1,131 @@
+package vnettest
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/freelan-developers/go-freelan/fscp"
+)
+
+// Machine is a virtual endpoint on a Network. It implements fscp.Transport,
+// so it plugs directly into fscp.NewClient without ever touching a real
+// socket.
+type Machine struct {
+	network *Network
+	name    string
+	addr    *fscp.Addr
+
+	mu       sync.Mutex
+	nat      NATMode
+	sentTo   map[string]bool
+	mappings map[string]string
+
+	inbox     chan frame
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+type frame struct {
+	b    []byte
+	from *fscp.Addr
+}
+
+// Name returns the Machine's name, as given to Network.NewMachine.
+func (m *Machine) Name() string { return m.name }
+
+// SetNAT configures the kind of NAT the Machine simulates sitting behind.
+// It is safe to call at any time; it takes effect for frames sent or
+// filtered after the call returns.
+func (m *Machine) SetNAT(mode NATMode) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.nat = mode
+}
+
+// ReadFrame implements fscp.Transport.
+func (m *Machine) ReadFrame(ctx context.Context) ([]byte, *fscp.Addr, error) {
+	select {
+	case f := <-m.inbox:
+		return f.b, f.from, nil
+	case <-m.closed:
+		return nil, nil, io.EOF
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+}
+
+// WriteFrame implements fscp.Transport.
+func (m *Machine) WriteFrame(b []byte, addr *fscp.Addr) error {
+	toName := m.network.realName(addr.String())
+
+	return m.network.send(m, toName, b)
+}
+
+// LocalAddr implements fscp.Transport.
+func (m *Machine) LocalAddr() *fscp.Addr { return m.addr }
+
+// Close implements fscp.Transport.
+func (m *Machine) Close() error {
+	m.closeOnce.Do(func() {
+		close(m.closed)
+		m.network.removeMachine(m.name)
+	})
+
+	return nil
+}
+
+// publicAddrFor records that m is sending a frame to toName and returns the
+// address the Network should present to toName as m's source, honoring m's
+// NAT mode: a shared mapping reused for every destination, or, for
+// NATSymmetric, a fresh mapping per destination.
+func (m *Machine) publicAddrFor(toName string) *fscp.Addr {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.sentTo == nil {
+		m.sentTo = map[string]bool{}
+	}
+	m.sentTo[toName] = true
+
+	if !m.nat.restrictsMapping() {
+		return m.addr
+	}
+
+	if m.mappings == nil {
+		m.mappings = map[string]string{}
+	}
+
+	label, ok := m.mappings[toName]
+
+	if !ok {
+		label = m.name + "~" + toName
+		m.mappings[toName] = label
+	}
+
+	return &fscp.Addr{TransportAddr: machineAddr(label)}
+}
+
+// acceptsFrom reports whether m's NAT lets a frame from fromName through:
+// true for NATNone and NATEndpointIndependent, and otherwise only once m
+// has itself sent a frame to fromName, mirroring a NAT hole that only opens
+// once the internal host talks to the external peer first.
+func (m *Machine) acceptsFrom(fromName string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.nat.restrictsFiltering() {
+		return true
+	}
+
+	return m.sentTo[fromName]
+}
+
+// machineAddr is a net.Addr backed by a plain string: either a Machine's
+// bare name, or, for a Machine behind a NATSymmetric mapping, a
+// "name~destination" label that realName can unwrap.
+type machineAddr string
+
+func (a machineAddr) Network() string { return "vnettest" }
+func (a machineAddr) String() string  { return string(a) }
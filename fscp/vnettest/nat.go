@@ -0,0 +1,61 @@
+package vnettest
+
+import "fmt"
+
+// NATMode describes how a Machine's simulated NAT translates and filters
+// traffic, mirroring the classic STUN/RFC 3489 cone taxonomy.
+type NATMode int
+
+const (
+	// NATNone means the Machine sits directly on the Network: its address
+	// is visible as-is and any peer can reach it.
+	NATNone NATMode = iota
+	// NATEndpointIndependent ("full cone") reuses a single public mapping
+	// for every destination and accepts inbound traffic from any peer once
+	// that mapping exists.
+	NATEndpointIndependent
+	// NATAddressDependent ("restricted cone") reuses a single public
+	// mapping for every destination, but only accepts inbound traffic from
+	// a peer the Machine has already sent a packet to.
+	NATAddressDependent
+	// NATAddressAndPortDependent ("port-restricted cone") behaves like
+	// NATAddressDependent. This harness models a Machine as a single
+	// socket with no finer-grained port identity, so it cannot distinguish
+	// a peer's address from a peer's address-and-port; it is kept as its
+	// own constant so tests can still name the intent they're simulating.
+	NATAddressAndPortDependent
+	// NATSymmetric assigns a fresh public mapping per destination and, like
+	// NATAddressDependent, only accepts inbound traffic from a peer the
+	// Machine has already sent a packet to. Which of its mappings an
+	// inbound frame was addressed to is not checked.
+	NATSymmetric
+)
+
+func (m NATMode) String() string {
+	switch m {
+	case NATNone:
+		return "none"
+	case NATEndpointIndependent:
+		return "endpoint-independent"
+	case NATAddressDependent:
+		return "address-dependent"
+	case NATAddressAndPortDependent:
+		return "address-and-port-dependent"
+	case NATSymmetric:
+		return "symmetric"
+	default:
+		return fmt.Sprintf("NATMode(%d)", int(m))
+	}
+}
+
+// restrictsMapping reports whether m hands out a distinct public mapping
+// per destination, rather than reusing one mapping for every destination.
+func (m NATMode) restrictsMapping() bool {
+	return m == NATSymmetric
+}
+
+// restrictsFiltering reports whether m only accepts inbound traffic from
+// peers the Machine has already sent a packet to.
+func (m NATMode) restrictsFiltering() bool {
+	return m != NATNone && m != NATEndpointIndependent
+}
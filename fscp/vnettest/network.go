@@ -0,0 +1,256 @@
+// Package vnettest provides an in-process virtual network for exercising
+// fscp.Client topologies under controlled, reproducible network conditions.
+// It is modeled after the tailscale/natlab vnet design: a central Network
+// demuxes frames between virtual Machines, each of which implements
+// fscp.Transport and so plugs directly into fscp.NewClient. Per-link
+// latency, jitter, loss, MTU, duplication, reordering and NAT behavior are
+// all configurable, and simulated time only advances when a test calls
+// Network.Advance, so handshake and renegotiation logic can be tested
+// deterministically.
+package vnettest
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/freelan-developers/go-freelan/fscp"
+)
+
+// LinkConfig describes the simulated properties of the link between two
+// Machines on a Network. The zero value is a perfect, lossless link.
+type LinkConfig struct {
+	// Latency is the one-way propagation delay applied to every frame.
+	Latency time.Duration
+	// Jitter adds a random delay in [0, Jitter) on top of Latency.
+	Jitter time.Duration
+	// Loss is the probability, in [0, 1], that a frame is dropped outright.
+	Loss float64
+	// MTU, if non-zero, causes frames larger than it to be dropped.
+	MTU int
+	// Duplicate is the probability, in [0, 1], that a frame is delivered
+	// twice.
+	Duplicate float64
+	// Reorder is the probability, in [0, 1], that a frame is delayed long
+	// enough that a frame sent right after it can overtake it.
+	Reorder float64
+}
+
+// Network is a virtual network of Machines. It is safe for concurrent use.
+type Network struct {
+	clock *clock
+
+	mu         sync.Mutex
+	rng        *rand.Rand
+	machines   map[string]*Machine
+	links      map[linkKey]LinkConfig
+	partitions map[linkKey]bool
+}
+
+// NewNetwork creates an empty Network. seed seeds the pseudo-random source
+// used to decide jitter, loss, duplication and reordering, so that a given
+// seed always drives a test through the exact same sequence of events.
+func NewNetwork(seed int64) *Network {
+	return &Network{
+		clock:      newClock(),
+		rng:        rand.New(rand.NewSource(seed)),
+		machines:   map[string]*Machine{},
+		links:      map[linkKey]LinkConfig{},
+		partitions: map[linkKey]bool{},
+	}
+}
+
+// Advance moves the Network's simulated clock forward by d, delivering any
+// frame whose simulated transit time has elapsed as of the new time.
+func (n *Network) Advance(d time.Duration) {
+	n.clock.Advance(d)
+}
+
+// Now returns the Network's current simulated time.
+func (n *Network) Now() time.Time {
+	return n.clock.Now()
+}
+
+// NewMachine creates a Machine named name, behind no NAT, and registers it
+// on the Network. name must be unique within the Network and must not
+// contain '~'. The returned Machine implements fscp.Transport and can be
+// passed directly to fscp.NewClient.
+func (n *Network) NewMachine(name string) *Machine {
+	m := &Machine{
+		network: n,
+		name:    name,
+		addr:    &fscp.Addr{TransportAddr: machineAddr(name)},
+		inbox:   make(chan frame, 256),
+		closed:  make(chan struct{}),
+	}
+
+	n.mu.Lock()
+	n.machines[name] = m
+	n.mu.Unlock()
+
+	return m
+}
+
+func (n *Network) removeMachine(name string) {
+	n.mu.Lock()
+	delete(n.machines, name)
+	n.mu.Unlock()
+}
+
+func (n *Network) machine(name string) *Machine {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return n.machines[name]
+}
+
+// SetLink configures the simulated properties of the link between a and b.
+// A link is symmetric: its properties apply to traffic flowing in either
+// direction.
+func (n *Network) SetLink(a, b string, config LinkConfig) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.links[newLinkKey(a, b)] = config
+}
+
+// SetLoss overrides the loss probability of the link between a and b,
+// leaving its other properties untouched.
+func (n *Network) SetLoss(a, b string, p float64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	key := newLinkKey(a, b)
+	config := n.links[key]
+	config.Loss = p
+	n.links[key] = config
+}
+
+// Partition cuts the link between a and b: frames sent between them are
+// dropped until Restore is called.
+func (n *Network) Partition(a, b string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.partitions[newLinkKey(a, b)] = true
+}
+
+// Restore heals a link previously cut with Partition.
+func (n *Network) Restore(a, b string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	delete(n.partitions, newLinkKey(a, b))
+}
+
+func (n *Network) linkConfig(a, b string) LinkConfig {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return n.links[newLinkKey(a, b)]
+}
+
+func (n *Network) isPartitioned(a, b string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return n.partitions[newLinkKey(a, b)]
+}
+
+// realName resolves a (possibly NAT-mapped) address label back to the real
+// name of the Machine that owns it.
+func (n *Network) realName(label string) string {
+	if i := strings.IndexByte(label, '~'); i >= 0 {
+		return label[:i]
+	}
+
+	return label
+}
+
+// send routes a frame written by from towards toName, applying the link's
+// simulated latency, jitter, loss, MTU, duplication and reordering, as well
+// as from's and the destination's NAT behavior.
+func (n *Network) send(from *Machine, toName string, b []byte) error {
+	to := n.machine(toName)
+
+	if to == nil {
+		return fmt.Errorf("vnettest: no such machine: %s", toName)
+	}
+
+	if n.isPartitioned(from.name, toName) {
+		return nil
+	}
+
+	config := n.linkConfig(from.name, toName)
+
+	if config.MTU > 0 && len(b) > config.MTU {
+		return nil
+	}
+
+	n.mu.Lock()
+	dropped := config.Loss > 0 && n.rng.Float64() < config.Loss
+	duplicate := config.Duplicate > 0 && n.rng.Float64() < config.Duplicate
+	reorder := config.Reorder > 0 && n.rng.Float64() < config.Reorder
+	jitter := jitterDelay(n.rng, config.Jitter)
+	n.mu.Unlock()
+
+	if dropped {
+		return nil
+	}
+
+	publicAddr := from.publicAddrFor(toName)
+	payload := make([]byte, len(b))
+	copy(payload, b)
+
+	deliver := func() {
+		if !to.acceptsFrom(from.name) {
+			return
+		}
+
+		select {
+		case to.inbox <- frame{b: payload, from: publicAddr}:
+		default:
+			// The destination's inbox is full: simulate the packet being
+			// dropped the way a real socket's receive buffer would
+			// overflow.
+		}
+	}
+
+	delay := config.Latency + jitter
+
+	if reorder {
+		// Delay this frame well past a frame sent right after it, so that
+		// the later one overtakes it.
+		delay += config.Latency + jitter + time.Millisecond
+	}
+
+	n.clock.schedule(delay, deliver)
+
+	if duplicate {
+		n.clock.schedule(config.Latency+jitter, deliver)
+	}
+
+	return nil
+}
+
+func jitterDelay(rng *rand.Rand, jitter time.Duration) time.Duration {
+	if jitter <= 0 {
+		return 0
+	}
+
+	return time.Duration(rng.Int63n(int64(jitter)))
+}
+
+type linkKey struct {
+	a, b string
+}
+
+func newLinkKey(a, b string) linkKey {
+	if a > b {
+		a, b = b, a
+	}
+
+	return linkKey{a, b}
+}
@@ -0,0 +1,197 @@
+package vnettest
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func mustRead(t *testing.T, m *Machine, timeout time.Duration) ([]byte, string) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	b, addr, err := m.ReadFrame(ctx)
+
+	if err != nil {
+		t.Fatalf("expected no error: %s", err)
+	}
+
+	return b, addr.String()
+}
+
+func mustNotRead(t *testing.T, m *Machine) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+
+	if _, _, err := m.ReadFrame(ctx); err == nil {
+		t.Fatalf("expected no frame to be delivered")
+	}
+}
+
+func TestNetworkDeliversFrames(t *testing.T) {
+	network := NewNetwork(1)
+	a := network.NewMachine("a")
+	b := network.NewMachine("b")
+
+	if err := a.WriteFrame([]byte("hello"), b.LocalAddr()); err != nil {
+		t.Fatalf("expected no error: %s", err)
+	}
+
+	network.Advance(0)
+
+	msg, from := mustRead(t, b, time.Millisecond*20)
+
+	if string(msg) != "hello" {
+		t.Errorf("expected `hello`, got `%s`", string(msg))
+	}
+
+	if from != a.LocalAddr().String() {
+		t.Errorf("expected frame to come from %s, got %s", a.LocalAddr(), from)
+	}
+}
+
+func TestNetworkAppliesLatency(t *testing.T) {
+	network := NewNetwork(1)
+	a := network.NewMachine("a")
+	b := network.NewMachine("b")
+
+	network.SetLink("a", "b", LinkConfig{Latency: time.Second})
+
+	if err := a.WriteFrame([]byte("hello"), b.LocalAddr()); err != nil {
+		t.Fatalf("expected no error: %s", err)
+	}
+
+	network.Advance(time.Millisecond * 500)
+	mustNotRead(t, b)
+
+	network.Advance(time.Second)
+	mustRead(t, b, time.Millisecond*20)
+}
+
+func TestNetworkPartitionDropsFrames(t *testing.T) {
+	network := NewNetwork(1)
+	a := network.NewMachine("a")
+	b := network.NewMachine("b")
+
+	network.Partition("a", "b")
+
+	if err := a.WriteFrame([]byte("hello"), b.LocalAddr()); err != nil {
+		t.Fatalf("expected no error: %s", err)
+	}
+
+	network.Advance(time.Second)
+	mustNotRead(t, b)
+
+	network.Restore("a", "b")
+
+	if err := a.WriteFrame([]byte("hello"), b.LocalAddr()); err != nil {
+		t.Fatalf("expected no error: %s", err)
+	}
+
+	network.Advance(0)
+	mustRead(t, b, time.Millisecond*20)
+}
+
+func TestNetworkLossDropsFrames(t *testing.T) {
+	network := NewNetwork(1)
+	a := network.NewMachine("a")
+	b := network.NewMachine("b")
+
+	network.SetLoss("a", "b", 1)
+
+	if err := a.WriteFrame([]byte("hello"), b.LocalAddr()); err != nil {
+		t.Fatalf("expected no error: %s", err)
+	}
+
+	network.Advance(0)
+	mustNotRead(t, b)
+}
+
+func TestNetworkMTUDropsOversizedFrames(t *testing.T) {
+	network := NewNetwork(1)
+	a := network.NewMachine("a")
+	b := network.NewMachine("b")
+
+	network.SetLink("a", "b", LinkConfig{MTU: 4})
+
+	if err := a.WriteFrame([]byte("hello"), b.LocalAddr()); err != nil {
+		t.Fatalf("expected no error: %s", err)
+	}
+
+	network.Advance(0)
+	mustNotRead(t, b)
+}
+
+func TestNetworkDuplicateRedeliversFrames(t *testing.T) {
+	network := NewNetwork(1)
+	a := network.NewMachine("a")
+	b := network.NewMachine("b")
+
+	network.SetLink("a", "b", LinkConfig{Duplicate: 1})
+
+	if err := a.WriteFrame([]byte("hello"), b.LocalAddr()); err != nil {
+		t.Fatalf("expected no error: %s", err)
+	}
+
+	network.Advance(0)
+	mustRead(t, b, time.Millisecond*20)
+	mustRead(t, b, time.Millisecond*20)
+}
+
+func TestNATAddressDependentFiltersUnsolicitedInbound(t *testing.T) {
+	network := NewNetwork(1)
+	a := network.NewMachine("a")
+	b := network.NewMachine("b")
+	b.SetNAT(NATAddressDependent)
+
+	if err := a.WriteFrame([]byte("hello"), b.LocalAddr()); err != nil {
+		t.Fatalf("expected no error: %s", err)
+	}
+
+	network.Advance(0)
+	mustNotRead(t, b)
+
+	// Once b sends to a, the hole is open and a's traffic gets through.
+	if err := b.WriteFrame([]byte("hi"), a.LocalAddr()); err != nil {
+		t.Fatalf("expected no error: %s", err)
+	}
+
+	network.Advance(0)
+	mustRead(t, a, time.Millisecond*20)
+
+	if err := a.WriteFrame([]byte("hello"), b.LocalAddr()); err != nil {
+		t.Fatalf("expected no error: %s", err)
+	}
+
+	network.Advance(0)
+	mustRead(t, b, time.Millisecond*20)
+}
+
+func TestNATSymmetricAssignsPerDestinationMapping(t *testing.T) {
+	network := NewNetwork(1)
+	a := network.NewMachine("a")
+	a.SetNAT(NATSymmetric)
+	b := network.NewMachine("b")
+	c := network.NewMachine("c")
+
+	if err := a.WriteFrame([]byte("hello"), b.LocalAddr()); err != nil {
+		t.Fatalf("expected no error: %s", err)
+	}
+
+	if err := a.WriteFrame([]byte("hello"), c.LocalAddr()); err != nil {
+		t.Fatalf("expected no error: %s", err)
+	}
+
+	network.Advance(0)
+
+	_, fromB := mustRead(t, b, time.Millisecond*20)
+	_, fromC := mustRead(t, c, time.Millisecond*20)
+
+	if fromB == fromC {
+		t.Errorf("expected distinct public mappings for b and c, got %s for both", fromB)
+	}
+}
@@ -1,17 +1,77 @@
 package routing
 
-import "net"
+import (
+	"context"
+	"errors"
+	"net"
+)
 
 // A Router provides facilities to manipulate the operating-system's routing
 // table.
 type Router interface {
 	// AddRoute adds a network route.
 	//
-	// The first returned value indicates whether the route was added.
+	// The first returned value indicates whether the route was added. If
+	// the route was already present, AddRoute returns (false,
+	// ErrRouteExists) rather than failing.
 	AddRoute(network *net.IPNet, gateway net.IP) (bool, error)
 
 	// DeleteRoute deletes a network route.
 	//
-	// The first returned value indicates whether the route was added.
+	// The first returned value indicates whether the route was deleted. If
+	// the route was already absent, DeleteRoute returns (false,
+	// ErrRouteNotFound) rather than failing.
 	DeleteRoute(network *net.IPNet, gateway net.IP) (bool, error)
 }
+
+// ErrRouteExists is returned by AddRoute when the requested route is
+// already present in the routing table.
+var ErrRouteExists = errors.New("route already exists")
+
+// ErrRouteNotFound is returned by DeleteRoute when the requested route is
+// not present in the routing table.
+var ErrRouteNotFound = errors.New("route not found")
+
+// Route describes a single entry of the operating system's routing table.
+type Route struct {
+	Network *net.IPNet
+	Gateway net.IP
+}
+
+// RouteEventType identifies the kind of change a RouteEvent carries.
+type RouteEventType int
+
+const (
+	// RouteAdded indicates a route was added to the routing table.
+	RouteAdded RouteEventType = iota
+	// RouteDeleted indicates a route was removed from the routing table.
+	RouteDeleted
+)
+
+// RouteEvent describes a single change to the operating system's routing
+// table, as reported by a RouteMonitor.
+type RouteEvent struct {
+	Type  RouteEventType
+	Route Route
+}
+
+// A RouteLister can enumerate the operating system's routing table.
+//
+// Router implementations may optionally implement it; callers should use a
+// type assertion to check for support.
+type RouteLister interface {
+	// ListRoutes returns the routes currently present in the operating
+	// system's routing table.
+	ListRoutes() ([]Route, error)
+}
+
+// A RouteMonitor can stream changes to the operating system's routing
+// table.
+//
+// Router implementations may optionally implement it; callers should use a
+// type assertion to check for support.
+type RouteMonitor interface {
+	// MonitorRoutes streams route additions and deletions until ctx is
+	// done, at which point the returned channel is closed.
+	MonitorRoutes(ctx context.Context) (<-chan RouteEvent, error)
+}
@@ -1,16 +1,15 @@
 package routing
 
 import (
-	"bufio"
-	"bytes"
+	"encoding/binary"
 	"fmt"
 	"net"
-	"os/exec"
-	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
 )
 
-type routerImpl struct {
-}
+type routerImpl struct{}
 
 // NewRouter instanciates a new router.
 func NewRouter() Router {
@@ -18,67 +17,375 @@ func NewRouter() Router {
 }
 
 func (r *routerImpl) AddRoute(network *net.IPNet, gateway net.IP) (bool, error) {
-	args := []string{
-		"-n",
-		"add",
-		"-net",
-		network.String(),
-		gateway.String(),
+	if err := sendRouteMessage(unix.RTM_ADD, network, gateway); err != nil {
+		if err == unix.EEXIST {
+			return false, ErrRouteExists
+		}
+
+		return false, fmt.Errorf("adding route %s -> %s: %s", network, gateway, err)
+	}
+
+	return true, nil
+}
+
+func (r *routerImpl) DeleteRoute(network *net.IPNet, gateway net.IP) (bool, error) {
+	if err := sendRouteMessage(unix.RTM_DELETE, network, gateway); err != nil {
+		if err == unix.ESRCH {
+			return false, ErrRouteNotFound
+		}
+
+		return false, fmt.Errorf("deleting route %s -> %s: %s", network, gateway, err)
 	}
-	cmd := exec.Command("route", args...)
-	b, err := cmd.CombinedOutput()
+
+	return true, nil
+}
+
+// ListRoutes returns the routes currently present in the kernel's routing
+// table, across both address families, read out via a NET_RT_DUMP sysctl
+// over the same PF_ROUTE address family AddRoute and DeleteRoute use.
+func (r *routerImpl) ListRoutes() ([]Route, error) {
+	b, err := sysctlRouteDump()
 
 	if err != nil {
-		return false, fmt.Errorf("adding route %s -> %s: %s", network, gateway, err)
+		return nil, fmt.Errorf("listing routes: %s", err)
 	}
 
-	scanner := bufio.NewScanner(bytes.NewBuffer(b))
+	return parseRouteDump(b), nil
+}
+
+// routeSeq is incremented for every PF_ROUTE message this process sends,
+// so the kernel's echoed reply (delivered back to every open routing
+// socket) can be matched to the request that caused it.
+var routeSeq int32
+
+// sendRouteMessage sends a single RTM_ADD/RTM_DELETE message for network
+// via gateway over a PF_ROUTE socket and waits for the kernel's echoed
+// reply.
+func sendRouteMessage(msgType int, network *net.IPNet, gateway net.IP) error {
+	fd, err := unix.Socket(unix.AF_ROUTE, unix.SOCK_RAW, unix.AF_UNSPEC)
 
-	if !scanner.Scan() {
-		return false, fmt.Errorf("adding route %s -> %s: unexpected output (%s)", network, gateway, string(b))
+	if err != nil {
+		return fmt.Errorf("opening the routing socket: %s", err)
 	}
 
-	if strings.HasPrefix(scanner.Text(), "route: ") {
-		// This is as reliable as it can be...
-		if strings.HasSuffix(scanner.Text(), "File exists") {
-			return false, nil
-		}
+	defer unix.Close(fd)
 
-		return false, fmt.Errorf("adding route %s -> %s: %s", network, gateway, scanner.Text())
+	routeSeq++
+	seq := routeSeq
+	pid := int32(unix.Getpid())
+
+	msg, err := buildRouteMessage(msgType, seq, pid, network, gateway)
+
+	if err != nil {
+		return err
 	}
 
-	return true, nil
+	if _, err := unix.Write(fd, msg); err != nil {
+		return fmt.Errorf("writing the routing message: %s", err)
+	}
+
+	buf := make([]byte, unix.SizeofRtMsghdr+512)
+
+	for {
+		n, err := unix.Read(fd, buf)
+
+		if err != nil {
+			return fmt.Errorf("reading the routing message reply: %s", err)
+		}
+
+		if n < unix.SizeofRtMsghdr {
+			continue
+		}
+
+		hdr := (*unix.RtMsghdr)(unsafe.Pointer(&buf[0]))
+
+		if hdr.Pid != pid || hdr.Seq != seq {
+			continue
+		}
+
+		if hdr.Errno != 0 {
+			return unix.Errno(hdr.Errno)
+		}
+
+		return nil
+	}
 }
 
-func (r *routerImpl) DeleteRoute(network *net.IPNet, gateway net.IP) (bool, error) {
-	args := []string{
-		"-n",
-		"delete",
-		"-net",
-		network.String(),
-		gateway.String(),
+// buildRouteMessage encodes a rt_msghdr followed by its RTAX_DST,
+// RTAX_GATEWAY, RTAX_NETMASK sockaddrs, the address triple a PF_ROUTE
+// socket expects for RTM_ADD/RTM_DELETE. Unlike tuntap's per-interface
+// routes, a routing.Router route always carries an explicit gateway, so
+// RTF_GATEWAY is set unconditionally and no interface index is bound.
+func buildRouteMessage(msgType int, seq int32, pid int32, network *net.IPNet, gateway net.IP) ([]byte, error) {
+	v4 := network.IP.To4() != nil
+
+	dstSA, err := routeSockaddr(network.IP, v4)
+
+	if err != nil {
+		return nil, err
 	}
-	cmd := exec.Command("route", args...)
-	b, err := cmd.CombinedOutput()
+
+	gwSA, err := routeSockaddr(gateway, v4)
 
 	if err != nil {
-		return false, fmt.Errorf("deleting route %s -> %s: %s", network, gateway, err)
+		return nil, err
 	}
 
-	scanner := bufio.NewScanner(bytes.NewBuffer(b))
+	maskSA := routeNetmaskSockaddr(network.Mask, v4)
 
-	if !scanner.Scan() {
-		return false, fmt.Errorf("deleting route %s -> %s: unexpected output (%s)", network, gateway, string(b))
+	body := append(append([]byte{}, dstSA...), gwSA...)
+	body = append(body, maskSA...)
+
+	hdr := unix.RtMsghdr{
+		Version: unix.RTM_VERSION,
+		Type:    uint8(msgType),
+		Flags:   unix.RTF_STATIC | unix.RTF_UP | unix.RTF_GATEWAY,
+		Addrs:   unix.RTA_DST | unix.RTA_GATEWAY | unix.RTA_NETMASK,
+		Pid:     pid,
+		Seq:     seq,
 	}
 
-	if strings.HasPrefix(scanner.Text(), "route: ") {
-		// This is as reliable as it can be...
-		if strings.HasSuffix(scanner.Text(), "not in table") {
-			return false, nil
+	hdrBytes := (*[unix.SizeofRtMsghdr]byte)(unsafe.Pointer(&hdr))[:]
+	msg := append(append([]byte{}, hdrBytes...), body...)
+
+	binary.LittleEndian.PutUint16(msg[0:2], uint16(len(msg)))
+
+	return msg, nil
+}
+
+// routeSockaddrAlign is the alignment PF_ROUTE requires between
+// consecutive sockaddrs within a routing message, mirroring the BSD
+// kernel's ROUNDUP macro.
+const routeSockaddrAlign = 4
+
+// routeSockaddr encodes ip as a raw sockaddr_in or sockaddr_in6, as used
+// by RTAX_DST/RTAX_GATEWAY.
+func routeSockaddr(ip net.IP, v4 bool) ([]byte, error) {
+	if v4 {
+		addr := ip.To4()
+
+		if addr == nil {
+			return nil, fmt.Errorf("expected an IPv4 address, got %s", ip)
 		}
 
-		return false, fmt.Errorf("deleting route %s -> %s: %s", network, gateway, scanner.Text())
+		sa := make([]byte, roundupRouteSockaddr(16))
+		sa[0] = 16
+		sa[1] = unix.AF_INET
+		copy(sa[4:8], addr)
+
+		return sa, nil
 	}
 
-	return true, nil
+	addr := ip.To16()
+
+	if addr == nil {
+		return nil, fmt.Errorf("expected an IPv6 address, got %s", ip)
+	}
+
+	sa := make([]byte, roundupRouteSockaddr(28))
+	sa[0] = 28
+	sa[1] = unix.AF_INET6
+	copy(sa[8:24], addr)
+
+	return sa, nil
+}
+
+// routeNetmaskSockaddr encodes mask as a sockaddr, as used by
+// RTAX_NETMASK. The kernel accepts a netmask sockaddr truncated to its
+// significant bytes, but a fixed, fully-sized one is simpler to both
+// build and parse back.
+func routeNetmaskSockaddr(mask net.IPMask, v4 bool) []byte {
+	if v4 {
+		sa := make([]byte, roundupRouteSockaddr(16))
+		sa[0] = 16
+		sa[1] = unix.AF_INET
+		copy(sa[4:8], mask)
+
+		return sa
+	}
+
+	sa := make([]byte, roundupRouteSockaddr(28))
+	sa[0] = 28
+	sa[1] = unix.AF_INET6
+	copy(sa[8:24], mask)
+
+	return sa
+}
+
+func roundupRouteSockaddr(n int) int {
+	if n <= 0 {
+		return routeSockaddrAlign
+	}
+
+	return (n + routeSockaddrAlign - 1) &^ (routeSockaddrAlign - 1)
+}
+
+// sysctlRouteDump reads the whole kernel routing table via a
+// {CTL_NET, AF_ROUTE, 0, AF_UNSPEC, NET_RT_DUMP, 0} sysctl.
+//
+// NET_RT_DUMP has no name unix.Sysctl can resolve, so this calls
+// __sysctl(2) directly with the numeric MIB, following the same two-call
+// (size, then read) convention unix.SysctlRaw uses for named sysctls.
+func sysctlRouteDump() ([]byte, error) {
+	mib := [6]int32{unix.CTL_NET, unix.AF_ROUTE, 0, unix.AF_UNSPEC, unix.NET_RT_DUMP, 0}
+
+	var n uintptr
+
+	if err := rawSysctl(&mib[0], len(mib), nil, &n); err != nil {
+		return nil, fmt.Errorf("sizing the route dump: %s", err)
+	}
+
+	if n == 0 {
+		return nil, nil
+	}
+
+	buf := make([]byte, n)
+
+	if err := rawSysctl(&mib[0], len(mib), &buf[0], &n); err != nil {
+		return nil, fmt.Errorf("reading the route dump: %s", err)
+	}
+
+	return buf[:n], nil
+}
+
+func rawSysctl(mib *int32, mibLen int, out *byte, outLen *uintptr) error {
+	_, _, errno := unix.Syscall6(
+		unix.SYS___SYSCTL,
+		uintptr(unsafe.Pointer(mib)),
+		uintptr(mibLen),
+		uintptr(unsafe.Pointer(out)),
+		uintptr(unsafe.Pointer(outLen)),
+		0,
+		0,
+	)
+
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
+
+// parseRouteDump walks a NET_RT_DUMP buffer and returns every route it
+// contains.
+func parseRouteDump(b []byte) []Route {
+	var routes []Route
+
+	for len(b) >= unix.SizeofRtMsghdr {
+		hdr := (*unix.RtMsghdr)(unsafe.Pointer(&b[0]))
+		msgLen := int(hdr.Msglen)
+
+		if msgLen <= 0 || msgLen > len(b) {
+			break
+		}
+
+		if route, ok := parseRouteAddrs(hdr.Addrs, b[unix.SizeofRtMsghdr:msgLen]); ok {
+			routes = append(routes, route)
+		}
+
+		b = b[msgLen:]
+	}
+
+	return routes
+}
+
+// Bit positions of the RTAX_* addresses within a rt_msghdr's Addrs mask,
+// in the order the kernel lays out the corresponding sockaddrs.
+const (
+	rtaxDst = iota
+	rtaxGateway
+	rtaxNetmask
+)
+
+// parseRouteAddrs decodes the sockaddrs following a rt_msghdr into a
+// Route. ok is false when no RTAX_DST address is present.
+func parseRouteAddrs(addrs int32, b []byte) (Route, bool) {
+	var dst, gateway net.IP
+	var bits int
+	var maskBytes []byte
+	haveDst := false
+
+	for i := 0; i < 8 && len(b) > 0; i++ {
+		if addrs&(1<<uint(i)) == 0 {
+			continue
+		}
+
+		saLen := int(b[0])
+
+		if saLen == 0 {
+			saLen = routeSockaddrAlign
+		}
+
+		if saLen > len(b) {
+			break
+		}
+
+		switch i {
+		case rtaxDst:
+			if ip, ipBits, ok := parseRouteSockaddr(b[:saLen]); ok {
+				dst = ip
+				bits = ipBits
+				haveDst = true
+			}
+		case rtaxGateway:
+			if ip, _, ok := parseRouteSockaddr(b[:saLen]); ok {
+				gateway = ip
+			}
+		case rtaxNetmask:
+			// RTAX_NETMASK sockaddrs are commonly truncated to their
+			// significant bytes; pad with zeroes out to the address
+			// family's full width before treating it as a mask.
+			// The mask sits where the address would: offset 4 in a
+			// sockaddr_in, offset 8 in a sockaddr_in6.
+			off := 4
+
+			if bits == 128 {
+				off = 8
+			}
+
+			if saLen > off {
+				maskBytes = append([]byte{}, b[off:saLen]...)
+			}
+		}
+
+		b = b[roundupRouteSockaddr(saLen):]
+	}
+
+	if !haveDst {
+		return Route{}, false
+	}
+
+	mask := make(net.IPMask, bits/8)
+	copy(mask, maskBytes)
+	ones, _ := mask.Size()
+
+	return Route{
+		Network: &net.IPNet{IP: dst, Mask: net.CIDRMask(ones, bits)},
+		Gateway: gateway,
+	}, true
+}
+
+// parseRouteSockaddr decodes a sockaddr_in/sockaddr_in6 into its address
+// and bit length.
+func parseRouteSockaddr(sa []byte) (net.IP, int, bool) {
+	if len(sa) < 2 {
+		return nil, 0, false
+	}
+
+	switch sa[1] {
+	case unix.AF_INET:
+		if len(sa) < 8 {
+			return nil, 0, false
+		}
+
+		return net.IP(sa[4:8]), 32, true
+	case unix.AF_INET6:
+		if len(sa) < 24 {
+			return nil, 0, false
+		}
+
+		return net.IP(sa[8:24]), 128, true
+	default:
+		return nil, 0, false
+	}
 }
@@ -1,6 +1,15 @@
 package routing
 
-import "net"
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
 
 type routerImpl struct{}
 
@@ -10,9 +19,409 @@ func NewRouter() Router {
 }
 
 func (r *routerImpl) AddRoute(network *net.IPNet, gateway net.IP) (bool, error) {
-	return false, nil
+	if err := sendRouteRequest(unix.RTM_NEWROUTE, unix.NLM_F_CREATE|unix.NLM_F_EXCL, network, gateway); err != nil {
+		if err == unix.EEXIST {
+			return false, ErrRouteExists
+		}
+
+		return false, fmt.Errorf("adding route %s -> %s: %s", network, gateway, err)
+	}
+
+	return true, nil
 }
 
 func (r *routerImpl) DeleteRoute(network *net.IPNet, gateway net.IP) (bool, error) {
-	return false, nil
+	if err := sendRouteRequest(unix.RTM_DELROUTE, 0, network, gateway); err != nil {
+		if err == unix.ESRCH || err == unix.ENOENT {
+			return false, ErrRouteNotFound
+		}
+
+		return false, fmt.Errorf("deleting route %s -> %s: %s", network, gateway, err)
+	}
+
+	return true, nil
+}
+
+// ListRoutes returns the routes currently present in RT_TABLE_MAIN, by
+// issuing a RTM_GETROUTE dump for both address families.
+func (r *routerImpl) ListRoutes() ([]Route, error) {
+	sock, err := newRouteSocket()
+
+	if err != nil {
+		return nil, fmt.Errorf("listing routes: %s", err)
+	}
+
+	defer sock.Close()
+
+	var routes []Route
+
+	for _, family := range []uint8{unix.AF_INET, unix.AF_INET6} {
+		sock.seq++
+
+		if err := sock.send(newRouteDumpRequest(sock.seq, family)); err != nil {
+			return nil, fmt.Errorf("listing routes: %s", err)
+		}
+
+		replies, err := sock.receiveUntilDone()
+
+		if err != nil {
+			return nil, fmt.Errorf("listing routes: %s", err)
+		}
+
+		for _, reply := range replies {
+			if route, ok := parseRouteMessage(reply); ok {
+				routes = append(routes, route)
+			}
+		}
+	}
+
+	return routes, nil
+}
+
+// MonitorRoutes streams route additions and deletions until ctx is done, at
+// which point the returned channel is closed.
+func (r *routerImpl) MonitorRoutes(ctx context.Context) (<-chan RouteEvent, error) {
+	sock, err := newRouteSocket()
+
+	if err != nil {
+		return nil, fmt.Errorf("monitoring routes: %s", err)
+	}
+
+	if err := unix.Bind(sock.fd, &unix.SockaddrNetlink{
+		Family: unix.AF_NETLINK,
+		Groups: unix.RTMGRP_IPV4_ROUTE | unix.RTMGRP_IPV6_ROUTE,
+	}); err != nil {
+		sock.Close()
+
+		return nil, fmt.Errorf("monitoring routes: joining the route multicast groups: %s", err)
+	}
+
+	events := make(chan RouteEvent)
+
+	go func() {
+		defer close(events)
+		defer sock.Close()
+
+		// Closing sock from the context-watcher goroutine below unblocks the
+		// in-flight Recvfrom, which is the only way to interrupt it.
+		stop := make(chan struct{})
+		var once sync.Once
+		defer once.Do(func() { close(stop) })
+
+		go func() {
+			select {
+			case <-ctx.Done():
+				sock.Close()
+			case <-stop:
+			}
+		}()
+
+		for {
+			msgs, err := sock.receive()
+
+			if err != nil {
+				return
+			}
+
+			for _, msg := range msgs {
+				var eventType RouteEventType
+
+				switch msg.Header.Type {
+				case unix.RTM_NEWROUTE:
+					eventType = RouteAdded
+				case unix.RTM_DELROUTE:
+					eventType = RouteDeleted
+				default:
+					continue
+				}
+
+				if route, ok := parseRouteMessage(msg); ok {
+					select {
+					case events <- RouteEvent{Type: eventType, Route: route}:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+// routeSocket wraps a NETLINK_ROUTE socket and the sequence-number
+// bookkeeping needed to pair requests with their acknowledgements.
+type routeSocket struct {
+	fd  int
+	seq uint32
+}
+
+func newRouteSocket() (*routeSocket, error) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW, unix.NETLINK_ROUTE)
+
+	if err != nil {
+		return nil, fmt.Errorf("opening the netlink route socket: %s", err)
+	}
+
+	if err := unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		unix.Close(fd)
+
+		return nil, fmt.Errorf("binding the netlink route socket: %s", err)
+	}
+
+	return &routeSocket{fd: fd}, nil
+}
+
+func (s *routeSocket) Close() error {
+	return unix.Close(s.fd)
+}
+
+func (s *routeSocket) send(msg []byte) error {
+	return unix.Sendto(s.fd, msg, 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK})
+}
+
+// receive reads a single batch of netlink messages from the socket.
+func (s *routeSocket) receive() ([]syscall.NetlinkMessage, error) {
+	buf := make([]byte, unix.Getpagesize())
+
+	n, _, err := unix.Recvfrom(s.fd, buf, 0)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return syscall.ParseNetlinkMessage(buf[:n])
+}
+
+// receiveUntilDone collects RTM_NEWROUTE messages until the NLMSG_DONE (or an
+// NLMSG_ERROR) trailer of a NLM_F_DUMP request is received.
+func (s *routeSocket) receiveUntilDone() ([]syscall.NetlinkMessage, error) {
+	var result []syscall.NetlinkMessage
+
+	for {
+		msgs, err := s.receive()
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, msg := range msgs {
+			switch msg.Header.Type {
+			case unix.NLMSG_DONE:
+				return result, nil
+			case unix.NLMSG_ERROR:
+				if err := parseNlMsgerr(msg.Data); err != nil {
+					return nil, err
+				}
+
+				return result, nil
+			default:
+				result = append(result, msg)
+			}
+		}
+	}
+}
+
+// sendRouteRequest sends a single RTM_NEWROUTE/RTM_DELROUTE request for
+// network via gateway and waits for its acknowledgement.
+func sendRouteRequest(msgType uint16, flags uint16, network *net.IPNet, gateway net.IP) error {
+	sock, err := newRouteSocket()
+
+	if err != nil {
+		return err
+	}
+
+	defer sock.Close()
+
+	sock.seq++
+	seq := sock.seq
+
+	if err := sock.send(newRouteRequest(seq, msgType, flags, network, gateway)); err != nil {
+		return err
+	}
+
+	for {
+		msgs, err := sock.receive()
+
+		if err != nil {
+			return err
+		}
+
+		for _, msg := range msgs {
+			if msg.Header.Seq != seq || msg.Header.Type != unix.NLMSG_ERROR {
+				continue
+			}
+
+			return parseNlMsgerr(msg.Data)
+		}
+	}
+}
+
+// parseNlMsgerr interprets the payload of a NLMSG_ERROR message, returning
+// nil if it merely acknowledges success (errno 0).
+func parseNlMsgerr(data []byte) error {
+	if len(data) < 4 {
+		return fmt.Errorf("truncated netlink error message")
+	}
+
+	errno := int32(binary.LittleEndian.Uint32(data))
+
+	if errno == 0 {
+		return nil
+	}
+
+	return unix.Errno(-errno)
+}
+
+// newRouteDumpRequest builds a bare RTM_GETROUTE request with no route
+// attributes attached, suitable for a NLM_F_DUMP of family's routing table.
+func newRouteDumpRequest(seq uint32, family uint8) []byte {
+	rtmsg := unix.RtMsg{
+		Family: family,
+		Table:  unix.RT_TABLE_MAIN,
+	}
+
+	return packNetlinkMessage(unix.RTM_GETROUTE, unix.NLM_F_REQUEST|unix.NLM_F_DUMP, seq, rtMsgBytes(rtmsg), nil)
+}
+
+// newRouteRequest builds a RTM_NEWROUTE/RTM_DELROUTE request for network via
+// gateway, with the NLM_F_REQUEST|NLM_F_ACK flags common to both.
+func newRouteRequest(seq uint32, msgType uint16, flags uint16, network *net.IPNet, gateway net.IP) []byte {
+	family := uint8(unix.AF_INET)
+	dst := network.IP.To4()
+	gw := gateway.To4()
+
+	if dst == nil {
+		family = unix.AF_INET6
+		dst = network.IP.To16()
+		gw = gateway.To16()
+	}
+
+	ones, _ := network.Mask.Size()
+
+	rtmsg := unix.RtMsg{
+		Family:   family,
+		Dst_len:  uint8(ones),
+		Table:    unix.RT_TABLE_MAIN,
+		Protocol: unix.RTPROT_BOOT,
+		Scope:    unix.RT_SCOPE_UNIVERSE,
+		Type:     unix.RTN_UNICAST,
+	}
+
+	var attrs []byte
+	attrs = append(attrs, packRtAttr(unix.RTA_DST, dst)...)
+
+	if gw != nil {
+		attrs = append(attrs, packRtAttr(unix.RTA_GATEWAY, gw)...)
+	}
+
+	return packNetlinkMessage(msgType, flags|unix.NLM_F_REQUEST|unix.NLM_F_ACK, seq, rtMsgBytes(rtmsg), attrs)
+}
+
+func rtMsgBytes(rtmsg unix.RtMsg) []byte {
+	return []byte{rtmsg.Family, rtmsg.Dst_len, rtmsg.Src_len, rtmsg.Tos, rtmsg.Table, rtmsg.Protocol, rtmsg.Scope, rtmsg.Type, 0, 0, 0, 0}
+}
+
+// packRtAttr encodes a single, 4-byte-aligned route attribute.
+func packRtAttr(attrType uint16, data []byte) []byte {
+	l := unix.SizeofRtAttr + len(data)
+	buf := make([]byte, align4(l))
+
+	binary.LittleEndian.PutUint16(buf[0:2], uint16(l))
+	binary.LittleEndian.PutUint16(buf[2:4], attrType)
+	copy(buf[unix.SizeofRtAttr:], data)
+
+	return buf
+}
+
+// packNetlinkMessage wraps payload (a fixed-size message body, e.g. the
+// RtMsg bytes) and attrs (its trailing, 4-byte-aligned attributes) in a
+// NlMsghdr.
+func packNetlinkMessage(msgType uint16, flags uint16, seq uint32, payload, attrs []byte) []byte {
+	body := append(append([]byte{}, payload...), attrs...)
+	length := unix.SizeofNlMsghdr + len(body)
+
+	buf := make([]byte, align4(length))
+
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(length))
+	binary.LittleEndian.PutUint16(buf[4:6], msgType)
+	binary.LittleEndian.PutUint16(buf[6:8], flags)
+	binary.LittleEndian.PutUint32(buf[8:12], seq)
+	binary.LittleEndian.PutUint32(buf[12:16], uint32(unix.Getpid()))
+	copy(buf[unix.SizeofNlMsghdr:], body)
+
+	return buf
+}
+
+// parseRouteMessage decodes a RTM_NEWROUTE/RTM_DELROUTE message's RtMsg and
+// RTA_DST/RTA_GATEWAY attributes into a Route. ok is false for routes outside
+// RT_TABLE_MAIN or of a type other than RTN_UNICAST (e.g. local or broadcast
+// routes), which ListRoutes and MonitorRoutes are not interested in.
+func parseRouteMessage(msg syscall.NetlinkMessage) (Route, bool) {
+	if len(msg.Data) < unix.SizeofRtMsg {
+		return Route{}, false
+	}
+
+	rtmsg := unix.RtMsg{
+		Family:   msg.Data[0],
+		Dst_len:  msg.Data[1],
+		Src_len:  msg.Data[2],
+		Tos:      msg.Data[3],
+		Table:    msg.Data[4],
+		Protocol: msg.Data[5],
+		Scope:    msg.Data[6],
+		Type:     msg.Data[7],
+	}
+
+	if rtmsg.Table != unix.RT_TABLE_MAIN || rtmsg.Type != unix.RTN_UNICAST {
+		return Route{}, false
+	}
+
+	attrs, err := syscall.ParseNetlinkRouteAttr(&msg)
+
+	if err != nil {
+		return Route{}, false
+	}
+
+	var dst, gw net.IP
+
+	for _, attr := range attrs {
+		switch attr.Attr.Type {
+		case unix.RTA_DST:
+			dst = net.IP(attr.Value)
+		case unix.RTA_GATEWAY:
+			gw = net.IP(attr.Value)
+		}
+	}
+
+	bits := 32
+
+	if rtmsg.Family == unix.AF_INET6 {
+		bits = 128
+	}
+
+	// A default route (0.0.0.0/0 or ::/0) has Dst_len == 0 and carries no
+	// RTA_DST attribute at all, since there is nothing to encode; dst
+	// staying nil in that case is the network's own zero address, not a
+	// malformed or uninteresting route.
+	if dst == nil {
+		if rtmsg.Dst_len != 0 {
+			return Route{}, false
+		}
+
+		if rtmsg.Family == unix.AF_INET6 {
+			dst = net.IPv6zero
+		} else {
+			dst = net.IPv4zero
+		}
+	}
+
+	return Route{
+		Network: &net.IPNet{IP: dst, Mask: net.CIDRMask(int(rtmsg.Dst_len), bits)},
+		Gateway: gw,
+	}, true
+}
+
+func align4(n int) int {
+	return (n + 3) &^ 3
 }
@@ -0,0 +1,135 @@
+package routing
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"golang.org/x/sys/windows"
+	"golang.zx2c4.com/wireguard/windows/tunnel/winipcfg"
+)
+
+type routerImpl struct{}
+
+// NewRouter instanciates a new router.
+func NewRouter() Router {
+	return &routerImpl{}
+}
+
+func (r *routerImpl) AddRoute(network *net.IPNet, gateway net.IP) (bool, error) {
+	luid, err := interfaceLUIDTowards(gateway)
+
+	if err != nil {
+		return false, fmt.Errorf("adding route %s -> %s: %s", network, gateway, err)
+	}
+
+	if err := luid.AddRoute(*network, gateway, 0); err != nil {
+		if errors.Is(err, windows.ERROR_OBJECT_ALREADY_EXISTS) {
+			return false, ErrRouteExists
+		}
+
+		return false, fmt.Errorf("adding route %s -> %s: %s", network, gateway, err)
+	}
+
+	return true, nil
+}
+
+func (r *routerImpl) DeleteRoute(network *net.IPNet, gateway net.IP) (bool, error) {
+	luid, err := interfaceLUIDTowards(gateway)
+
+	if err != nil {
+		return false, fmt.Errorf("deleting route %s -> %s: %s", network, gateway, err)
+	}
+
+	if err := luid.DeleteRoute(*network, gateway); err != nil {
+		if errors.Is(err, windows.ERROR_NOT_FOUND) {
+			return false, ErrRouteNotFound
+		}
+
+		return false, fmt.Errorf("deleting route %s -> %s: %s", network, gateway, err)
+	}
+
+	return true, nil
+}
+
+// ListRoutes returns the routes currently bound to every network
+// interface's IPv4 and IPv6 forwarding table, via the IP Helper API.
+func (r *routerImpl) ListRoutes() ([]Route, error) {
+	infs, err := net.Interfaces()
+
+	if err != nil {
+		return nil, fmt.Errorf("listing routes: %s", err)
+	}
+
+	var routes []Route
+
+	for _, inf := range infs {
+		luid, err := interfaceLUID(&inf)
+
+		if err != nil {
+			continue
+		}
+
+		for _, family := range []winipcfg.AddressFamily{windows.AF_INET, windows.AF_INET6} {
+			rows, err := luid.Routes(family)
+
+			if err != nil {
+				continue
+			}
+
+			for _, row := range rows {
+				routes = append(routes, Route{
+					Network: &row.Destination,
+					Gateway: row.NextHop,
+				})
+			}
+		}
+	}
+
+	return routes, nil
+}
+
+// interfaceLUID resolves the NET_LUID the IP Helper API identifies inf
+// by, via ConvertInterfaceIndexToLuid.
+func interfaceLUID(inf *net.Interface) (winipcfg.LUID, error) {
+	var luid uint64
+
+	if err := windows.ConvertInterfaceIndexToLuid(uint32(inf.Index), &luid); err != nil {
+		return 0, fmt.Errorf("resolving LUID for %q: %s", inf.Name, err)
+	}
+
+	return winipcfg.LUID(luid), nil
+}
+
+// interfaceLUIDTowards picks the network interface whose local subnet
+// contains gateway. CreateIpForwardEntry2/DeleteIpForwardEntry2 require
+// binding the route to a specific interface's LUID, unlike a plain
+// "route add" command, which lets the kernel resolve the outgoing
+// interface implicitly from the gateway address.
+func interfaceLUIDTowards(gateway net.IP) (winipcfg.LUID, error) {
+	infs, err := net.Interfaces()
+
+	if err != nil {
+		return 0, fmt.Errorf("listing network interfaces: %s", err)
+	}
+
+	for _, inf := range infs {
+		addrs, err := inf.Addrs()
+
+		if err != nil {
+			continue
+		}
+
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+
+			if !ok || !ipNet.Contains(gateway) {
+				continue
+			}
+
+			return interfaceLUID(&inf)
+		}
+	}
+
+	return 0, fmt.Errorf("no local interface routes to gateway %s", gateway)
+}
@@ -1,6 +1,7 @@
 package tuntap
 
 import (
+	"context"
 	"io"
 	"net"
 )
@@ -10,6 +11,28 @@ type Adapter interface {
 	io.ReadWriteCloser
 	Interface() *net.Interface
 	Config() AdapterConfig
+	RouteTable
+}
+
+// A BatchAdapter can read and write several packets per call, amortizing
+// the per-call overhead (syscall, DeviceIoControl, or cgo transition,
+// depending on the platform) that a sequence of Read/Write calls pays per
+// packet.
+//
+// Adapter implementations may optionally implement it; callers should use
+// a type assertion to check for support. Read and Write remain valid and
+// unaffected either way.
+type BatchAdapter interface {
+	// ReadPackets reads up to len(bufs) packets, writing each one into the
+	// matching entry of bufs and its length into the matching entry of
+	// sizes, and returns the number of packets read. It blocks for at
+	// least one packet, but returns early, without error, once fewer
+	// packets than requested are immediately available.
+	ReadPackets(bufs [][]byte, sizes []int) (n int, err error)
+
+	// WritePackets writes each of bufs as a separate packet and returns
+	// the number of packets written.
+	WritePackets(bufs [][]byte) (n int, err error)
 }
 
 // AdapterConfig represents a tap adapter config.
@@ -28,6 +51,11 @@ type AdapterConfig struct {
 	// IPv6 is an IPv6 address to set on the interface after its goes up.
 	IPv6 *net.IPNet
 
+	// MTU is the MTU to set on the interface after it goes up.
+	//
+	// A zero value leaves the operating system's default MTU untouched.
+	MTU int
+
 	// DisableARP disables the ARP proxy.
 	//
 	// This is ignored on TUN adapters.
@@ -35,9 +63,90 @@ type AdapterConfig struct {
 
 	// DisableDHCP disables the fake DHCP server.
 	DisableDHCP bool
+
+	// WindowsDriver selects which Windows virtual adapter backend
+	// NewAdapter uses to satisfy this config. It is ignored on every
+	// other platform.
+	WindowsDriver WindowsDriver
+
+	// Metric sets the interface's route metric after it goes up.
+	//
+	// A zero value leaves the operating system's automatically computed
+	// metric in place. Only applied on Windows.
+	Metric uint32
+
+	// DNSServers sets the interface's DNS server list after it goes up.
+	//
+	// An empty slice leaves the operating system's DNS configuration
+	// untouched. Only applied on Windows.
+	DNSServers []net.IP
 }
 
 // NewAdapterConfig instantiate a new default configuration.
 func NewAdapterConfig() *AdapterConfig {
 	return &AdapterConfig{}
 }
+
+// WindowsDriver selects between the Windows virtual adapter backends
+// NewAdapter knows how to open.
+type WindowsDriver int
+
+const (
+	// WindowsDriverAuto prefers the modern Wintun driver when wintun.dll
+	// can be loaded, falling back to the legacy TAP-Windows6 (tap0901)
+	// driver otherwise. It is the zero value, so leaving
+	// AdapterConfig.WindowsDriver unset means auto-detect.
+	WindowsDriverAuto WindowsDriver = iota
+	// WindowsDriverTAP forces the legacy TAP-Windows6 driver.
+	WindowsDriverTAP
+	// WindowsDriverWintun forces the modern Wintun driver.
+	WindowsDriverWintun
+)
+
+// AdapterEventType identifies the kind of change an AdapterEvent carries.
+type AdapterEventType int
+
+const (
+	// AdapterAddressAdded indicates an address was added to the adapter's
+	// interface.
+	AdapterAddressAdded AdapterEventType = iota
+	// AdapterAddressRemoved indicates an address was removed from the
+	// adapter's interface.
+	AdapterAddressRemoved
+	// AdapterLinkUp indicates the adapter's interface came up.
+	AdapterLinkUp
+	// AdapterLinkDown indicates the adapter's interface went down.
+	AdapterLinkDown
+	// AdapterMTUChanged indicates the adapter's interface MTU changed.
+	AdapterMTUChanged
+	// AdapterDefaultRouteChanged indicates the operating system's default
+	// route changed. It is currently only ever reported on Windows, where
+	// it is emitted on every routing table change, without checking that
+	// the change concerns the default route or the adapter's interface.
+	AdapterDefaultRouteChanged
+)
+
+// AdapterEvent describes a single change observed on an adapter's
+// interface, as reported by an AdapterMonitor.
+type AdapterEvent struct {
+	Type AdapterEventType
+
+	// Address is set for AdapterAddressAdded and AdapterAddressRemoved
+	// events.
+	Address *net.IPNet
+
+	// MTU is set for AdapterMTUChanged events.
+	MTU int
+}
+
+// An AdapterMonitor can stream changes to an adapter's own interface:
+// address adds/removes, link up/down transitions, MTU changes, and (on
+// Windows) default route changes.
+//
+// Adapter implementations may optionally implement it; callers should use
+// a type assertion to check for support.
+type AdapterMonitor interface {
+	// Watch streams changes to the adapter's interface until ctx is done,
+	// at which point the returned channel is closed.
+	Watch(ctx context.Context) (<-chan AdapterEvent, error)
+}
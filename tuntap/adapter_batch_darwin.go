@@ -0,0 +1,50 @@
+package tuntap
+
+import "golang.org/x/sys/unix"
+
+// ReadPackets reads up to len(bufs) packets from the adapter and returns
+// the number of packets read. utun has no multi-packet batching
+// primitive, so this is a plain loop over Read; it exists so callers can
+// use the same BatchAdapter code path across platforms. After the first
+// packet, it stops early, without error, once a zero-timeout poll reports
+// no further packet immediately queued.
+func (a *adapterImpl) ReadPackets(bufs [][]byte, sizes []int) (int, error) {
+	n := 0
+
+	for n < len(bufs) {
+		if n > 0 {
+			fds := []unix.PollFd{{Fd: int32(a.File.Fd()), Events: unix.POLLIN}}
+
+			if ready, err := unix.Poll(fds, 0); err != nil || ready == 0 {
+				return n, nil
+			}
+		}
+
+		sz, err := a.Read(bufs[n])
+
+		if err != nil {
+			if n > 0 {
+				return n, nil
+			}
+
+			return 0, err
+		}
+
+		sizes[n] = sz
+		n++
+	}
+
+	return n, nil
+}
+
+// WritePackets writes each of bufs as a separate packet via a plain loop
+// over Write, and returns the number of packets written.
+func (a *adapterImpl) WritePackets(bufs [][]byte) (int, error) {
+	for i, buf := range bufs {
+		if _, err := a.Write(buf); err != nil {
+			return i, err
+		}
+	}
+
+	return len(bufs), nil
+}
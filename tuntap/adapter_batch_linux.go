@@ -0,0 +1,98 @@
+// +build linux
+
+package tuntap
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// ReadPackets reads up to len(bufs) packets from the adapter and returns
+// the number of packets read. A tun/tap character device only ever
+// returns a single packet per readv, so this is a loop of one readv
+// syscall per packet rather than a single batched one; it amortizes the
+// caller's own per-packet overhead (buffer allocation, interface
+// dispatch), not the kernel's. After the first packet, it stops early,
+// without error, once a zero-timeout poll reports no further packet
+// immediately queued.
+func (a *adapterImpl) ReadPackets(bufs [][]byte, sizes []int) (int, error) {
+	n := 0
+
+	for n < len(bufs) {
+		if n > 0 {
+			fds := []unix.PollFd{{Fd: int32(a.fd()), Events: unix.POLLIN}}
+
+			if ready, err := unix.Poll(fds, 0); err != nil || ready == 0 {
+				return n, nil
+			}
+		}
+
+		sz, err := readOnePacket(a.fd(), bufs[n])
+
+		if err != nil {
+			if n > 0 {
+				return n, nil
+			}
+
+			return 0, err
+		}
+
+		sizes[n] = sz
+		n++
+	}
+
+	return n, nil
+}
+
+// WritePackets writes each of bufs as a separate packet via one writev
+// syscall per packet, since a tun/tap character device treats an entire
+// writev call as a single packet rather than one per iovec, and returns
+// the number of packets written.
+func (a *adapterImpl) WritePackets(bufs [][]byte) (int, error) {
+	for i, buf := range bufs {
+		if _, err := writeOnePacket(a.fd(), buf); err != nil {
+			return i, err
+		}
+	}
+
+	return len(bufs), nil
+}
+
+// readOnePacket reads a single packet off fd via readv, backing both
+// adapterDescriptor.Read and ReadPackets.
+func readOnePacket(fd int, buf []byte) (int, error) {
+	if len(buf) == 0 {
+		return 0, nil
+	}
+
+	iov := unix.Iovec{Base: &buf[0]}
+	iov.SetLen(len(buf))
+
+	n, _, errno := unix.Syscall(unix.SYS_READV, uintptr(fd), uintptr(unsafe.Pointer(&iov)), 1)
+
+	if errno != 0 {
+		return 0, errno
+	}
+
+	return int(n), nil
+}
+
+// writeOnePacket writes a single packet to fd via writev, backing both
+// adapterDescriptor.Write and WritePackets.
+func writeOnePacket(fd int, buf []byte) (int, error) {
+	if len(buf) == 0 {
+		return 0, nil
+	}
+
+	iov := unix.Iovec{Base: &buf[0]}
+	iov.SetLen(len(buf))
+
+	n, _, errno := unix.Syscall(unix.SYS_WRITEV, uintptr(fd), uintptr(unsafe.Pointer(&iov)), 1)
+
+	if errno != 0 {
+		return 0, errno
+	}
+
+	return int(n), nil
+}
@@ -0,0 +1,235 @@
+package tuntap
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	utunControlName = "com.apple.net.utun_control"
+
+	// A utun packet is prefixed with a 4-byte address family header instead
+	// of carrying an Ethernet header, so utun can only ever back a tun
+	// adapter.
+	utunHeaderLength = 4
+)
+
+type adapterImpl struct {
+	*os.File
+	inf    *net.Interface
+	config *AdapterConfig
+	name   string
+}
+
+// NewTapAdapter is not supported on Darwin: the built-in utun control
+// socket is IP-only and has no notion of an Ethernet link, and go-freelan
+// has no bundled kernel extension to provide one.
+func NewTapAdapter(config *AdapterConfig) (Adapter, error) {
+	return nil, errors.New("tap adapters are not supported on darwin: utun only provides tun (IP) adapters")
+}
+
+// NewTunAdapter instantiates a new tun adapter backed by the built-in utun
+// driver, opened through a PF_SYSTEM/SYSPROTO_CONTROL socket.
+func NewTunAdapter(config *AdapterConfig) (Adapter, error) {
+	if config == nil {
+		config = NewAdapterConfig()
+	}
+
+	unit := -1
+
+	if config.Name != "" {
+		var err error
+
+		if unit, err = parseUtunUnit(config.Name); err != nil {
+			return nil, fmt.Errorf("invalid utun adapter name %q: %s", config.Name, err)
+		}
+	}
+
+	fd, name, err := openUtun(unit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	inf, err := net.InterfaceByName(name)
+
+	if err != nil {
+		unix.Close(fd)
+
+		return nil, fmt.Errorf("failed to get interface details for `%s`: %v", name, err)
+	}
+
+	adapter := &adapterImpl{
+		File:   os.NewFile(uintptr(fd), name),
+		inf:    inf,
+		config: config,
+		name:   name,
+	}
+
+	runtime.SetFinalizer(adapter, (*adapterImpl).Close)
+
+	if config.IPv4 != nil {
+		if err = adapter.SetIPv4(config.IPv4); err != nil {
+			adapter.Close()
+			return nil, fmt.Errorf("setting IPv4 address to %s: %s", *config.IPv4, err)
+		}
+	}
+
+	if config.IPv6 != nil {
+		if err = adapter.SetIPv6(config.IPv6); err != nil {
+			adapter.Close()
+			return nil, fmt.Errorf("setting IPv6 address to %s: %s", *config.IPv6, err)
+		}
+	}
+
+	if config.MTU != 0 {
+		if err = adapter.setMTU(config.MTU); err != nil {
+			adapter.Close()
+			return nil, fmt.Errorf("setting MTU to %d: %s", config.MTU, err)
+		}
+	}
+
+	return adapter, nil
+}
+
+// parseUtunUnit extracts the unit number out of a "utunN" adapter name.
+func parseUtunUnit(name string) (int, error) {
+	if !strings.HasPrefix(name, "utun") {
+		return 0, fmt.Errorf("expected a name of the form `utunN`, got %q", name)
+	}
+
+	return strconv.Atoi(strings.TrimPrefix(name, "utun"))
+}
+
+// openUtun opens a utun control socket for the given unit number, or the
+// first free one if unit is negative, and returns its file descriptor
+// along with the interface name the kernel assigned it.
+func openUtun(unit int) (int, string, error) {
+	fd, err := unix.Socket(unix.AF_SYSTEM, unix.SOCK_DGRAM, unix.SYSPROTO_CONTROL)
+
+	if err != nil {
+		return 0, "", fmt.Errorf("opening the utun control socket: %s", err)
+	}
+
+	info := &unix.CtlInfo{}
+	copy(info.Name[:], utunControlName)
+
+	if err := unix.IoctlCtlInfo(fd, info); err != nil {
+		unix.Close(fd)
+
+		return 0, "", fmt.Errorf("resolving the utun control id: %s", err)
+	}
+
+	sc := &unix.SockaddrCtl{
+		ID:   info.Id,
+		Unit: uint32(unit + 1),
+	}
+
+	if err := unix.Connect(fd, sc); err != nil {
+		unix.Close(fd)
+
+		return 0, "", fmt.Errorf("connecting to the utun control socket: %s", err)
+	}
+
+	name, err := unix.GetsockoptString(fd, unix.SYSPROTO_CONTROL, unix.UTUN_OPT_IFNAME)
+
+	if err != nil {
+		unix.Close(fd)
+
+		return 0, "", fmt.Errorf("reading the assigned utun interface name: %s", err)
+	}
+
+	return fd, name, nil
+}
+
+func (a *adapterImpl) Read(p []byte) (int, error) {
+	// utun prefixes every packet with a 4-byte address family header that
+	// the Adapter interface has no use for.
+	buf := make([]byte, len(p)+utunHeaderLength)
+
+	n, err := a.File.Read(buf)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if n < utunHeaderLength {
+		return 0, nil
+	}
+
+	return copy(p, buf[utunHeaderLength:n]), nil
+}
+
+func (a *adapterImpl) Write(p []byte) (int, error) {
+	buf := make([]byte, 0, len(p)+utunHeaderLength)
+
+	// Only IPv4 and IPv6 ever flow through a tun adapter.
+	if len(p) > 0 && p[0]>>4 == 6 {
+		buf = append(buf, 0, 0, 0, unix.AF_INET6)
+	} else {
+		buf = append(buf, 0, 0, 0, unix.AF_INET)
+	}
+
+	buf = append(buf, p...)
+
+	n, err := a.File.Write(buf)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return n - utunHeaderLength, nil
+}
+
+func (a *adapterImpl) Interface() *net.Interface {
+	return a.inf
+}
+
+func (a *adapterImpl) Config() AdapterConfig {
+	return *a.config
+}
+
+func (a *adapterImpl) SetIPv4(addr *net.IPNet) error {
+	// utun is a point-to-point interface: the local and remote addresses
+	// passed to ifconfig are conventionally the same, and the netmask is
+	// what actually carves out the adapter's network.
+	return a.ifconfig(
+		"inet", addr.IP.String(), addr.IP.String(),
+		"netmask", net.IP(addr.Mask).String(),
+	)
+}
+
+func (a *adapterImpl) SetIPv6(addr *net.IPNet) error {
+	ones, _ := addr.Mask.Size()
+
+	return a.ifconfig("inet6", fmt.Sprintf("%s/%d", addr.IP, ones))
+}
+
+func (a *adapterImpl) setMTU(mtu int) error {
+	return a.ifconfig("mtu", strconv.Itoa(mtu))
+}
+
+func (a *adapterImpl) ifconfig(args ...string) error {
+	cmd := exec.Command("ifconfig", append([]string{a.name}, args...)...)
+	b, err := cmd.CombinedOutput()
+
+	if err != nil {
+		return fmt.Errorf("failed to call `ifconfig %s %s`: %s (output follows)\n%s", a.name, strings.Join(args, " "), err, string(b))
+	}
+
+	return nil
+}
+
+func (a *adapterImpl) Close() error {
+	runtime.SetFinalizer(a, nil)
+
+	return a.File.Close()
+}
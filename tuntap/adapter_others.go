@@ -5,11 +5,11 @@ package tuntap
 import "errors"
 
 // NewTapAdapter instantiates a new tap adapter.
-func NewTapAdapter(config *TapAdapterConfig) (TapAdapter, error) {
+func NewTapAdapter(config *AdapterConfig) (Adapter, error) {
 	return nil, errors.New("not implemented on this platform")
 }
 
-// NewTunAPAdapter instantiates a new tun adapter.
-func NewTunAdapter(config *TunAdapterConfig) (TunAdapter, error) {
+// NewTunAdapter instantiates a new tun adapter.
+func NewTunAdapter(config *AdapterConfig) (Adapter, error) {
 	return nil, errors.New("not implemented on this platform")
 }
@@ -1,17 +1,16 @@
-// +build darwin linux
+// +build linux
 
 package tuntap
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"os/exec"
 	"runtime"
 	"strings"
-	"syscall"
 	"time"
 
-	"github.com/freelan-developers/go-freelan/routing"
 	"github.com/google/gopacket/layers"
 )
 
@@ -20,10 +19,56 @@ import (
 */
 import "C"
 
+// setMTU sets the interface's MTU via `ip link set`, since the adapter C
+// library has no ioctl for it.
+func setMTU(name string, mtu int) error {
+	args := []string{"link", "set", "dev", name, "mtu", fmt.Sprint(mtu)}
+	cmd := exec.Command("ip", args...)
+	b, err := cmd.CombinedOutput()
+
+	if err != nil {
+		return fmt.Errorf("failed to call `ip %s`: %s (output follows)\n%s", strings.Join(args, " "), err, string(b))
+	}
+
+	return nil
+}
+
 type adapterImpl struct {
 	*adapterDescriptor
 	inf    *net.Interface
 	config *AdapterConfig
+
+	// dhcpCancel stops the background DHCPClient started by
+	// startDHCPClient, if any.
+	dhcpCancel context.CancelFunc
+}
+
+// startDHCPClient runs a DHCPClient against adapter until adapter is
+// closed, applying each acquired lease's IPv4 address via adapter.SetIPv4
+// and renewing it automatically. The client stops early, and is not
+// restarted, if it fails to acquire a lease within its AcquireTimeout.
+func startDHCPClient(adapter *adapterImpl) {
+	client := NewDHCPClient(adapter)
+	client.Acquired = func(old, new *net.IPNet, cfg DHCPConfig) {
+		if new != nil {
+			adapter.SetIPv4(new)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	adapter.dhcpCancel = cancel
+
+	go client.Run(ctx)
+}
+
+// Close stops the background DHCPClient started by startDHCPClient, if any,
+// then closes the underlying adapter descriptor.
+func (a *adapterImpl) Close() error {
+	if a.dhcpCancel != nil {
+		a.dhcpCancel()
+	}
+
+	return a.adapterDescriptor.Close()
 }
 
 type adapterDescriptor struct {
@@ -43,12 +88,18 @@ func (t *adapterDescriptor) Name() string {
 	return C.GoString(&t.ptr.name[0])
 }
 
+// fd returns the underlying file descriptor, for batched I/O helpers that
+// need it directly rather than through the cgo-typed adapterDescriptor.
+func (t *adapterDescriptor) fd() int {
+	return int(t.ptr.fd)
+}
+
 func (t *adapterDescriptor) Read(p []byte) (int, error) {
-	return syscall.Read((int)(t.ptr.fd), p)
+	return readOnePacket(t.fd(), p)
 }
 
 func (t *adapterDescriptor) Write(p []byte) (int, error) {
-	return syscall.Write((int)(t.ptr.fd), p)
+	return writeOnePacket(t.fd(), p)
 }
 
 func (t *adapterDescriptor) SetIPv4(addr *net.IPNet) error {
@@ -65,32 +116,6 @@ func (t *adapterDescriptor) SetIPv4(addr *net.IPNet) error {
 		return nil
 	}
 
-	// On OSX, the ioctl apparently doesn't have the desired effect, so we set the remote IPv4 address through other means add
-	// an explicit route instead.
-	if runtime.GOOS == "darwin" {
-		network := &net.IPNet{
-			IP:   addr.IP.Mask(addr.Mask),
-			Mask: addr.Mask,
-		}
-		args := []string{
-			t.Name(),
-			addr.IP.String(),
-			net.IPv4bcast.Mask(addr.Mask).String(),
-			network.IP.String(),
-		}
-		cmd := exec.Command("ifconfig", args...)
-		b, err := cmd.CombinedOutput()
-
-		if err != nil {
-			return fmt.Errorf("failed to call `ifconfig %s`: %s (output follows)\n%s", strings.Join(args, " "), err, string(b))
-		}
-
-		router := routing.NewRouter()
-		_, err = router.AddRoute(network, addr.IP)
-
-		return err
-	}
-
 	return t.SetRemoteIPv4(addr.IP.Mask(addr.Mask))
 }
 
@@ -201,6 +226,8 @@ func NewTapAdapter(config *AdapterConfig) (Adapter, error) {
 				},
 			}
 		}
+	} else if !config.DisableDHCP {
+		startDHCPClient(adapter)
 	}
 
 	if config.IPv6 != nil {
@@ -210,6 +237,13 @@ func NewTapAdapter(config *AdapterConfig) (Adapter, error) {
 		}
 	}
 
+	if config.MTU != 0 {
+		if err = setMTU(desc.Name(), config.MTU); err != nil {
+			adapter.Close()
+			return nil, fmt.Errorf("setting MTU to %d: %s", config.MTU, err)
+		}
+	}
+
 	if err = adapter.SetConnectedState(true); err != nil {
 		adapter.Close()
 		return nil, fmt.Errorf("failed to bring adapter up: %s", err)
@@ -262,6 +296,8 @@ func NewTunAdapter(config *AdapterConfig) (Adapter, error) {
 				},
 			}, nil
 		}
+	} else if !config.DisableDHCP {
+		startDHCPClient(adapter)
 	}
 
 	if config.IPv6 != nil {
@@ -270,6 +306,13 @@ func NewTunAdapter(config *AdapterConfig) (Adapter, error) {
 		}
 	}
 
+	if config.MTU != 0 {
+		if err = setMTU(desc.Name(), config.MTU); err != nil {
+			adapter.Close()
+			return nil, fmt.Errorf("setting MTU to %d: %s", config.MTU, err)
+		}
+	}
+
 	if err = adapter.SetConnectedState(true); err != nil {
 		adapter.Close()
 		return nil, fmt.Errorf("failed to bring adapter up: %s", err)
@@ -285,3 +328,4 @@ func (a *adapterImpl) Interface() *net.Interface {
 func (a *adapterImpl) Config() AdapterConfig {
 	return *a.config
 }
+
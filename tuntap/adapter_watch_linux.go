@@ -0,0 +1,234 @@
+// +build linux
+
+package tuntap
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// Watch streams IPv4 address adds/removes, link up/down transitions, and
+// MTU changes on a's own interface until ctx is done, at which point the
+// returned channel is closed.
+//
+// It subscribes to the RTMGRP_LINK/RTMGRP_IPV4_IFADDR netlink multicast
+// groups, over the same kind of NETLINK_ROUTE socket
+// routing.Router.MonitorRoutes uses for the routing table, filtering every
+// message down to a.Interface().Index. RTMGRP_IPV6_IFADDR is not joined,
+// so IPv6 address changes are not reported.
+func (a *adapterImpl) Watch(ctx context.Context) (<-chan AdapterEvent, error) {
+	index := a.Interface().Index
+
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW, unix.NETLINK_ROUTE)
+
+	if err != nil {
+		return nil, fmt.Errorf("watching %s: opening the netlink socket: %s", a.Interface().Name, err)
+	}
+
+	if err := unix.Bind(fd, &unix.SockaddrNetlink{
+		Family: unix.AF_NETLINK,
+		Groups: unix.RTMGRP_LINK | unix.RTMGRP_IPV4_IFADDR,
+	}); err != nil {
+		unix.Close(fd)
+
+		return nil, fmt.Errorf("watching %s: joining the link/address multicast groups: %s", a.Interface().Name, err)
+	}
+
+	events := make(chan AdapterEvent)
+
+	go func() {
+		defer close(events)
+		defer unix.Close(fd)
+
+		// Closing fd from the context-watcher goroutine below unblocks the
+		// in-flight Recvfrom, which is the only way to interrupt it.
+		stop := make(chan struct{})
+		var once sync.Once
+		defer once.Do(func() { close(stop) })
+
+		go func() {
+			select {
+			case <-ctx.Done():
+				unix.Close(fd)
+			case <-stop:
+			}
+		}()
+
+		var lastUp bool
+		var lastMTU int
+
+		if inf, err := net.InterfaceByIndex(index); err == nil {
+			lastUp, lastMTU = inf.Flags&net.FlagUp != 0, inf.MTU
+		}
+
+		for {
+			buf := make([]byte, unix.Getpagesize())
+
+			n, _, err := unix.Recvfrom(fd, buf, 0)
+
+			if err != nil {
+				return
+			}
+
+			msgs, err := unix.ParseNetlinkMessage(buf[:n])
+
+			if err != nil {
+				continue
+			}
+
+			for _, msg := range msgs {
+				for _, event := range parseAdapterMessage(msg, index, &lastUp, &lastMTU) {
+					select {
+					case events <- event:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+// parseAdapterMessage decodes a single netlink message into zero or more
+// AdapterEvents, discarding anything that doesn't concern index.
+func parseAdapterMessage(msg unix.NetlinkMessage, index int, lastUp *bool, lastMTU *int) []AdapterEvent {
+	switch msg.Header.Type {
+	case unix.RTM_NEWLINK, unix.RTM_DELLINK:
+		return parseLinkMessage(msg, index, lastUp, lastMTU)
+	case unix.RTM_NEWADDR, unix.RTM_DELADDR:
+		if event, ok := parseAddrMessage(msg, index, msg.Header.Type == unix.RTM_NEWADDR); ok {
+			return []AdapterEvent{event}
+		}
+	}
+
+	return nil
+}
+
+// parseLinkMessage decodes a RTM_NEWLINK/RTM_DELLINK message's IfInfomsg
+// and IFLA_MTU attribute, emitting an AdapterLinkUp/AdapterLinkDown and/or
+// AdapterMTUChanged event for each change since the last message seen for
+// index.
+func parseLinkMessage(msg unix.NetlinkMessage, index int, lastUp *bool, lastMTU *int) []AdapterEvent {
+	if len(msg.Data) < unix.SizeofIfInfomsg {
+		return nil
+	}
+
+	ifinfo := unix.IfInfomsg{
+		Family: msg.Data[0],
+		Type:   binary.LittleEndian.Uint16(msg.Data[2:4]),
+		Index:  int32(binary.LittleEndian.Uint32(msg.Data[4:8])),
+		Flags:  binary.LittleEndian.Uint32(msg.Data[8:12]),
+		Change: binary.LittleEndian.Uint32(msg.Data[12:16]),
+	}
+
+	if int(ifinfo.Index) != index {
+		return nil
+	}
+
+	var events []AdapterEvent
+
+	up := ifinfo.Flags&unix.IFF_UP != 0
+
+	if up != *lastUp {
+		*lastUp = up
+
+		eventType := AdapterLinkDown
+
+		if up {
+			eventType = AdapterLinkUp
+		}
+
+		events = append(events, AdapterEvent{Type: eventType})
+	}
+
+	attrs, err := unix.ParseNetlinkRouteAttr(&msg)
+
+	if err != nil {
+		return events
+	}
+
+	for _, attr := range attrs {
+		if attr.Attr.Type != unix.IFLA_MTU || len(attr.Value) < 4 {
+			continue
+		}
+
+		mtu := int(binary.LittleEndian.Uint32(attr.Value))
+
+		if mtu != *lastMTU {
+			*lastMTU = mtu
+
+			events = append(events, AdapterEvent{Type: AdapterMTUChanged, MTU: mtu})
+		}
+	}
+
+	return events
+}
+
+// parseAddrMessage decodes a RTM_NEWADDR/RTM_DELADDR message's IfAddrmsg
+// and IFA_LOCAL/IFA_ADDRESS attribute into an AdapterEvent. ok is false
+// for messages concerning an interface other than index, or that carry no
+// address attribute at all.
+func parseAddrMessage(msg unix.NetlinkMessage, index int, added bool) (AdapterEvent, bool) {
+	if len(msg.Data) < unix.SizeofIfAddrmsg {
+		return AdapterEvent{}, false
+	}
+
+	ifaddr := unix.IfAddrmsg{
+		Family:    msg.Data[0],
+		Prefixlen: msg.Data[1],
+		Flags:     msg.Data[2],
+		Scope:     msg.Data[3],
+		Index:     binary.LittleEndian.Uint32(msg.Data[4:8]),
+	}
+
+	if int(ifaddr.Index) != index {
+		return AdapterEvent{}, false
+	}
+
+	attrs, err := unix.ParseNetlinkRouteAttr(&msg)
+
+	if err != nil {
+		return AdapterEvent{}, false
+	}
+
+	var ip net.IP
+
+	for _, attr := range attrs {
+		switch attr.Attr.Type {
+		case unix.IFA_LOCAL:
+			ip = net.IP(attr.Value)
+		case unix.IFA_ADDRESS:
+			if ip == nil {
+				ip = net.IP(attr.Value)
+			}
+		}
+	}
+
+	if ip == nil {
+		return AdapterEvent{}, false
+	}
+
+	bits := 32
+
+	if ifaddr.Family == unix.AF_INET6 {
+		bits = 128
+	}
+
+	eventType := AdapterAddressRemoved
+
+	if added {
+		eventType = AdapterAddressAdded
+	}
+
+	return AdapterEvent{
+		Type:    eventType,
+		Address: &net.IPNet{IP: ip, Mask: net.CIDRMask(int(ifaddr.Prefixlen), bits)},
+	}, true
+}
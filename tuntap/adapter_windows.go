@@ -1,34 +1,96 @@
 package tuntap
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
 	"fmt"
-	"io"
 	"net"
-	"os/exec"
 	"runtime"
-	"strings"
 	"syscall"
 	"unsafe"
 
-	winio "github.com/Microsoft/go-winio"
 	"golang.org/x/sys/windows"
-	"golang.org/x/sys/windows/registry"
+	"golang.zx2c4.com/wintun"
+	"golang.zx2c4.com/wireguard/windows/tunnel/winipcfg"
 )
 
 const (
-	userModeDeviceDir   = "\\\\.\\Global\\"
-	tapWinSuffix        = ".tap"
-	adaptersRegistryKey = `SYSTEM\\CurrentControlSet\\Control\\Class\\{4D36E972-E325-11CE-BFC1-08002BE10318}`
-	tapComponentID      = "tap0901"
-	fileDeviceUnknown   = 0x00000022
-	methodBuffered      = 0x00000000
-	fileAnyAccess       = 0x00000000
+	fileDeviceUnknown = 0x00000022
+	methodBuffered    = 0x00000000
+	fileAnyAccess     = 0x00000000
+
+	// wintunRingCapacity is the size of the send/receive rings Wintun
+	// allocates for a session. 4 MiB comfortably buffers a burst of
+	// full-size packets without the adapter having to apply backpressure.
+	wintunRingCapacity = 0x400000
+
+	// wintunAdapterGUIDNamespace salts the hash deriveAdapterGUID derives a
+	// Wintun adapter's GUID from, so the derivation can't be confused with
+	// some other tool hashing the same adapter name.
+	wintunAdapterGUIDNamespace = "go-freelan/tuntap/wintun-adapter"
 )
 
-var (
-	tapWinIoctlSetMediaStatus = tapCtlCode(6)
-	tapWinIoctlConfigTun      = tapCtlCode(10)
-)
+// NewAdapter instantiates a Windows virtual adapter, choosing between the
+// legacy TAP-Windows6 driver and the modern Wintun driver according to
+// config.WindowsDriver. WindowsDriverAuto, the default, prefers Wintun
+// when wintun.dll can be loaded and falls back to TAP-Windows6 otherwise,
+// since Wintun needs no pre-installed adapter and gives significantly
+// better throughput, but isn't guaranteed to be present on every machine.
+func NewAdapter(config *AdapterConfig) (Adapter, error) {
+	if config == nil {
+		config = NewAdapterConfig()
+	}
+
+	driver := config.WindowsDriver
+
+	if driver == WindowsDriverAuto {
+		if wintunAvailable() {
+			driver = WindowsDriverWintun
+		} else {
+			driver = WindowsDriverTAP
+		}
+	}
+
+	if driver == WindowsDriverWintun {
+		return NewTunAdapter(config)
+	}
+
+	return NewTapAdapter(config)
+}
+
+// wintunAvailable reports whether wintun.dll can be located and loaded.
+// The library is unloaded immediately afterwards; NewTunAdapter loads it
+// again for real, through the wintun package, when it actually opens a
+// session.
+func wintunAvailable() bool {
+	dll, err := windows.LoadLibrary("wintun.dll")
+
+	if err != nil {
+		return false
+	}
+
+	windows.FreeLibrary(dll)
+
+	return true
+}
+
+// deriveAdapterGUID deterministically derives a Wintun adapter GUID from
+// name, so that restarting with the same name reuses the same interface
+// instead of Windows creating (and leaking) a brand new one on every run.
+func deriveAdapterGUID(name string) *windows.GUID {
+	sum := sha256.Sum256([]byte(wintunAdapterGUIDNamespace + "\x00" + name))
+
+	return &windows.GUID{
+		Data1: binary.BigEndian.Uint32(sum[0:4]),
+		Data2: binary.BigEndian.Uint16(sum[4:6]),
+		Data3: binary.BigEndian.Uint16(sum[6:8]),
+		Data4: [8]byte{sum[8], sum[9], sum[10], sum[11], sum[12], sum[13], sum[14], sum[15]},
+	}
+}
+
+var tapWinIoctlSetMediaStatus = tapCtlCode(6)
 
 func tapCtlCode(function uint32) uint32 {
 	return ctlCode(fileDeviceUnknown, function, methodBuffered, fileAnyAccess)
@@ -38,249 +100,442 @@ func ctlCode(deviceType, function, method, access uint32) uint32 {
 	return (deviceType << 16) | (access << 14) | (function << 2) | method
 }
 
-type adapterImpl struct {
-	io.ReadWriteCloser
-	handle syscall.Handle
-	inf    *net.Interface
-	mode   adapterMode
-}
-type adapterMode int
-
-const (
-	tapAdapter adapterMode = iota
-	tunAdapter
+var (
+	modIphlpapi                      = windows.NewLazySystemDLL("iphlpapi.dll")
+	procFlushIpNetTable2             = modIphlpapi.NewProc("FlushIpNetTable2")
+	procNotifyIpInterfaceChange      = modIphlpapi.NewProc("NotifyIpInterfaceChange")
+	procNotifyUnicastIpAddressChange = modIphlpapi.NewProc("NotifyUnicastIpAddressChange")
+	procNotifyRouteChange2           = modIphlpapi.NewProc("NotifyRouteChange2")
+	procCancelMibChangeNotify2       = modIphlpapi.NewProc("CancelMibChangeNotify2")
 )
 
-func newAdapter(name string, mode adapterMode) (*adapterImpl, error) {
-	aas, err := getTapAdaptersAddresses()
+// adapterLUID resolves the NET_LUID the IP Helper API identifies inf by,
+// via ConvertInterfaceIndexToLuid, so configureWindowsInterface and
+// flushNeighbors can address it without going through its (mutable)
+// friendly name.
+func adapterLUID(inf *net.Interface) (winipcfg.LUID, error) {
+	var luid uint64
+
+	if err := windows.ConvertInterfaceIndexToLuid(uint32(inf.Index), &luid); err != nil {
+		return 0, fmt.Errorf("resolving LUID for %q: %s", inf.Name, err)
+	}
+
+	return winipcfg.LUID(luid), nil
+}
+
+// configureWindowsInterface applies addr/MTU/metric/DNS settings from
+// config to inf in one pass, through the IP Helper API (via winipcfg)
+// rather than shelling out to netsh: netsh fails silently without
+// administrative rights and its locale-dependent output can't be parsed
+// reliably, whereas CreateUnicastIpAddressEntry, SetIpInterfaceEntry and
+// SetInterfaceDnsSettings return proper Win32 error codes.
+func configureWindowsInterface(inf *net.Interface, config *AdapterConfig) error {
+	luid, err := adapterLUID(inf)
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to get tap adapters addresses: %s", err)
+		return err
 	}
 
-	var h syscall.Handle
-	var aa adapterAddresses
+	if config.IPv4 != nil {
+		if err := luid.AddIPAddress(*config.IPv4); err != nil && !errors.Is(err, windows.ERROR_OBJECT_ALREADY_EXISTS) {
+			return fmt.Errorf("setting IPv4 address to %s: %s", config.IPv4, err)
+		}
+	}
 
-	for _, aa = range aas {
-		if name == "" || name == aa.Name {
-			if h, err = openTapAdapter(aa.Name); err == nil {
-				break
-			}
+	if config.IPv6 != nil {
+		if err := luid.AddIPAddress(*config.IPv6); err != nil && !errors.Is(err, windows.ERROR_OBJECT_ALREADY_EXISTS) {
+			return fmt.Errorf("setting IPv6 address to %s: %s", config.IPv6, err)
+		}
+	}
 
-			if name != "" {
-				return nil, fmt.Errorf("failed to open TAP adapter `%s`: %s", name, err)
-			}
+	if config.MTU != 0 || config.Metric != 0 {
+		if err := setInterfaceMTUAndMetric(luid, config.MTU, config.Metric); err != nil {
+			return err
 		}
 	}
 
-	if h == 0 {
-		return nil, fmt.Errorf("no available TAP adapter were found")
+	if len(config.DNSServers) != 0 {
+		if err := luid.SetDNS(winipcfg.AddressFamily(windows.AF_INET), config.DNSServers, nil); err != nil {
+			return fmt.Errorf("setting DNS servers: %s", err)
+		}
 	}
 
-	inf, err := net.InterfaceByIndex(aa.Index)
+	return nil
+}
 
-	if err != nil {
-		return nil, fmt.Errorf("failed to get interface details for `%s`: %v", aa.FriendlyName, err)
+// setInterfaceMTUAndMetric updates the IPv4 and IPv6 MIB_IPINTERFACE_ROW
+// entries for luid via GetIpInterfaceEntry/SetIpInterfaceEntry. IPv6 is
+// skipped rather than failed if it is disabled on the interface; IPv4 is
+// always expected to be present.
+func setInterfaceMTUAndMetric(luid winipcfg.LUID, mtu int, metric uint32) error {
+	for _, family := range []winipcfg.AddressFamily{windows.AF_INET, windows.AF_INET6} {
+		row, err := luid.IPInterface(family)
+
+		if err != nil {
+			if family == windows.AF_INET6 {
+				continue
+			}
+
+			return fmt.Errorf("fetching the IPv4 interface entry: %s", err)
+		}
+
+		if mtu != 0 {
+			row.NLMTU = uint32(mtu)
+		}
+
+		if metric != 0 {
+			row.UseAutomaticMetric = false
+			row.Metric = metric
+		}
+
+		if err := row.Set(); err != nil {
+			return fmt.Errorf("setting MTU/metric: %s", err)
+		}
 	}
 
-	rwc, err := winio.MakeOpenFile(h)
+	return nil
+}
+
+// flushNeighbors discards every dynamically-learned ARP/NDP entry for
+// inf, via the IP Helper API's FlushIpNetTable2, in place of the
+// `netsh interface ip delete neighbors` command this used to run.
+func flushNeighbors(inf *net.Interface) error {
+	luid, err := adapterLUID(inf)
 
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	adapter := &adapterImpl{rwc, h, inf, mode}
-	runtime.SetFinalizer(adapter, (*adapterImpl).Close)
+	ret, _, _ := procFlushIpNetTable2.Call(uintptr(windows.AF_UNSPEC), uintptr(luid))
 
-	if mode == tunAdapter {
-		if err = adapter.setTunMode(nil); err != nil {
-			adapter.Close()
-			return nil, err
-		}
+	if ret != 0 {
+		return fmt.Errorf("FlushIpNetTable2 failed with status 0x%x", ret)
 	}
 
-	if err = adapter.SetConnectedState(true); err != nil {
-		adapter.Close()
-		return nil, fmt.Errorf("failed to bring the device up: %s", err)
-	}
+	return nil
+}
 
-	// Access denied is okay: the user may not have administrative rights.
-	if err = adapter.FlushARPTable(); err != nil && err != windows.ERROR_ACCESS_DENIED {
-		return nil, fmt.Errorf("failed to flush ARP table: %s", err)
+// registerChangeNotify calls one of the IP Helper API's
+// Notify*Change(2) functions, which all share the signature
+// (Family, Callback, CallerContext, InitialNotification, *NotificationHandle),
+// and returns the handle CancelMibChangeNotify2 later cancels the
+// registration with.
+func registerChangeNotify(proc *windows.LazyProc, family uint32, callback uintptr) (windows.Handle, error) {
+	var handle windows.Handle
+
+	ret, _, _ := proc.Call(uintptr(family), callback, 0, 0, uintptr(unsafe.Pointer(&handle)))
+
+	if ret != 0 {
+		return 0, fmt.Errorf("%s failed with status 0x%x", proc.Name, ret)
 	}
 
-	return adapter, nil
+	return handle, nil
 }
 
-// NewTapAdapter instantiates a new tap adapter.
-func NewTapAdapter(config *TapAdapterConfig) (TapAdapter, error) {
-	if config == nil {
-		config = NewTapAdapterConfig()
+func cancelChangeNotify(handle windows.Handle) {
+	procCancelMibChangeNotify2.Call(uintptr(handle))
+}
+
+// windowsInterfaceState is the subset of inf's state watchWindowsInterface
+// polls for, keyed so diffInterfaceState can tell additions from removals.
+type windowsInterfaceState struct {
+	up        bool
+	mtu       int
+	addresses map[string]*net.IPNet
+}
+
+func pollInterfaceState(index int) (windowsInterfaceState, error) {
+	inf, err := net.InterfaceByIndex(index)
+
+	if err != nil {
+		return windowsInterfaceState{}, err
 	}
 
-	adapter, err := newAdapter(config.Name, tapAdapter)
+	addrs, err := inf.Addrs()
 
 	if err != nil {
-		return nil, err
+		return windowsInterfaceState{}, err
 	}
 
-	if config.IPv4 != nil {
-		adapter.SetIPv4(config.IPv4)
+	state := windowsInterfaceState{
+		up:        inf.Flags&net.FlagUp != 0,
+		mtu:       inf.MTU,
+		addresses: make(map[string]*net.IPNet, len(addrs)),
 	}
 
-	if config.IPv6 != nil {
-		adapter.SetIPv6(config.IPv6)
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok {
+			state.addresses[ipnet.String()] = ipnet
+		}
 	}
 
-	return adapter, nil
+	return state, nil
 }
 
-// NewTunAdapter instantiates a new tun adapter.
-func NewTunAdapter(config *TunAdapterConfig) (TunAdapter, error) {
-	if config == nil {
-		config = NewTunAdapterConfig()
-	}
+func diffInterfaceState(previous, next windowsInterfaceState) []AdapterEvent {
+	var events []AdapterEvent
 
-	adapter, err := newAdapter(config.Name, tunAdapter)
+	if previous.up != next.up {
+		eventType := AdapterLinkDown
 
-	if err != nil {
-		return nil, err
+		if next.up {
+			eventType = AdapterLinkUp
+		}
+
+		events = append(events, AdapterEvent{Type: eventType})
 	}
 
-	if config.IPv4 != nil {
-		adapter.SetIPv4(config.IPv4)
+	if previous.mtu != 0 && previous.mtu != next.mtu {
+		events = append(events, AdapterEvent{Type: AdapterMTUChanged, MTU: next.mtu})
 	}
 
-	if config.IPv6 != nil {
-		adapter.SetIPv6(config.IPv6)
+	for key, ipnet := range next.addresses {
+		if _, ok := previous.addresses[key]; !ok {
+			events = append(events, AdapterEvent{Type: AdapterAddressAdded, Address: ipnet})
+		}
 	}
 
-	return adapter, nil
+	for key, ipnet := range previous.addresses {
+		if _, ok := next.addresses[key]; !ok {
+			events = append(events, AdapterEvent{Type: AdapterAddressRemoved, Address: ipnet})
+		}
+	}
+
+	return events
 }
 
-func (a *adapterImpl) FlushARPTable() error {
-	lib, err := syscall.LoadLibrary("iphlpapi.dll")
+// watchWindowsInterface streams changes to inf until ctx is done. Rather
+// than decode the notification callbacks' MIB_IPINTERFACE_ROW/
+// MIB_UNICASTIPADDRESS_ROW payloads, whose layout isn't worth depending on
+// here, it treats NotifyIpInterfaceChange/NotifyUnicastIpAddressChange
+// firing as a cue to re-poll inf through net.InterfaceByIndex and diff the
+// result against what was last observed; NotifyRouteChange2 firing is
+// reported directly as AdapterDefaultRouteChanged.
+func watchWindowsInterface(ctx context.Context, inf *net.Interface) (<-chan AdapterEvent, error) {
+	stateChanged := make(chan struct{}, 1)
+	routeChanged := make(chan struct{}, 1)
+
+	notifyState := func(_, _ uintptr, _ int32) uintptr {
+		select {
+		case stateChanged <- struct{}{}:
+		default:
+		}
 
-	if err != nil {
-		return fmt.Errorf("unable to load library: %s", err)
+		return 0
+	}
+
+	notifyRoute := func(_, _ uintptr, _ int32) uintptr {
+		select {
+		case routeChanged <- struct{}{}:
+		default:
+		}
+
+		return 0
 	}
 
-	addr, err := syscall.GetProcAddress(syscall.Handle(lib), "FlushIpNetTable")
+	ifaceHandle, err := registerChangeNotify(procNotifyIpInterfaceChange, windows.AF_UNSPEC, windows.NewCallback(notifyState))
 
 	if err != nil {
-		return fmt.Errorf("unable to get procedure address: %s", err)
+		return nil, fmt.Errorf("watching %s: %s", inf.Name, err)
 	}
 
-	r, _, _ := syscall.Syscall(addr, 1, uintptr(a.Interface().Index), 0, 0)
+	addrHandle, err := registerChangeNotify(procNotifyUnicastIpAddressChange, windows.AF_UNSPEC, windows.NewCallback(notifyState))
+
+	if err != nil {
+		cancelChangeNotify(ifaceHandle)
 
-	switch r {
-	case windows.NO_ERROR:
-		return nil
-	default:
-		return syscall.Errno(r)
+		return nil, fmt.Errorf("watching %s: %s", inf.Name, err)
 	}
-}
 
-func (a *adapterImpl) Close() error {
-	a.SetConnectedState(false)
-	runtime.SetFinalizer(a, nil)
+	routeHandle, err := registerChangeNotify(procNotifyRouteChange2, windows.AF_UNSPEC, windows.NewCallback(notifyRoute))
 
-	return a.ReadWriteCloser.Close()
+	if err != nil {
+		cancelChangeNotify(ifaceHandle)
+		cancelChangeNotify(addrHandle)
+
+		return nil, fmt.Errorf("watching %s: %s", inf.Name, err)
+	}
+
+	events := make(chan AdapterEvent)
+
+	go func() {
+		defer close(events)
+		defer cancelChangeNotify(ifaceHandle)
+		defer cancelChangeNotify(addrHandle)
+		defer cancelChangeNotify(routeHandle)
+
+		state, _ := pollInterfaceState(inf.Index)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-routeChanged:
+				select {
+				case events <- AdapterEvent{Type: AdapterDefaultRouteChanged}:
+				case <-ctx.Done():
+					return
+				}
+			case <-stateChanged:
+				next, err := pollInterfaceState(inf.Index)
+
+				if err != nil {
+					continue
+				}
+
+				for _, event := range diffInterfaceState(state, next) {
+					select {
+					case events <- event:
+					case <-ctx.Done():
+						return
+					}
+				}
+
+				state = next
+			}
+		}
+	}()
+
+	return events, nil
 }
 
-func (a *adapterImpl) setTunMode(ip *net.IPNet) error {
-	var bytesReturned uint32
-	var data [12]byte
-	var unused [4]byte
+// reapplyConfigOnRevert watches inf and re-applies config's IPv4/IPv6/MTU
+// whenever one of them appears to have been silently reverted, a
+// well-documented pitfall when the interface is re-enumerated or the
+// driver re-attaches. It runs for the lifetime of ctx, which
+// NewTapAdapter/NewTunAdapter cancel from Close.
+func reapplyConfigOnRevert(ctx context.Context, inf *net.Interface, config *AdapterConfig) {
+	events, err := watchWindowsInterface(ctx, inf)
 
-	if ip != nil {
-		copy(data[0:4], ip.IP.To4())
-		copy(data[4:8], ip.IP.Mask(ip.Mask))
-		copy(data[8:12], ip.Mask)
+	if err != nil {
+		return
 	}
 
-	return syscall.DeviceIoControl(
-		a.handle,
-		tapWinIoctlConfigTun,
-		&data[0],
-		uint32(len(data)),
-		&unused[0],
-		uint32(len(unused)),
-		&bytesReturned,
-		nil,
-	)
+	for event := range events {
+		switch event.Type {
+		case AdapterAddressRemoved:
+			if (config.IPv4 != nil && event.Address.IP.Equal(config.IPv4.IP)) ||
+				(config.IPv6 != nil && event.Address.IP.Equal(config.IPv6.IP)) {
+				configureWindowsInterface(inf, config)
+			}
+		case AdapterMTUChanged:
+			if config.MTU != 0 && event.MTU != config.MTU {
+				configureWindowsInterface(inf, config)
+			}
+		}
+	}
 }
 
-func (a *adapterImpl) SetIPv4(ip *net.IPNet) error {
-	if a.mode == tunAdapter {
-		if err := a.setTunMode(ip); err != nil {
-			return err
+// tapAdapterImpl backs a tap (Ethernet) adapter opened through the
+// TAP-Windows6 IOCTL interface. Adapters are enumerated and selected via
+// ListTAPAdapters.
+type tapAdapterImpl struct {
+	*overlappedFile
+	inf         *net.Interface
+	config      *AdapterConfig
+	watchCancel context.CancelFunc
+}
+
+// NewTapAdapter instantiates a new tap adapter backed by a TAP-Windows6
+// device.
+//
+// If config.Name is set, it is matched against each candidate's Name and
+// FriendlyName; otherwise the first TAP-Windows6 adapter found is used.
+// Wintun adapters are skipped, since Wintun only ever exposes a tun (IP)
+// interface; use NewTunAdapter for those.
+func NewTapAdapter(config *AdapterConfig) (Adapter, error) {
+	if config == nil {
+		config = NewAdapterConfig()
+	}
+
+	adapters, err := ListTAPAdapters()
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list TAP adapters: %s", err)
+	}
+
+	var selected *TAPAdapterInfo
+
+	for i, aa := range adapters {
+		if aa.ComponentID == wintunComponentID {
+			continue
+		}
+
+		if config.Name == "" || config.Name == aa.Name || config.Name == aa.FriendlyName {
+			selected = &adapters[i]
+			break
 		}
 	}
 
-	ones, _ := ip.Mask.Size()
-	args := []string{
-		"interface",
-		"ip",
-		"set",
-		"address",
-		"name=" + a.inf.Name,
-		"source=static",
-		fmt.Sprintf("address=%s/%d", ip.IP, ones),
-		"gateway=none",
-		"store=active",
+	if selected == nil {
+		if config.Name != "" {
+			return nil, fmt.Errorf("no TAP-Windows6 adapter found matching %q", config.Name)
+		}
+
+		return nil, errors.New("no TAP-Windows6 adapter was found")
 	}
 
-	// This will always fail silently if the caller doesn't have administrative rights...
-	//
-	// As such, Windows should always rely on the fake DHCP emulation for IPv4
-	// address configuration.
-	return a.netsh(args...)
-}
+	path := fmt.Sprintf("%s%s%s", userModeDeviceDir, selected.GUID, tapWinSuffix)
+	pathp, err := syscall.UTF16PtrFromString(path)
 
-func (a *adapterImpl) SetIPv6(ip *net.IPNet) error {
-	// This will always fail silently if the caller doesn't have administrative rights...
-	//
-	// As such, Windows should always rely on the fake DHCP emulation for IPv6
-	// address configuration.
-	ones, _ := ip.Mask.Size()
-	args := []string{
-		"interface",
-		"ipv6",
-		"set",
-		"address",
-		"interface=" + a.inf.Name,
-		fmt.Sprintf("address=%s/%d", ip.IP, ones),
-		"store=active",
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert path to UTF16: %s", err)
 	}
 
-	return a.netsh(args...)
-}
+	h, err := windows.CreateFile(
+		pathp,
+		syscall.GENERIC_READ|syscall.GENERIC_WRITE,
+		0,
+		nil,
+		syscall.OPEN_EXISTING,
+		syscall.FILE_ATTRIBUTE_SYSTEM|syscall.FILE_FLAG_OVERLAPPED,
+		0,
+	)
 
-func (a *adapterImpl) netsh(args ...string) error {
-	cmd := exec.Command("netsh", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %s", path, err)
+	}
 
-	// netsh failure isn't properly reported through Run() and its output is
-	// locale-dependent, making any parsing impossible...
-	err := cmd.Run()
+	inf, err := net.InterfaceByIndex(selected.Index)
 
 	if err != nil {
-		return fmt.Errorf("failed to call `netsh %s`: %s", strings.Join(args, " "), err)
+		windows.Close(h)
+
+		return nil, fmt.Errorf("failed to get interface details for `%s`: %v", selected.FriendlyName, err)
 	}
 
-	return nil
-}
+	adapter := &tapAdapterImpl{
+		overlappedFile: newOverlappedFile(h, selected.GUID),
+		inf:            inf,
+		config:         config,
+	}
 
-func (a *adapterImpl) Interface() *net.Interface {
-	return a.inf
+	runtime.SetFinalizer(adapter.overlappedFile, (*overlappedFile).Close)
+
+	if err := adapter.setMediaStatus(true); err != nil {
+		adapter.Close()
+
+		return nil, fmt.Errorf("failed to bring up %s: %s", selected.FriendlyName, err)
+	}
+
+	if err := configureWindowsInterface(inf, config); err != nil {
+		adapter.Close()
+		return nil, err
+	}
+
+	watchCtx, cancel := context.WithCancel(context.Background())
+	adapter.watchCancel = cancel
+
+	go reapplyConfigOnRevert(watchCtx, inf, config)
+
+	return adapter, nil
 }
 
-func (a *adapterImpl) SetConnectedState(connected bool) error {
+// setMediaStatus issues the TAP_WIN_IOCTL_SET_MEDIA_STATUS DeviceIoControl,
+// bringing the virtual media link up (connected) or down.
+func (a *tapAdapterImpl) setMediaStatus(connected bool) error {
 	var bytesReturned uint32
 	var status [4]byte
-
-	// syscall.DeviceIoControl requires an output buffer whereas the original
-	// C++ code did not.
 	var unused [4]byte
 
 	if connected {
@@ -288,7 +543,7 @@ func (a *adapterImpl) SetConnectedState(connected bool) error {
 	}
 
 	return syscall.DeviceIoControl(
-		a.handle,
+		syscall.Handle(a.fd),
 		tapWinIoctlSetMediaStatus,
 		&status[0],
 		uint32(len(status)),
@@ -299,77 +554,396 @@ func (a *adapterImpl) SetConnectedState(connected bool) error {
 	)
 }
 
-func getTapAdaptersNames() ([]string, error) {
-	root, err := registry.OpenKey(registry.LOCAL_MACHINE, adaptersRegistryKey, registry.READ)
+func (a *tapAdapterImpl) Interface() *net.Interface {
+	return a.inf
+}
+
+func (a *tapAdapterImpl) Config() AdapterConfig {
+	return *a.config
+}
+
+// IPv4 returns the adapter's current IPv4 address, or a nil *net.IPNet if
+// it has none.
+func (a *tapAdapterImpl) IPv4() (*net.IPNet, error) {
+	return interfaceIPv4(a.inf)
+}
+
+// IPv6 returns the adapter's current IPv6 address, or a nil *net.IPNet if
+// it has none.
+func (a *tapAdapterImpl) IPv6() (*net.IPNet, error) {
+	return interfaceIPv6(a.inf)
+}
+
+// FlushARPTable discards every dynamically-learned ARP entry for the
+// adapter, via the IP Helper API rather than shelling out to netsh.
+func (a *tapAdapterImpl) FlushARPTable() error {
+	return flushNeighbors(a.inf)
+}
+
+func (a *tapAdapterImpl) AddRoute(route Route) error {
+	return addRouteWindows(a.inf, route)
+}
+
+func (a *tapAdapterImpl) DelRoute(route Route) error {
+	return delRouteWindows(a.inf, route)
+}
+
+func (a *tapAdapterImpl) ListRoutes() ([]Route, error) {
+	return listRoutesWindows(a.inf)
+}
+
+// Watch streams changes to the adapter's interface until ctx is done.
+func (a *tapAdapterImpl) Watch(ctx context.Context) (<-chan AdapterEvent, error) {
+	return watchWindowsInterface(ctx, a.inf)
+}
+
+func (a *tapAdapterImpl) Close() error {
+	if a.watchCancel != nil {
+		a.watchCancel()
+	}
+
+	a.setMediaStatus(false)
+
+	return a.overlappedFile.Close()
+}
+
+// tunAdapterImpl backs a tun (IP) adapter opened through the Wintun
+// driver's user-mode session API.
+type tunAdapterImpl struct {
+	wtAdapter   *wintun.Adapter
+	session     wintun.Session
+	inf         *net.Interface
+	config      *AdapterConfig
+	watchCancel context.CancelFunc
+}
+
+// NewTunAdapter instantiates a new tun adapter backed by Wintun.
+//
+// Unlike TAP-Windows6 adapters, a Wintun adapter is created on demand
+// rather than selected among pre-installed ones: config.Name becomes the
+// new adapter's name, or "go-freelan" if empty.
+func NewTunAdapter(config *AdapterConfig) (Adapter, error) {
+	if config == nil {
+		config = NewAdapterConfig()
+	}
+
+	name := config.Name
+
+	if name == "" {
+		name = "go-freelan"
+	}
+
+	wtAdapter, err := wintun.CreateAdapter(name, "go-freelan", deriveAdapterGUID(name))
 
 	if err != nil {
-		return nil, fmt.Errorf("opening root key at `%s`: %s", adaptersRegistryKey, err)
+		return nil, fmt.Errorf("creating the Wintun adapter %q: %s", name, err)
 	}
 
-	defer root.Close()
+	session, err := wtAdapter.StartSession(wintunRingCapacity)
 
-	names, err := root.ReadSubKeyNames(0)
+	if err != nil {
+		wtAdapter.Close()
+
+		return nil, fmt.Errorf("starting the Wintun session: %s", err)
+	}
+
+	inf, err := net.InterfaceByName(name)
 
 	if err != nil {
-		return nil, fmt.Errorf("enumerating sub-keys: %s", err)
+		session.End()
+		wtAdapter.Close()
+
+		return nil, fmt.Errorf("failed to get interface details for `%s`: %v", name, err)
+	}
+
+	adapter := &tunAdapterImpl{
+		wtAdapter: wtAdapter,
+		session:   session,
+		inf:       inf,
+		config:    config,
 	}
 
-	result := make([]string, 0, len(names))
+	if err := configureWindowsInterface(inf, config); err != nil {
+		adapter.Close()
+		return nil, err
+	}
 
-	for _, name := range names {
-		k, err := registry.OpenKey(root, name, registry.READ)
+	watchCtx, cancel := context.WithCancel(context.Background())
+	adapter.watchCancel = cancel
 
-		if err != nil {
-			continue
+	go reapplyConfigOnRevert(watchCtx, inf, config)
+
+	return adapter, nil
+}
+
+// Read blocks until a packet is available and copies it into p.
+func (a *tunAdapterImpl) Read(p []byte) (int, error) {
+	for {
+		packet, err := a.session.ReceivePacket()
+
+		if err == nil {
+			n := copy(p, packet)
+			a.session.ReleaseReceivePacket(packet)
+
+			return n, nil
+		}
+
+		if err != windows.ERROR_NO_MORE_ITEMS {
+			return 0, err
+		}
+
+		if _, err := windows.WaitForSingleObject(a.session.ReadWaitEvent(), windows.INFINITE); err != nil {
+			return 0, err
 		}
+	}
+}
+
+func (a *tunAdapterImpl) Write(p []byte) (int, error) {
+	packet, err := a.session.AllocateSendPacket(len(p))
+
+	if err != nil {
+		return 0, err
+	}
+
+	copy(packet, p)
+	a.session.SendPacket(packet)
+
+	return len(p), nil
+}
 
-		defer k.Close()
+// ReadPackets reads up to len(bufs) packets from the Wintun session and
+// returns the number of packets read. It waits for the first packet, then
+// drains any further packets already queued in the receive ring under
+// that same wait, stopping once the ring is empty or bufs is full.
+func (a *tunAdapterImpl) ReadPackets(bufs [][]byte, sizes []int) (int, error) {
+	n := 0
 
-		componentID, _, err := k.GetStringValue("ComponentId")
+	for n < len(bufs) {
+		packet, err := a.session.ReceivePacket()
 
-		if err == nil && componentID == tapComponentID {
-			ifName, _, err := k.GetStringValue("NetCfgInstanceId")
+		if err == nil {
+			sizes[n] = copy(bufs[n], packet)
+			a.session.ReleaseReceivePacket(packet)
+			n++
 
-			if err != nil {
-				return nil, fmt.Errorf("reading NetCfgInstanceId from `%s`: %s", name, err)
+			continue
+		}
+
+		if err != windows.ERROR_NO_MORE_ITEMS {
+			if n > 0 {
+				return n, nil
 			}
 
-			result = append(result, ifName)
+			return 0, err
+		}
+
+		if n > 0 {
+			return n, nil
+		}
+
+		if _, err := windows.WaitForSingleObject(a.session.ReadWaitEvent(), windows.INFINITE); err != nil {
+			return 0, err
 		}
 	}
 
-	return result, nil
+	return n, nil
 }
 
-type adapterAddresses struct {
-	Name         string
-	Description  string
-	FriendlyName string
-	Index        int
+// WritePackets writes each of bufs as a separate packet to the Wintun
+// session and returns the number of packets written.
+func (a *tunAdapterImpl) WritePackets(bufs [][]byte) (int, error) {
+	for i, buf := range bufs {
+		packet, err := a.session.AllocateSendPacket(len(buf))
+
+		if err != nil {
+			return i, err
+		}
+
+		copy(packet, buf)
+		a.session.SendPacket(packet)
+	}
+
+	return len(bufs), nil
+}
+
+func (a *tunAdapterImpl) Close() error {
+	if a.watchCancel != nil {
+		a.watchCancel()
+	}
+
+	a.session.End()
+
+	return a.wtAdapter.Close()
+}
+
+func (a *tunAdapterImpl) Interface() *net.Interface {
+	return a.inf
+}
+
+func (a *tunAdapterImpl) Config() AdapterConfig {
+	return *a.config
 }
 
-func getTapAdaptersAddresses() (result []adapterAddresses, err error) {
-	var names []string
+// IPv4 returns the adapter's current IPv4 address, or a nil *net.IPNet if
+// it has none.
+func (a *tunAdapterImpl) IPv4() (*net.IPNet, error) {
+	return interfaceIPv4(a.inf)
+}
+
+// IPv6 returns the adapter's current IPv6 address, or a nil *net.IPNet if
+// it has none.
+func (a *tunAdapterImpl) IPv6() (*net.IPNet, error) {
+	return interfaceIPv6(a.inf)
+}
+
+// FlushARPTable discards every dynamically-learned neighbor cache entry
+// for the adapter, via the IP Helper API rather than shelling out to
+// netsh.
+func (a *tunAdapterImpl) FlushARPTable() error {
+	return flushNeighbors(a.inf)
+}
+
+func (a *tunAdapterImpl) AddRoute(route Route) error {
+	return addRouteWindows(a.inf, route)
+}
+
+func (a *tunAdapterImpl) DelRoute(route Route) error {
+	return delRouteWindows(a.inf, route)
+}
+
+func (a *tunAdapterImpl) ListRoutes() ([]Route, error) {
+	return listRoutesWindows(a.inf)
+}
 
-	if names, err = getTapAdaptersNames(); err != nil {
-		return nil, fmt.Errorf("listing TAP adapters names: %s", err)
+// Watch streams changes to the adapter's interface until ctx is done.
+func (a *tunAdapterImpl) Watch(ctx context.Context) (<-chan AdapterEvent, error) {
+	return watchWindowsInterface(ctx, a.inf)
+}
+
+// interfaceIPv4 returns inf's current IPv4 address, or a nil *net.IPNet if
+// it has none.
+func interfaceIPv4(inf *net.Interface) (*net.IPNet, error) {
+	addrs, err := inf.Addrs()
+
+	if err != nil {
+		return nil, err
 	}
 
-	if result, err = getAdaptersAddresses(); err != nil {
-		return nil, fmt.Errorf("listing TAP adapters addreses: %s", err)
+	for _, addr := range addrs {
+		if ip, ipnet, err := net.ParseCIDR(addr.String()); err == nil {
+			if ipv4 := ip.To4(); ipv4 != nil {
+				return &net.IPNet{
+					IP:   ipv4,
+					Mask: ipnet.Mask,
+				}, nil
+			}
+		}
 	}
 
-	filteredResult := make([]adapterAddresses, 0, len(result))
+	return nil, nil
+}
+
+// interfaceIPv6 returns inf's current IPv6 address, or a nil *net.IPNet if
+// it has none.
+func interfaceIPv6(inf *net.Interface) (*net.IPNet, error) {
+	addrs, err := inf.Addrs()
+
+	if err != nil {
+		return nil, err
+	}
 
-	for _, aa := range result {
-		for _, name := range names {
-			if aa.Name == name {
-				filteredResult = append(filteredResult, aa)
+	for _, addr := range addrs {
+		if ip, ipnet, err := net.ParseCIDR(addr.String()); err == nil {
+			if ip.To4() == nil {
+				if ipv6 := ip.To16(); ipv6 != nil {
+					return &net.IPNet{
+						IP:   ipv6,
+						Mask: ipnet.Mask,
+					}, nil
+				}
 			}
 		}
 	}
 
-	return filteredResult, nil
+	return nil, nil
+}
+
+// addRouteWindows installs route on inf via the IP Helper API's
+// CreateIpForwardEntry2, bound to inf's LUID, treating an already-present
+// route as success.
+func addRouteWindows(inf *net.Interface, route Route) error {
+	luid, err := adapterLUID(inf)
+
+	if err != nil {
+		return err
+	}
+
+	if err := luid.AddRoute(*route.Dst, route.Gateway, route.Metric); err != nil {
+		if errors.Is(err, windows.ERROR_OBJECT_ALREADY_EXISTS) {
+			return nil
+		}
+
+		return fmt.Errorf("adding route for %s via %s: %s", route.Dst, route.Gateway, err)
+	}
+
+	return nil
+}
+
+// delRouteWindows removes route from inf via the IP Helper API's
+// DeleteIpForwardEntry2, treating an already-absent route as success.
+func delRouteWindows(inf *net.Interface, route Route) error {
+	luid, err := adapterLUID(inf)
+
+	if err != nil {
+		return err
+	}
+
+	if err := luid.DeleteRoute(*route.Dst, route.Gateway); err != nil {
+		if errors.Is(err, windows.ERROR_NOT_FOUND) {
+			return nil
+		}
+
+		return fmt.Errorf("deleting route for %s via %s: %s", route.Dst, route.Gateway, err)
+	}
+
+	return nil
+}
+
+// listRoutesWindows returns the routes the IP Helper API has bound to
+// inf's LUID, across both address families.
+func listRoutesWindows(inf *net.Interface) ([]Route, error) {
+	luid, err := adapterLUID(inf)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var routes []Route
+
+	for _, family := range []winipcfg.AddressFamily{windows.AF_INET, windows.AF_INET6} {
+		rows, err := luid.Routes(family)
+
+		if err != nil {
+			return nil, fmt.Errorf("listing routes: %s", err)
+		}
+
+		for _, row := range rows {
+			routes = append(routes, Route{
+				Dst:     &row.Destination,
+				Gateway: row.NextHop,
+				Metric:  row.Metric,
+			})
+		}
+	}
+
+	return routes, nil
+}
+
+type adapterAddresses struct {
+	Name         string
+	Description  string
+	FriendlyName string
+	Index        int
 }
 
 func getAdaptersAddresses() (result []adapterAddresses, err error) {
@@ -433,28 +1007,3 @@ func uint16PtrToString(b *uint16) string {
 
 	return syscall.UTF16ToString(buf)
 }
-
-func openTapAdapter(name string) (syscall.Handle, error) {
-	path := fmt.Sprintf("%s%s%s", userModeDeviceDir, name, tapWinSuffix)
-	pathp, err := syscall.UTF16PtrFromString(path)
-
-	if err != nil {
-		return 0, fmt.Errorf("failed to convert path to UTF16: %s", err)
-	}
-
-	h, err := syscall.CreateFile(
-		pathp,
-		syscall.GENERIC_READ|syscall.GENERIC_WRITE,
-		0,
-		nil,
-		syscall.OPEN_EXISTING,
-		syscall.FILE_ATTRIBUTE_SYSTEM|syscall.FILE_FLAG_OVERLAPPED,
-		0,
-	)
-
-	if err != nil {
-		return 0, fmt.Errorf("failed to open tap adapter `%s`: %s", name, err)
-	}
-
-	return h, nil
-}
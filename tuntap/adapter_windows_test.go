@@ -10,3 +10,18 @@ func TestTapCtlCode(t *testing.T) {
 		t.Errorf("expected: %08x\ngot     : %08x", expected, value)
 	}
 }
+
+func TestDeriveAdapterGUID(t *testing.T) {
+	a := deriveAdapterGUID("go-freelan0")
+	b := deriveAdapterGUID("go-freelan0")
+
+	if *a != *b {
+		t.Errorf("expected deriving the GUID for the same name twice to produce the same GUID, got %+v and %+v", a, b)
+	}
+
+	c := deriveAdapterGUID("go-freelan1")
+
+	if *a == *c {
+		t.Errorf("expected deriving the GUID for different names to produce different GUIDs, got %+v for both", a)
+	}
+}
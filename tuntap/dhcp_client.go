@@ -0,0 +1,569 @@
+package tuntap
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// DefaultDHCPAcquireTimeout bounds how long a single DISCOVER/REQUEST
+// exchange is retried for before it is given up on.
+const DefaultDHCPAcquireTimeout = time.Minute
+
+// dhcpMaxBackoff caps the exponential backoff between retransmissions.
+const dhcpMaxBackoff = 8 * time.Second
+
+// DHCPConfig is the configuration negotiated with a DHCP server.
+type DHCPConfig struct {
+	IPv4       *net.IPNet
+	Gateway    net.IP
+	DNSServers []net.IP
+	DomainName string
+	ServerID   net.IP
+	Expiry     time.Time
+}
+
+// AcquiredFunc is called by a DHCPClient whenever its lease changes. old is
+// the interface address configured beforehand, if any; new is the newly
+// acquired address, or nil when the lease is lost or released.
+type AcquiredFunc func(old, new *net.IPNet, cfg DHCPConfig)
+
+// DHCPClient implements the client half of DHCPv4 (RFC 2131) on top of a
+// TAPAdapter, driving DISCOVER -> OFFER -> REQUEST -> ACK to obtain an IPv4
+// address for the interface and renewing it for as long as Run runs,
+// analogous to gvisor/netstack's DHCP client.
+type DHCPClient struct {
+	Adapter TAPAdapter
+
+	// AcquireTimeout bounds how long a single DISCOVER/REQUEST exchange is
+	// retried for. It defaults to DefaultDHCPAcquireTimeout.
+	AcquireTimeout time.Duration
+
+	// Acquired, if set, is called every time the negotiated configuration
+	// changes: on initial acquisition, on renewal and on loss/release.
+	Acquired AcquiredFunc
+
+	mu     sync.Mutex
+	config DHCPConfig
+
+	renewNow   chan struct{}
+	releasedCh chan struct{}
+}
+
+// NewDHCPClient creates a DHCPClient bound to adapter.
+func NewDHCPClient(adapter TAPAdapter) *DHCPClient {
+	return &DHCPClient{
+		Adapter:        adapter,
+		AcquireTimeout: DefaultDHCPAcquireTimeout,
+		renewNow:       make(chan struct{}, 1),
+		releasedCh:     make(chan struct{}, 1),
+	}
+}
+
+// Config returns the currently negotiated configuration. The zero value is
+// returned if no lease is currently held.
+func (c *DHCPClient) Config() DHCPConfig {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.config
+}
+
+func (c *DHCPClient) setConfig(cfg DHCPConfig) {
+	c.mu.Lock()
+	old := c.config.IPv4
+	c.config = cfg
+	c.mu.Unlock()
+
+	if c.Acquired != nil {
+		c.Acquired(old, cfg.IPv4, cfg)
+	}
+}
+
+func (c *DHCPClient) clearConfig() {
+	c.mu.Lock()
+	old := c.config.IPv4
+	c.config = DHCPConfig{}
+	c.mu.Unlock()
+
+	if c.Acquired != nil {
+		c.Acquired(old, nil, DHCPConfig{})
+	}
+}
+
+// Renew asks Run to immediately attempt a lease renewal, instead of waiting
+// for the T1 timer to fire. If Run is not currently holding a lease, the
+// request stays pending (at most one) and is acted on as soon as it is.
+func (c *DHCPClient) Renew() {
+	select {
+	case c.renewNow <- struct{}{}:
+	default:
+	}
+}
+
+// Release sends a RELEASE message for the current lease, if any, and clears
+// the negotiated configuration. It is safe to call whether or not Run is
+// currently running.
+func (c *DHCPClient) Release() error {
+	cfg := c.Config()
+
+	if cfg.IPv4 == nil {
+		return nil
+	}
+
+	xid, err := randomXid()
+
+	if err != nil {
+		return err
+	}
+
+	err = c.send(layers.DHCPMsgTypeRelease, xid, cfg.IPv4.IP, cfg.ServerID, layers.DHCPOptions{
+		layers.NewDHCPOption(layers.DHCPOptRequestIP, cfg.IPv4.IP.To4()),
+		layers.NewDHCPOption(layers.DHCPOptServerID, cfg.ServerID.To4()),
+	})
+
+	c.clearConfig()
+
+	select {
+	case c.releasedCh <- struct{}{}:
+	default:
+	}
+
+	return err
+}
+
+// Run drives the DHCP state machine until ctx is cancelled: it acquires a
+// lease, then renews it at T1, rebinds it at T2 and re-acquires it if it
+// expires, until ctx is done, at which point it returns nil after releasing
+// the lease. If acquiring a lease fails within AcquireTimeout, Run returns
+// that error instead, without retrying further.
+func (c *DHCPClient) Run(ctx context.Context) error {
+	msgs := make(chan *layers.DHCPv4, 8)
+
+	readCtx, cancelRead := context.WithCancel(ctx)
+	defer cancelRead()
+
+	go c.readLoop(readCtx, msgs)
+
+	defer c.Release()
+
+	for {
+		cfg, err := c.acquire(ctx, msgs)
+
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return err
+		}
+
+		c.setConfig(cfg)
+
+		if !c.holdLease(ctx, msgs, cfg) {
+			return nil
+		}
+
+		// The lease is lost: report it before acquiring a new one.
+		c.clearConfig()
+	}
+}
+
+// holdLease waits out the lease's T1/T2/expiry timers, renewing or
+// rebinding it as needed, until ctx is cancelled (returning false) or the
+// lease needs to be entirely re-acquired (returning true).
+func (c *DHCPClient) holdLease(ctx context.Context, msgs chan *layers.DHCPv4, cfg DHCPConfig) bool {
+	for {
+		t1 := jitter(time.Until(cfg.t1()))
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-c.renewNow:
+		case <-time.After(t1):
+		}
+
+		if time.Now().After(cfg.Expiry) {
+			return true
+		}
+
+		newCfg, err := c.renew(ctx, msgs, cfg, cfg.ServerID)
+
+		if err == nil {
+			cfg = newCfg
+			c.setConfig(cfg)
+			continue
+		}
+
+		if ctx.Err() != nil {
+			return false
+		}
+
+		// Unicast renewal failed: try to rebind by broadcasting instead,
+		// honoring T2.
+		if time.Now().Before(cfg.t2()) {
+			select {
+			case <-ctx.Done():
+				return false
+			case <-time.After(jitter(time.Until(cfg.t2()))):
+			}
+		}
+
+		newCfg, err = c.renew(ctx, msgs, cfg, nil)
+
+		if err != nil {
+			if ctx.Err() != nil {
+				return false
+			}
+
+			// The lease could not be renewed nor rebound: start over.
+			return true
+		}
+
+		cfg = newCfg
+		c.setConfig(cfg)
+	}
+}
+
+// t1 and t2 are the renewal (RENEWING) and rebinding (REBINDING) deadlines
+// for the lease, computed from the time remaining until Expiry, per
+// RFC 2131.
+func (l DHCPConfig) t1() time.Time { return time.Now().Add(dhcpT1(time.Until(l.Expiry))) }
+func (l DHCPConfig) t2() time.Time { return time.Now().Add(dhcpT2(time.Until(l.Expiry))) }
+
+// jitter randomizes d by +/-10%, and never returns a negative duration.
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+
+	// rand.Int panics on a zero bound, which d/5 is below 5ns.
+	if d < 5 {
+		return d
+	}
+
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(d)/5))
+
+	if err != nil {
+		return d
+	}
+
+	return d - time.Duration(d)/10 + time.Duration(n.Int64())
+}
+
+// acquire runs the DISCOVER -> OFFER -> REQUEST -> ACK exchange, retrying
+// with an exponential backoff bounded by AcquireTimeout.
+func (c *DHCPClient) acquire(ctx context.Context, msgs chan *layers.DHCPv4) (DHCPConfig, error) {
+	timeout := c.AcquireTimeout
+
+	if timeout <= 0 {
+		timeout = DefaultDHCPAcquireTimeout
+	}
+
+	acquireCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		xid, err := randomXid()
+
+		if err != nil {
+			return DHCPConfig{}, err
+		}
+
+		offer, err := c.transact(acquireCtx, msgs, layers.DHCPMsgTypeDiscover, xid, net.IPv4zero, nil, nil, layers.DHCPMsgTypeOffer)
+
+		if err != nil {
+			return DHCPConfig{}, err
+		}
+
+		serverID := getDHCPOption(offer.Options, layers.DHCPOptServerID)
+
+		if serverID == nil {
+			continue
+		}
+
+		ack, err := c.transact(
+			acquireCtx,
+			msgs,
+			layers.DHCPMsgTypeRequest,
+			xid,
+			net.IPv4zero,
+			net.IP(serverID.Data),
+			layers.DHCPOptions{
+				layers.NewDHCPOption(layers.DHCPOptRequestIP, []byte(offer.YourClientIP.To4())),
+				layers.NewDHCPOption(layers.DHCPOptServerID, serverID.Data),
+			},
+			layers.DHCPMsgTypeAck,
+		)
+
+		if err != nil {
+			if acquireCtx.Err() != nil {
+				return DHCPConfig{}, err
+			}
+
+			// The server NAK'd us, or a mismatched reply arrived: restart
+			// from DISCOVER with a fresh Xid.
+			continue
+		}
+
+		return configFromAck(ack), nil
+	}
+}
+
+// renew requests an extension of the current lease, unicast to serverID
+// when set (RENEWING) or broadcast otherwise (REBINDING).
+func (c *DHCPClient) renew(ctx context.Context, msgs chan *layers.DHCPv4, cfg DHCPConfig, serverID net.IP) (DHCPConfig, error) {
+	xid, err := randomXid()
+
+	if err != nil {
+		return DHCPConfig{}, err
+	}
+
+	opts := layers.DHCPOptions{
+		layers.NewDHCPOption(layers.DHCPOptRequestIP, cfg.IPv4.IP.To4()),
+	}
+
+	if serverID != nil {
+		opts = append(opts, layers.NewDHCPOption(layers.DHCPOptServerID, serverID.To4()))
+	}
+
+	renewCtx, cancel := context.WithTimeout(ctx, c.acquireTimeoutOrDefault())
+	defer cancel()
+
+	ack, err := c.transact(renewCtx, msgs, layers.DHCPMsgTypeRequest, xid, cfg.IPv4.IP, serverID, opts, layers.DHCPMsgTypeAck)
+
+	if err != nil {
+		return DHCPConfig{}, err
+	}
+
+	return configFromAck(ack), nil
+}
+
+func (c *DHCPClient) acquireTimeoutOrDefault() time.Duration {
+	if c.AcquireTimeout <= 0 {
+		return DefaultDHCPAcquireTimeout
+	}
+
+	return c.AcquireTimeout
+}
+
+// transact sends msgType and retransmits it with an exponential backoff
+// until a reply of wantType with a matching Xid (and, when serverID is set,
+// a matching DHCPOptServerID) is received, or ctx is done.
+func (c *DHCPClient) transact(ctx context.Context, msgs chan *layers.DHCPv4, msgType layers.DHCPMsgType, xid uint32, clientIP net.IP, serverID net.IP, opts layers.DHCPOptions, wantType layers.DHCPMsgType) (*layers.DHCPv4, error) {
+	backoff := time.Second
+
+	for {
+		if err := c.send(msgType, xid, clientIP, serverID, opts); err != nil {
+			return nil, err
+		}
+
+		timer := time.NewTimer(backoff)
+
+		for {
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, ctx.Err()
+			case <-timer.C:
+				goto retransmit
+			case msg := <-msgs:
+				if msg.Xid != xid {
+					continue
+				}
+
+				optMessageType := getDHCPOption(msg.Options, layers.DHCPOptMessageType)
+
+				if optMessageType == nil || len(optMessageType.Data) != 1 {
+					continue
+				}
+
+				got := layers.DHCPMsgType(optMessageType.Data[0])
+
+				if got == layers.DHCPMsgTypeNak {
+					timer.Stop()
+					return nil, fmt.Errorf("DHCP server refused the request (NAK)")
+				}
+
+				if got != wantType {
+					continue
+				}
+
+				if serverID != nil {
+					if opt := getDHCPOption(msg.Options, layers.DHCPOptServerID); opt == nil || !net.IP(opt.Data).Equal(serverID) {
+						// A different server's reply to our broadcast:
+						// ignore it and keep waiting for ours.
+						continue
+					}
+				}
+
+				timer.Stop()
+				return msg, nil
+			}
+		}
+
+	retransmit:
+		backoff *= 2
+
+		if backoff > dhcpMaxBackoff {
+			backoff = dhcpMaxBackoff
+		}
+	}
+}
+
+// readLoop decodes incoming DHCP replies from the adapter and pushes them to
+// msgs until ctx is done.
+func (c *DHCPClient) readLoop(ctx context.Context, msgs chan *layers.DHCPv4) {
+	b := make([]byte, 1500)
+
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		n, err := c.Adapter.Read(b)
+
+		if err != nil {
+			return
+		}
+
+		packet := gopacket.NewPacket(b[:n], layers.LayerTypeEthernet, gopacket.DecodeOptions{Lazy: true, NoCopy: true})
+
+		dhcp, ok := packet.Layer(layers.LayerTypeDHCPv4).(*layers.DHCPv4)
+
+		if !ok || dhcp == nil || dhcp.Operation != layers.DHCPOpReply {
+			continue
+		}
+
+		select {
+		case msgs <- dhcp:
+		case <-ctx.Done():
+			return
+		default:
+			// The caller isn't keeping up: drop the message rather than
+			// block the read loop.
+		}
+	}
+}
+
+// send builds and writes a single DHCP request frame.
+func (c *DHCPClient) send(msgType layers.DHCPMsgType, xid uint32, clientIP net.IP, serverID net.IP, opts layers.DHCPOptions) error {
+	iface := c.Adapter.Interface()
+
+	options := append(layers.DHCPOptions{
+		layers.NewDHCPOption(layers.DHCPOptMessageType, []byte{byte(msgType)}),
+	}, opts...)
+	options = append(options, layers.NewDHCPOption(layers.DHCPOptParamsRequest, []byte{
+		byte(layers.DHCPOptSubnetMask),
+		byte(layers.DHCPOptRouter),
+		byte(layers.DHCPOptDNS),
+		byte(layers.DHCPOptDomainName),
+		byte(layers.DHCPOptBroadcastAddr),
+		byte(layers.DHCPOptInterfaceMTU),
+	}))
+	options = append(options, layers.NewDHCPOption(layers.DHCPOptEnd, nil))
+
+	ethernet := &layers.Ethernet{
+		SrcMAC:       iface.HardwareAddr,
+		DstMAC:       net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+
+	dstIP := net.IPv4bcast
+
+	if serverID != nil && msgType != layers.DHCPMsgTypeDiscover {
+		dstIP = serverID
+	}
+
+	ipv4 := &layers.IPv4{
+		Version:  4,
+		IHL:      5,
+		TTL:      64,
+		Protocol: layers.IPProtocolUDP,
+		SrcIP:    clientIP,
+		DstIP:    dstIP,
+	}
+	udp := &layers.UDP{
+		SrcPort: 68,
+		DstPort: 67,
+	}
+	udp.SetNetworkLayerForChecksum(ipv4)
+
+	dhcp := &layers.DHCPv4{
+		Operation:    layers.DHCPOpRequest,
+		HardwareType: layers.LinkTypeEthernet,
+		HardwareLen:  uint8(len(iface.HardwareAddr)),
+		Xid:          xid,
+		ClientIP:     clientIP,
+		ClientHWAddr: iface.HardwareAddr,
+		Options:      options,
+	}
+
+	sbuf := gopacket.NewSerializeBuffer()
+	serializeOpts := gopacket.SerializeOptions{ComputeChecksums: true, FixLengths: true}
+
+	if err := gopacket.SerializeLayers(sbuf, serializeOpts, ethernet, ipv4, udp, dhcp); err != nil {
+		return fmt.Errorf("serializing DHCP %s: %s", msgType, err)
+	}
+
+	_, err := c.Adapter.Write(sbuf.Bytes())
+
+	return err
+}
+
+// configFromAck turns an ACK's options into a DHCPConfig.
+func configFromAck(ack *layers.DHCPv4) DHCPConfig {
+	cfg := DHCPConfig{
+		IPv4: &net.IPNet{
+			IP:   ack.YourClientIP,
+			Mask: net.CIDRMask(32, 32),
+		},
+		Expiry: time.Now().Add(DefaultDHCPLeaseTime),
+	}
+
+	if opt := getDHCPOption(ack.Options, layers.DHCPOptSubnetMask); opt != nil {
+		cfg.IPv4.Mask = net.IPMask(opt.Data)
+	}
+
+	if opt := getDHCPOption(ack.Options, layers.DHCPOptServerID); opt != nil {
+		cfg.ServerID = net.IP(opt.Data)
+	}
+
+	if opt := getDHCPOption(ack.Options, layers.DHCPOptRouter); opt != nil && len(opt.Data) >= 4 {
+		cfg.Gateway = net.IP(opt.Data[:4])
+	}
+
+	if opt := getDHCPOption(ack.Options, layers.DHCPOptDNS); opt != nil {
+		for i := 0; i+4 <= len(opt.Data); i += 4 {
+			cfg.DNSServers = append(cfg.DNSServers, net.IP(opt.Data[i:i+4]))
+		}
+	}
+
+	if opt := getDHCPOption(ack.Options, layers.DHCPOptDomainName); opt != nil {
+		cfg.DomainName = string(opt.Data)
+	}
+
+	if opt := getDHCPOption(ack.Options, layers.DHCPOptLeaseTime); opt != nil && len(opt.Data) == 4 {
+		cfg.Expiry = time.Now().Add(time.Duration(binary.BigEndian.Uint32(opt.Data)) * time.Second)
+	}
+
+	return cfg
+}
+
+func randomXid() (uint32, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1<<32))
+
+	if err != nil {
+		return 0, fmt.Errorf("generating a DHCP transaction id: %s", err)
+	}
+
+	return uint32(n.Int64()), nil
+}
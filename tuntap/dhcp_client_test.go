@@ -0,0 +1,95 @@
+package tuntap
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+)
+
+func TestConfigFromAck(t *testing.T) {
+	ack := &layers.DHCPv4{
+		YourClientIP: net.IPv4(192, 168, 1, 42),
+		Options: layers.DHCPOptions{
+			layers.NewDHCPOption(layers.DHCPOptSubnetMask, net.CIDRMask(24, 32)),
+			layers.NewDHCPOption(layers.DHCPOptServerID, net.IPv4(192, 168, 1, 1).To4()),
+			layers.NewDHCPOption(layers.DHCPOptRouter, net.IPv4(192, 168, 1, 1).To4()),
+			layers.NewDHCPOption(layers.DHCPOptDNS, append(net.IPv4(8, 8, 8, 8).To4(), net.IPv4(8, 8, 4, 4).To4()...)),
+			layers.NewDHCPOption(layers.DHCPOptDomainName, []byte("example.com")),
+			layers.NewDHCPOption(layers.DHCPOptLeaseTime, []byte{0x00, 0x00, 0x0e, 0x10}), // 3600s
+		},
+	}
+
+	cfg := configFromAck(ack)
+
+	if !cfg.IPv4.IP.Equal(net.IPv4(192, 168, 1, 42)) {
+		t.Errorf("expected IP %s, got %s", net.IPv4(192, 168, 1, 42), cfg.IPv4.IP)
+	}
+
+	if ones, _ := cfg.IPv4.Mask.Size(); ones != 24 {
+		t.Errorf("expected a /24 mask, got /%d", ones)
+	}
+
+	if !cfg.Gateway.Equal(net.IPv4(192, 168, 1, 1)) {
+		t.Errorf("expected gateway %s, got %s", net.IPv4(192, 168, 1, 1), cfg.Gateway)
+	}
+
+	if len(cfg.DNSServers) != 2 {
+		t.Fatalf("expected 2 DNS servers, got %d", len(cfg.DNSServers))
+	}
+
+	if cfg.DomainName != "example.com" {
+		t.Errorf("expected domain `example.com`, got `%s`", cfg.DomainName)
+	}
+
+	if d := time.Until(cfg.Expiry); d < 3599*time.Second || d > 3600*time.Second {
+		t.Errorf("expected expiry around 3600s from now, got %s", d)
+	}
+}
+
+func TestDHCPConfigT1T2(t *testing.T) {
+	cfg := DHCPConfig{Expiry: time.Now().Add(time.Hour)}
+
+	if d := time.Until(cfg.t1()); d < 29*time.Minute || d > 31*time.Minute {
+		t.Errorf("expected T1 around 30 minutes from now, got %s", d)
+	}
+
+	if d := time.Until(cfg.t2()); d < 52*time.Minute || d > 53*time.Minute {
+		t.Errorf("expected T2 around 52.5 minutes from now, got %s", d)
+	}
+}
+
+func TestJitter(t *testing.T) {
+	d := time.Minute
+
+	for i := 0; i < 20; i++ {
+		j := jitter(d)
+
+		if j < d*9/10 || j > d*11/10 {
+			t.Errorf("expected jitter within +/-10%% of %s, got %s", d, j)
+		}
+	}
+
+	if jitter(0) != 0 {
+		t.Errorf("expected no jitter for a non-positive duration")
+	}
+}
+
+func TestRandomXidIsNonDeterministic(t *testing.T) {
+	a, err := randomXid()
+
+	if err != nil {
+		t.Fatalf("expected no error: %s", err)
+	}
+
+	b, err := randomXid()
+
+	if err != nil {
+		t.Fatalf("expected no error: %s", err)
+	}
+
+	if a == b {
+		t.Errorf("expected two calls to randomXid to differ (got %d twice); this can rarely happen by chance", a)
+	}
+}
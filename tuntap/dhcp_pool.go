@@ -0,0 +1,378 @@
+package tuntap
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultDHCPLeaseTime is the lease duration used by a DHCPPool when none is
+// specified.
+const DefaultDHCPLeaseTime = 24 * time.Hour
+
+// DefaultDHCPDeclineCooldown is how long a declined address is withheld from
+// allocation by a DHCPPool when none is specified.
+const DefaultDHCPDeclineCooldown = time.Hour
+
+// DHCPLease represents an IP address lease handed out by a DHCPPool.
+type DHCPLease struct {
+	HardwareAddr net.HardwareAddr
+	IPv4         net.IP
+	Xid          uint32
+	Expiry       time.Time
+}
+
+func (l DHCPLease) expired(now time.Time) bool {
+	return !l.Expiry.IsZero() && !now.Before(l.Expiry)
+}
+
+// dhcpT1 is the renewal (T1) time advertised to the client: 50% of the
+// lease time, per RFC 2131.
+func dhcpT1(leaseTime time.Duration) time.Duration { return leaseTime / 2 }
+
+// dhcpT2 is the rebinding (T2) time advertised to the client: 87.5% of the
+// lease time, per RFC 2131.
+func dhcpT2(leaseTime time.Duration) time.Duration { return leaseTime * 7 / 8 }
+
+// DHCPPool allocates and tracks IP address leases for DHCPProxyAdapter,
+// handing out addresses from a contiguous range to whichever client requests
+// one.
+//
+// A DHCPPool is safe for concurrent use.
+type DHCPPool struct {
+	// RangeStart and RangeEnd delimit the inclusive range of IPv4 addresses
+	// the pool may hand out.
+	RangeStart net.IP
+	RangeEnd   net.IP
+
+	// Mask is the subnet mask advertised to clients.
+	Mask net.IPMask
+
+	// Gateway, if set, is advertised as the default router.
+	Gateway net.IP
+
+	// DNSServers, if set, is advertised as the list of name servers.
+	DNSServers []net.IP
+
+	// DomainName, if set, is advertised as the client's domain name.
+	DomainName string
+
+	// Broadcast, if set, is advertised as the subnet's broadcast address.
+	Broadcast net.IP
+
+	// MTU, if non-zero, is advertised as the interface MTU.
+	MTU uint16
+
+	// LeaseTime is the duration granted for a lease. It defaults to
+	// DefaultDHCPLeaseTime.
+	LeaseTime time.Duration
+
+	// DeclineCooldown is how long an address reported via DECLINE is
+	// withheld from allocation. It defaults to DefaultDHCPDeclineCooldown.
+	DeclineCooldown time.Duration
+
+	// StateFile, if set, is a path a DHCPPool persists its leases to as
+	// JSON and reloads them from when created via NewDHCPPool.
+	StateFile string
+
+	mu       sync.Mutex
+	leases   map[string]*DHCPLease // keyed by HardwareAddr.String()
+	declined map[string]time.Time  // keyed by IPv4.String()
+
+	closeOnce sync.Once
+	stop      chan struct{}
+}
+
+// dhcpPoolState is the JSON representation persisted to a DHCPPool's
+// StateFile.
+type dhcpPoolState struct {
+	Leases []*DHCPLease `json:"leases"`
+}
+
+// NewDHCPPool creates a DHCPPool, reloading its leases from pool.StateFile if
+// it is set and already exists, and starts the background goroutine that
+// expires stale leases.
+func NewDHCPPool(pool *DHCPPool) (*DHCPPool, error) {
+	if pool.LeaseTime <= 0 {
+		pool.LeaseTime = DefaultDHCPLeaseTime
+	}
+
+	if pool.DeclineCooldown <= 0 {
+		pool.DeclineCooldown = DefaultDHCPDeclineCooldown
+	}
+
+	pool.leases = make(map[string]*DHCPLease)
+	pool.declined = make(map[string]time.Time)
+	pool.stop = make(chan struct{})
+
+	if pool.StateFile != "" {
+		if err := pool.loadState(); err != nil {
+			return nil, fmt.Errorf("loading DHCP lease state: %s", err)
+		}
+	}
+
+	go pool.expireLoop()
+
+	return pool, nil
+}
+
+// Close stops the background lease-expiration goroutine.
+func (p *DHCPPool) Close() error {
+	p.closeOnce.Do(func() { close(p.stop) })
+
+	return nil
+}
+
+// Leases returns a snapshot of every non-expired lease currently held by the
+// pool.
+func (p *DHCPPool) Leases() []DHCPLease {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	leases := make([]DHCPLease, 0, len(p.leases))
+
+	for _, lease := range p.leases {
+		if !lease.expired(now) {
+			leases = append(leases, *lease)
+		}
+	}
+
+	return leases
+}
+
+// Lookup returns the current lease for hwAddr, if any.
+func (p *DHCPPool) Lookup(hwAddr net.HardwareAddr) (DHCPLease, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	lease, ok := p.leases[hwAddr.String()]
+
+	if !ok || lease.expired(time.Now()) {
+		return DHCPLease{}, false
+	}
+
+	return *lease, true
+}
+
+// Allocate returns the existing lease for hwAddr, renewing it, or assigns it
+// the next free address in the pool. It returns an error if the pool is
+// exhausted.
+func (p *DHCPPool) Allocate(hwAddr net.HardwareAddr, xid uint32, reserved DHCPEntries) (DHCPLease, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	key := hwAddr.String()
+
+	if lease, ok := p.leases[key]; ok && !lease.expired(now) {
+		lease.Xid = xid
+		lease.Expiry = now.Add(p.LeaseTime)
+
+		return *lease, nil
+	}
+
+	ip, err := p.nextFreeLocked(now, reserved)
+
+	if err != nil {
+		return DHCPLease{}, err
+	}
+
+	lease := &DHCPLease{
+		HardwareAddr: dupHardwareAddr(hwAddr),
+		IPv4:         ip,
+		Xid:          xid,
+		Expiry:       now.Add(p.LeaseTime),
+	}
+	p.leases[key] = lease
+	p.saveStateLocked()
+
+	return *lease, nil
+}
+
+// Confirm validates that ip is the address currently offered or leased to
+// hwAddr, extending its lease, and reports whether it was accepted.
+func (p *DHCPPool) Confirm(hwAddr net.HardwareAddr, ip net.IP, xid uint32) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	lease, ok := p.leases[hwAddr.String()]
+
+	if !ok || lease.expired(time.Now()) || !lease.IPv4.Equal(ip) {
+		return false
+	}
+
+	lease.Xid = xid
+	lease.Expiry = time.Now().Add(p.LeaseTime)
+	p.saveStateLocked()
+
+	return true
+}
+
+// Release forgets the lease held by hwAddr, if any, freeing its address for
+// reallocation.
+func (p *DHCPPool) Release(hwAddr net.HardwareAddr) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.leases, hwAddr.String())
+	p.saveStateLocked()
+}
+
+// Decline marks ip as unusable for DeclineCooldown and forgets the lease
+// held by hwAddr, if any. A lease for ip held by another hardware address
+// is kept.
+func (p *DHCPPool) Decline(hwAddr net.HardwareAddr, ip net.IP) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.leases, hwAddr.String())
+	p.declined[ip.String()] = time.Now().Add(p.DeclineCooldown)
+	p.saveStateLocked()
+}
+
+// nextFreeLocked returns the next address in the range that is neither
+// reserved, declined nor already leased. p.mu must be held.
+func (p *DHCPPool) nextFreeLocked(now time.Time, reserved DHCPEntries) (net.IP, error) {
+	start := ipv4ToUint32(p.RangeStart)
+	end := ipv4ToUint32(p.RangeEnd)
+
+	inUse := make(map[string]bool, len(p.leases))
+
+	for _, lease := range p.leases {
+		if !lease.expired(now) {
+			inUse[lease.IPv4.String()] = true
+		}
+	}
+
+	for n := start; n <= end; n++ {
+		ip := uint32ToIPv4(n)
+
+		if inUse[ip.String()] {
+			continue
+		}
+
+		if until, ok := p.declined[ip.String()]; ok {
+			if now.Before(until) {
+				continue
+			}
+
+			delete(p.declined, ip.String())
+		}
+
+		if _, ok := reserved.FindByIPv4(ip); ok {
+			continue
+		}
+
+		return ip, nil
+	}
+
+	return nil, fmt.Errorf("DHCP pool exhausted: no free address between %s and %s", p.RangeStart, p.RangeEnd)
+}
+
+// expireLoop periodically drops expired leases until the pool is closed.
+func (p *DHCPPool) expireLoop() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.expireOnce()
+		}
+	}
+}
+
+func (p *DHCPPool) expireOnce() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	changed := false
+
+	for key, lease := range p.leases {
+		if lease.expired(now) {
+			delete(p.leases, key)
+			changed = true
+		}
+	}
+
+	for ip, until := range p.declined {
+		if !now.Before(until) {
+			delete(p.declined, ip)
+			changed = true
+		}
+	}
+
+	if changed {
+		p.saveStateLocked()
+	}
+}
+
+// saveStateLocked persists the pool's leases to p.StateFile, if set. p.mu
+// must be held. Errors are ignored: lease persistence is best-effort.
+func (p *DHCPPool) saveStateLocked() {
+	if p.StateFile == "" {
+		return
+	}
+
+	state := dhcpPoolState{Leases: make([]*DHCPLease, 0, len(p.leases))}
+
+	for _, lease := range p.leases {
+		state.Leases = append(state.Leases, lease)
+	}
+
+	b, err := json.Marshal(state)
+
+	if err != nil {
+		return
+	}
+
+	_ = os.WriteFile(p.StateFile, b, 0600)
+}
+
+func (p *DHCPPool) loadState() error {
+	b, err := os.ReadFile(p.StateFile)
+
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var state dhcpPoolState
+
+	if err := json.Unmarshal(b, &state); err != nil {
+		return err
+	}
+
+	for _, lease := range state.Leases {
+		p.leases[lease.HardwareAddr.String()] = lease
+	}
+
+	return nil
+}
+
+func dupHardwareAddr(addr net.HardwareAddr) net.HardwareAddr {
+	dup := make(net.HardwareAddr, len(addr))
+	copy(dup, addr)
+
+	return dup
+}
+
+func ipv4ToUint32(ip net.IP) uint32 {
+	return binary.BigEndian.Uint32(ip.To4())
+}
+
+func uint32ToIPv4(n uint32) net.IP {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], n)
+
+	return net.IP(b[:])
+}
@@ -0,0 +1,184 @@
+package tuntap
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func mustParseHardwareAddr(t *testing.T, s string) net.HardwareAddr {
+	t.Helper()
+
+	addr, err := net.ParseMAC(s)
+
+	if err != nil {
+		t.Fatalf("failed to parse hardware address: %s", err)
+	}
+
+	return addr
+}
+
+func newTestDHCPPool(t *testing.T) *DHCPPool {
+	t.Helper()
+
+	pool, err := NewDHCPPool(&DHCPPool{
+		RangeStart: net.IPv4(192, 168, 1, 100),
+		RangeEnd:   net.IPv4(192, 168, 1, 101),
+		Mask:       net.CIDRMask(24, 32),
+		LeaseTime:  time.Minute,
+	})
+
+	if err != nil {
+		t.Fatalf("expected no error: %s", err)
+	}
+
+	t.Cleanup(func() { pool.Close() })
+
+	return pool
+}
+
+func TestDHCPPoolAllocate(t *testing.T) {
+	pool := newTestDHCPPool(t)
+
+	alice := mustParseHardwareAddr(t, "01:02:03:04:05:06")
+	bob := mustParseHardwareAddr(t, "01:02:03:04:05:07")
+
+	lease, err := pool.Allocate(alice, 1, nil)
+
+	if err != nil {
+		t.Fatalf("expected no error: %s", err)
+	}
+
+	if !lease.IPv4.Equal(net.IPv4(192, 168, 1, 100)) {
+		t.Errorf("expected %s, got %s", net.IPv4(192, 168, 1, 100), lease.IPv4)
+	}
+
+	// Allocating again for the same MAC returns the same address.
+	again, err := pool.Allocate(alice, 2, nil)
+
+	if err != nil {
+		t.Fatalf("expected no error: %s", err)
+	}
+
+	if !again.IPv4.Equal(lease.IPv4) {
+		t.Errorf("expected the same address %s, got %s", lease.IPv4, again.IPv4)
+	}
+
+	bobLease, err := pool.Allocate(bob, 3, nil)
+
+	if err != nil {
+		t.Fatalf("expected no error: %s", err)
+	}
+
+	if bobLease.IPv4.Equal(lease.IPv4) {
+		t.Errorf("expected a distinct address, got %s for both", lease.IPv4)
+	}
+
+	carol := mustParseHardwareAddr(t, "01:02:03:04:05:08")
+
+	if _, err := pool.Allocate(carol, 4, nil); err == nil {
+		t.Fatalf("expected the pool to be exhausted")
+	}
+}
+
+func TestDHCPPoolConfirmRefusesOtherClient(t *testing.T) {
+	pool := newTestDHCPPool(t)
+
+	alice := mustParseHardwareAddr(t, "01:02:03:04:05:06")
+	bob := mustParseHardwareAddr(t, "01:02:03:04:05:07")
+
+	lease, err := pool.Allocate(alice, 1, nil)
+
+	if err != nil {
+		t.Fatalf("expected no error: %s", err)
+	}
+
+	if !pool.Confirm(alice, lease.IPv4, 2) {
+		t.Errorf("expected alice's REQUEST for her own lease to be accepted")
+	}
+
+	if pool.Confirm(bob, lease.IPv4, 2) {
+		t.Errorf("expected bob's REQUEST for alice's lease to be refused")
+	}
+}
+
+func TestDHCPPoolReleaseAndReallocate(t *testing.T) {
+	pool := newTestDHCPPool(t)
+
+	alice := mustParseHardwareAddr(t, "01:02:03:04:05:06")
+	bob := mustParseHardwareAddr(t, "01:02:03:04:05:07")
+
+	lease, err := pool.Allocate(alice, 1, nil)
+
+	if err != nil {
+		t.Fatalf("expected no error: %s", err)
+	}
+
+	pool.Release(alice)
+
+	if _, ok := pool.Lookup(alice); ok {
+		t.Errorf("expected alice to have no lease after releasing it")
+	}
+
+	bobLease, err := pool.Allocate(bob, 2, nil)
+
+	if err != nil {
+		t.Fatalf("expected no error: %s", err)
+	}
+
+	if !bobLease.IPv4.Equal(lease.IPv4) {
+		t.Errorf("expected the released address %s to be reused, got %s", lease.IPv4, bobLease.IPv4)
+	}
+}
+
+func TestDHCPPoolDeclineWithholdsAddress(t *testing.T) {
+	pool := newTestDHCPPool(t)
+	pool.DeclineCooldown = time.Hour
+
+	alice := mustParseHardwareAddr(t, "01:02:03:04:05:06")
+	bob := mustParseHardwareAddr(t, "01:02:03:04:05:07")
+
+	lease, err := pool.Allocate(alice, 1, nil)
+
+	if err != nil {
+		t.Fatalf("expected no error: %s", err)
+	}
+
+	pool.Decline(alice, lease.IPv4)
+
+	bobLease, err := pool.Allocate(bob, 2, nil)
+
+	if err != nil {
+		t.Fatalf("expected no error: %s", err)
+	}
+
+	if bobLease.IPv4.Equal(lease.IPv4) {
+		t.Errorf("expected the declined address %s not to be reallocated", lease.IPv4)
+	}
+}
+
+func TestDHCPPoolSkipsReservedEntries(t *testing.T) {
+	pool := newTestDHCPPool(t)
+
+	alice := mustParseHardwareAddr(t, "01:02:03:04:05:06")
+
+	reserved := DHCPEntries{
+		{
+			HardwareAddr: mustParseHardwareAddr(t, "ff:ff:ff:ff:ff:ff"),
+			IPv4: &net.IPNet{
+				IP:   net.IPv4(192, 168, 1, 100),
+				Mask: net.CIDRMask(24, 32),
+			},
+		},
+	}
+
+	lease, err := pool.Allocate(alice, 1, reserved)
+
+	if err != nil {
+		t.Fatalf("expected no error: %s", err)
+	}
+
+	if lease.IPv4.Equal(net.IPv4(192, 168, 1, 100)) {
+		t.Errorf("expected the reserved address to be skipped, got %s", lease.IPv4)
+	}
+}
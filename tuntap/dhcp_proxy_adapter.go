@@ -18,6 +18,11 @@ type DHCPProxyAdapter struct {
 	RootLayer          gopacket.LayerType
 	ServerHardwareAddr net.HardwareAddr
 	Entries            DHCPEntries
+
+	// Pool, if set, hands out and tracks leases for any client whose
+	// hardware address is not found in Entries, instead of the message
+	// being ignored.
+	Pool *DHCPPool
 }
 
 // DHCPEntry represents a DHCP entry.
@@ -85,10 +90,11 @@ func (a *DHCPProxyAdapter) handlePacket(b []byte) bool {
 		return true
 	}
 
-	dhcpEntry, ok := a.Entries.Find(dhcp.ClientHWAddr)
+	dhcpEntry, isStatic := a.Entries.Find(dhcp.ClientHWAddr)
 
-	if !ok {
-		// The requester hardward address is not known: ignoring the message.
+	if !isStatic && a.Pool == nil {
+		// The requester hardward address is not known and there is no pool
+		// to allocate one from: ignoring the message.
 		return true
 	}
 
@@ -105,23 +111,66 @@ func (a *DHCPProxyAdapter) handlePacket(b []byte) bool {
 	}
 
 	messageType := layers.DHCPMsgType(optMessageType.Data[0])
+
+	// RELEASE and DECLINE never get a reply.
+	switch messageType {
+	case layers.DHCPMsgTypeRelease:
+		if !isStatic {
+			a.Pool.Release(dhcp.ClientHWAddr)
+		}
+
+		return false
+	case layers.DHCPMsgTypeDecline:
+		if !isStatic {
+			if optRequestIP := getDHCPOption(dhcp.Options, layers.DHCPOptRequestIP); optRequestIP != nil {
+				a.Pool.Decline(dhcp.ClientHWAddr, net.IP(optRequestIP.Data))
+			}
+		}
+
+		return false
+	}
+
 	var respOptions layers.DHCPOptions
+	var leaseMask net.IPMask
+	var leaseTime time.Duration
+
+	if isStatic {
+		leaseMask = dhcpEntry.IPv4.Mask
+		leaseTime = dhcpEntry.LeaseTime
+	} else {
+		leaseMask = a.Pool.Mask
+		leaseTime = a.Pool.LeaseTime
+	}
 
 	// We try to honor the requested lease-time.
 	optLeaseTime := getDHCPOption(dhcp.Options, layers.DHCPOptLeaseTime)
 
-	var leaseTimeBuf [4]byte
-
 	if optLeaseTime != nil && optLeaseTime.Length == 4 {
-		copy(leaseTimeBuf[:], optLeaseTime.Data)
-	} else {
-		binary.BigEndian.PutUint32(leaseTimeBuf[:], uint32(dhcpEntry.LeaseTime.Seconds()))
+		leaseTime = time.Duration(binary.BigEndian.Uint32(optLeaseTime.Data)) * time.Second
 	}
 
+	var leaseTimeBuf [4]byte
+	binary.BigEndian.PutUint32(leaseTimeBuf[:], uint32(leaseTime.Seconds()))
+
+	var t1Buf, t2Buf [4]byte
+	binary.BigEndian.PutUint32(t1Buf[:], uint32(dhcpT1(leaseTime).Seconds()))
+	binary.BigEndian.PutUint32(t2Buf[:], uint32(dhcpT2(leaseTime).Seconds()))
+
 	respIPv4Address := a.Config().IPv4.IP
 
 	switch messageType {
 	case layers.DHCPMsgTypeDiscover:
+		if !isStatic {
+			lease, err := a.Pool.Allocate(dhcp.ClientHWAddr, dhcp.Xid, a.Entries)
+
+			if err != nil {
+				// The pool is exhausted: we can't offer anything.
+				return false
+			}
+
+			respIPv4Address = lease.IPv4
+		}
+
 		respOptions = append(
 			respOptions,
 			layers.NewDHCPOption(
@@ -132,34 +181,50 @@ func (a *DHCPProxyAdapter) handlePacket(b []byte) bool {
 				layers.DHCPOptLeaseTime,
 				leaseTimeBuf[:],
 			),
+			layers.NewDHCPOption(layers.DHCPOptT1, t1Buf[:]),
+			layers.NewDHCPOption(layers.DHCPOptT2, t2Buf[:]),
 		)
 	case layers.DHCPMsgTypeRequest:
 		optRequestIP := getDHCPOption(dhcp.Options, layers.DHCPOptRequestIP)
 
-		if optRequestIP == nil {
+		var accepted bool
+		var requestedIP net.IP
+
+		if optRequestIP != nil {
+			requestedIP = net.IP(optRequestIP.Data)
+		}
+
+		if isStatic {
+			accepted = optRequestIP != nil && dhcpEntry.IPv4.IP.Equal(requestedIP)
+		} else if optRequestIP != nil {
+			// Refuse REQUEST for an address currently held by a different
+			// client.
+			accepted = a.Pool.Confirm(dhcp.ClientHWAddr, requestedIP, dhcp.Xid)
+		}
+
+		if accepted {
+			if !isStatic {
+				respIPv4Address = requestedIP
+			}
+
+			respOptions = append(
+				respOptions,
+				layers.NewDHCPOption(
+					layers.DHCPOptMessageType,
+					[]byte{byte(layers.DHCPMsgTypeAck)},
+				),
+				layers.NewDHCPOption(
+					layers.DHCPOptLeaseTime,
+					leaseTimeBuf[:],
+				),
+				layers.NewDHCPOption(layers.DHCPOptT1, t1Buf[:]),
+				layers.NewDHCPOption(layers.DHCPOptT2, t2Buf[:]),
+			)
+		} else {
 			respOptions = append(respOptions, layers.NewDHCPOption(
 				layers.DHCPOptMessageType,
 				[]byte{byte(layers.DHCPMsgTypeNak)},
 			))
-		} else {
-			if dhcpEntry.IPv4.IP.Equal(net.IP(optRequestIP.Data)) {
-				respOptions = append(
-					respOptions,
-					layers.NewDHCPOption(
-						layers.DHCPOptMessageType,
-						[]byte{byte(layers.DHCPMsgTypeAck)},
-					),
-					layers.NewDHCPOption(
-						layers.DHCPOptLeaseTime,
-						leaseTimeBuf[:],
-					),
-				)
-			} else {
-				respOptions = append(respOptions, layers.NewDHCPOption(
-					layers.DHCPOptMessageType,
-					[]byte{byte(layers.DHCPMsgTypeNak)},
-				))
-			}
 		}
 	case layers.DHCPMsgTypeInform:
 		// When we inform, we must not give an address back.
@@ -191,8 +256,39 @@ func (a *DHCPProxyAdapter) handlePacket(b []byte) bool {
 			case layers.DHCPOptSubnetMask:
 				respOptions = append(respOptions, layers.NewDHCPOption(
 					param,
-					dhcpEntry.IPv4.Mask,
+					leaseMask,
 				))
+			case layers.DHCPOptRouter:
+				if a.Pool != nil && a.Pool.Gateway != nil {
+					respOptions = append(respOptions, layers.NewDHCPOption(
+						param,
+						a.Pool.Gateway.To4(),
+					))
+				}
+			case layers.DHCPOptDNS:
+				if a.Pool != nil && len(a.Pool.DNSServers) > 0 {
+					var dnsBuf []byte
+
+					for _, dns := range a.Pool.DNSServers {
+						dnsBuf = append(dnsBuf, dns.To4()...)
+					}
+
+					respOptions = append(respOptions, layers.NewDHCPOption(param, dnsBuf))
+				}
+			case layers.DHCPOptDomainName:
+				if a.Pool != nil && a.Pool.DomainName != "" {
+					respOptions = append(respOptions, layers.NewDHCPOption(param, []byte(a.Pool.DomainName)))
+				}
+			case layers.DHCPOptBroadcastAddr:
+				if a.Pool != nil && a.Pool.Broadcast != nil {
+					respOptions = append(respOptions, layers.NewDHCPOption(param, a.Pool.Broadcast.To4()))
+				}
+			case layers.DHCPOptInterfaceMTU:
+				if a.Pool != nil && a.Pool.MTU != 0 {
+					var mtuBuf [2]byte
+					binary.BigEndian.PutUint16(mtuBuf[:], a.Pool.MTU)
+					respOptions = append(respOptions, layers.NewDHCPOption(param, mtuBuf[:]))
+				}
 			}
 		}
 	}
@@ -275,6 +371,17 @@ func (e DHCPEntries) Find(addr net.HardwareAddr) (DHCPEntry, bool) {
 	return DHCPEntry{}, false
 }
 
+// FindByIPv4 finds a DHCP entry reserving the given IPv4 address.
+func (e DHCPEntries) FindByIPv4(ip net.IP) (DHCPEntry, bool) {
+	for _, entry := range e {
+		if entry.IPv4.IP.Equal(ip) {
+			return entry, true
+		}
+	}
+
+	return DHCPEntry{}, false
+}
+
 func getDHCPOption(options layers.DHCPOptions, opt layers.DHCPOpt) *layers.DHCPOption {
 	for _, option := range options {
 		if option.Type == opt {
@@ -1,27 +1,138 @@
 package tuntap
 
 import (
+	"fmt"
 	"io"
 	"runtime"
+	"sync"
 
 	"golang.org/x/sys/windows"
 )
 
+// overlappedReadBufferSize is the size of the buffer each pending ReadFile
+// is issued against. It comfortably fits a full, non-jumbo Ethernet frame.
+const overlappedReadBufferSize = 1 << 16
+
+// overlappedFile wraps a Windows handle opened with FILE_FLAG_OVERLAPPED
+// (the TAP-Windows6 device, notably) behind an io.ReadWriteCloser.
+//
+// A single background goroutine keeps one ReadFile in flight at all times
+// and publishes each completed packet on readCh; Read drains that channel.
+// Writes are simpler: each Write issues its own overlapped WriteFile and
+// blocks on GetOverlappedResult until the driver completes the I/O. That
+// wait is a blocking system call, so it holds the calling goroutine's OS
+// thread for its duration.
 type overlappedFile struct {
 	fd   windows.Handle
 	name string
+
+	readCh    chan overlappedReadResult
+	closeOnce sync.Once
+	closeErr  error
+}
+
+type overlappedReadResult struct {
+	data []byte
+	err  error
+}
+
+func newOverlappedFile(fd windows.Handle, name string) *overlappedFile {
+	f := &overlappedFile{
+		fd:     fd,
+		name:   name,
+		readCh: make(chan overlappedReadResult, 1),
+	}
+
+	go f.readLoop()
+
+	return f
+}
+
+// readLoop keeps a single overlapped ReadFile in flight, handing each
+// completed packet (or the terminal error, once the handle is closed) to
+// Read over readCh.
+func (f *overlappedFile) readLoop() {
+	for {
+		buf := make([]byte, overlappedReadBufferSize)
+		n, err := f.readOnce(buf)
+
+		if err != nil {
+			f.readCh <- overlappedReadResult{err: err}
+			return
+		}
+
+		f.readCh <- overlappedReadResult{data: buf[:n]}
+	}
+}
+
+func (f *overlappedFile) readOnce(buf []byte) (int, error) {
+	event, err := windows.CreateEvent(nil, 1, 0, nil)
+
+	if err != nil {
+		return 0, fmt.Errorf("creating the read completion event: %s", err)
+	}
+
+	defer windows.CloseHandle(event)
+
+	overlapped := windows.Overlapped{HEvent: event}
+
+	if err := windows.ReadFile(f.fd, buf, nil, &overlapped); err != nil && err != windows.ERROR_IO_PENDING {
+		return 0, err
+	}
+
+	var n uint32
+
+	if err := windows.GetOverlappedResult(f.fd, &overlapped, &n, true); err != nil {
+		return 0, err
+	}
+
+	return int(n), nil
 }
 
-func (f *overlappedFile) Read(b []byte) (int, error) {
-	return 0, io.EOF
+func (f *overlappedFile) Read(p []byte) (int, error) {
+	result := <-f.readCh
+
+	if result.err != nil {
+		return 0, result.err
+	}
+
+	return copy(p, result.data), nil
 }
 
-func (f *overlappedFile) Write(b []byte) (int, error) {
-	return 0, io.EOF
+func (f *overlappedFile) Write(p []byte) (int, error) {
+	event, err := windows.CreateEvent(nil, 1, 0, nil)
+
+	if err != nil {
+		return 0, fmt.Errorf("creating the write completion event: %s", err)
+	}
+
+	defer windows.CloseHandle(event)
+
+	overlapped := windows.Overlapped{HEvent: event}
+
+	if err := windows.WriteFile(f.fd, p, nil, &overlapped); err != nil && err != windows.ERROR_IO_PENDING {
+		return 0, err
+	}
+
+	var n uint32
+
+	if err := windows.GetOverlappedResult(f.fd, &overlapped, &n, true); err != nil {
+		return 0, err
+	}
+
+	return int(n), nil
 }
 
 func (f *overlappedFile) Close() error {
-	runtime.SetFinalizer(f, nil)
+	f.closeOnce.Do(func() {
+		runtime.SetFinalizer(f, nil)
 
-	return windows.Close(f.fd)
+		// Closing the handle aborts the in-flight ReadFile, which makes
+		// readLoop post an error and return instead of leaking.
+		f.closeErr = windows.CloseHandle(f.fd)
+	})
+
+	return f.closeErr
 }
+
+var _ io.ReadWriteCloser = (*overlappedFile)(nil)
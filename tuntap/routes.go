@@ -0,0 +1,73 @@
+package tuntap
+
+import "net"
+
+// Route describes a single entry of the operating system's routing table
+// that points traffic into an adapter's interface.
+type Route struct {
+	// Dst is the destination network the route matches.
+	Dst *net.IPNet
+
+	// Gateway is the next hop the route forwards through. It is nil for
+	// routes that forward directly out the adapter's interface, without a
+	// next hop.
+	Gateway net.IP
+
+	// Metric is the route's priority; lower values are preferred. A zero
+	// value lets the operating system pick its own default. On Darwin it
+	// is ignored: AddRoute does not send it and ListRoutes reports zero.
+	Metric uint32
+}
+
+// A RouteTable lets a caller install, remove, and enumerate the routes
+// that point traffic into an adapter's interface, without shelling out or
+// writing per-OS code.
+//
+// Every Adapter implements RouteTable.
+type RouteTable interface {
+	// AddRoute adds route to the operating system's routing table,
+	// treating an already-present route as success.
+	AddRoute(route Route) error
+
+	// DelRoute removes route from the operating system's routing table,
+	// treating an already-absent route as success.
+	DelRoute(route Route) error
+
+	// ListRoutes returns the routes currently installed through the
+	// adapter's interface.
+	ListRoutes() ([]Route, error)
+}
+
+// DefaultRouteOverride returns the pair of half-default routes
+// (0.0.0.0/1 and 128.0.0.0/1, or their IPv6 equivalents ::/1 and
+// 8000::/1 when gateway is an IPv6 address) that together cover the same
+// traffic as the default route, through gateway.
+//
+// Installing both halves lets a full-tunnel VPN setup steer all traffic
+// into the adapter without touching, and therefore without having to
+// later restore, the true default route.
+func DefaultRouteOverride(gateway net.IP) []Route {
+	if v4 := gateway.To4(); v4 != nil {
+		return []Route{
+			{Dst: &net.IPNet{IP: net.IPv4zero, Mask: net.CIDRMask(1, 32)}, Gateway: gateway},
+			{Dst: &net.IPNet{IP: net.IPv4(128, 0, 0, 0), Mask: net.CIDRMask(1, 32)}, Gateway: gateway},
+		}
+	}
+
+	return []Route{
+		{Dst: &net.IPNet{IP: net.IPv6zero, Mask: net.CIDRMask(1, 128)}, Gateway: gateway},
+		{Dst: &net.IPNet{IP: net.ParseIP("8000::"), Mask: net.CIDRMask(1, 128)}, Gateway: gateway},
+	}
+}
+
+// InstallDefaultRouteOverride adds the routes DefaultRouteOverride returns
+// for gateway to rt.
+func InstallDefaultRouteOverride(rt RouteTable, gateway net.IP) error {
+	for _, route := range DefaultRouteOverride(gateway) {
+		if err := rt.AddRoute(route); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
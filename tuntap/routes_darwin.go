@@ -0,0 +1,404 @@
+// +build darwin
+
+package tuntap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// routeSeq is incremented for every PF_ROUTE message this process sends,
+// so the kernel's echoed reply (delivered back to every open routing
+// socket) can be matched to the request that caused it.
+var routeSeq int32
+
+// AddRoute installs route into the kernel's routing table via a PF_ROUTE
+// socket, scoped to a's interface, treating an already-present route as
+// success.
+func (a *adapterImpl) AddRoute(route Route) error {
+	if err := sendRouteMessage(unix.RTM_ADD, a.Interface().Index, route); err != nil {
+		if err == unix.EEXIST {
+			return nil
+		}
+
+		return fmt.Errorf("adding route %s via %s: %s", route.Dst, route.Gateway, err)
+	}
+
+	return nil
+}
+
+// DelRoute removes route from the kernel's routing table via a PF_ROUTE
+// socket, treating an already-absent route as success.
+func (a *adapterImpl) DelRoute(route Route) error {
+	if err := sendRouteMessage(unix.RTM_DELETE, a.Interface().Index, route); err != nil {
+		if err == unix.ESRCH {
+			return nil
+		}
+
+		return fmt.Errorf("deleting route %s via %s: %s", route.Dst, route.Gateway, err)
+	}
+
+	return nil
+}
+
+// ListRoutes returns the routes whose outgoing interface is a's, read out
+// of the kernel's routing table via a NET_RT_DUMP sysctl over the same
+// PF_ROUTE address family AddRoute and DelRoute use.
+func (a *adapterImpl) ListRoutes() ([]Route, error) {
+	b, err := sysctlRouteDump()
+
+	if err != nil {
+		return nil, fmt.Errorf("listing routes: %s", err)
+	}
+
+	return parseRouteDump(b, a.Interface().Index), nil
+}
+
+// sendRouteMessage sends a single RTM_ADD/RTM_DELETE message for route
+// over a PF_ROUTE socket, bound to the interface index, and waits for the
+// kernel's echoed reply.
+func sendRouteMessage(msgType int, index int, route Route) error {
+	fd, err := unix.Socket(unix.AF_ROUTE, unix.SOCK_RAW, unix.AF_UNSPEC)
+
+	if err != nil {
+		return fmt.Errorf("opening the routing socket: %s", err)
+	}
+
+	defer unix.Close(fd)
+
+	routeSeq++
+	seq := routeSeq
+	pid := int32(unix.Getpid())
+
+	msg, err := buildRouteMessage(msgType, seq, pid, index, route)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := unix.Write(fd, msg); err != nil {
+		return fmt.Errorf("writing the routing message: %s", err)
+	}
+
+	buf := make([]byte, unix.SizeofRtMsghdr+512)
+
+	for {
+		n, err := unix.Read(fd, buf)
+
+		if err != nil {
+			return fmt.Errorf("reading the routing message reply: %s", err)
+		}
+
+		if n < unix.SizeofRtMsghdr {
+			continue
+		}
+
+		hdr := (*unix.RtMsghdr)(unsafe.Pointer(&buf[0]))
+
+		if hdr.Pid != pid || hdr.Seq != seq {
+			continue
+		}
+
+		if hdr.Errno != 0 {
+			return unix.Errno(hdr.Errno)
+		}
+
+		return nil
+	}
+}
+
+// buildRouteMessage encodes a rt_msghdr followed by its RTAX_DST[,
+// RTAX_GATEWAY,] RTAX_NETMASK sockaddrs, the address triple a PF_ROUTE
+// socket expects for RTM_ADD/RTM_DELETE.
+func buildRouteMessage(msgType int, seq int32, pid int32, index int, route Route) ([]byte, error) {
+	v4 := route.Dst.IP.To4() != nil
+
+	dstSA, err := routeSockaddr(route.Dst.IP, v4)
+
+	if err != nil {
+		return nil, err
+	}
+
+	maskSA := routeNetmaskSockaddr(route.Dst.Mask, v4)
+
+	addrs := int32(unix.RTA_DST | unix.RTA_NETMASK)
+	flags := int32(unix.RTF_STATIC | unix.RTF_UP)
+
+	body := append([]byte{}, dstSA...)
+
+	if route.Gateway != nil {
+		gwSA, err := routeSockaddr(route.Gateway, v4)
+
+		if err != nil {
+			return nil, err
+		}
+
+		body = append(body, gwSA...)
+		addrs |= unix.RTA_GATEWAY
+		flags |= unix.RTF_GATEWAY
+	} else {
+		flags |= unix.RTF_IFSCOPE
+	}
+
+	body = append(body, maskSA...)
+
+	hdr := unix.RtMsghdr{
+		Version: unix.RTM_VERSION,
+		Type:    uint8(msgType),
+		Index:   uint16(index),
+		Flags:   flags,
+		Addrs:   addrs,
+		Pid:     pid,
+		Seq:     seq,
+	}
+
+	hdrBytes := (*[unix.SizeofRtMsghdr]byte)(unsafe.Pointer(&hdr))[:]
+	msg := append(append([]byte{}, hdrBytes...), body...)
+
+	binary.LittleEndian.PutUint16(msg[0:2], uint16(len(msg)))
+
+	return msg, nil
+}
+
+// routeSockaddrAlign is the alignment PF_ROUTE requires between
+// consecutive sockaddrs within a routing message, mirroring the BSD
+// kernel's ROUNDUP macro.
+const routeSockaddrAlign = 4
+
+// routeSockaddr encodes ip as a raw sockaddr_in or sockaddr_in6, as used
+// by RTAX_DST/RTAX_GATEWAY.
+func routeSockaddr(ip net.IP, v4 bool) ([]byte, error) {
+	if v4 {
+		addr := ip.To4()
+
+		if addr == nil {
+			return nil, fmt.Errorf("expected an IPv4 address, got %s", ip)
+		}
+
+		sa := make([]byte, roundupRouteSockaddr(16))
+		sa[0] = 16
+		sa[1] = unix.AF_INET
+		copy(sa[4:8], addr)
+
+		return sa, nil
+	}
+
+	addr := ip.To16()
+
+	if addr == nil {
+		return nil, fmt.Errorf("expected an IPv6 address, got %s", ip)
+	}
+
+	sa := make([]byte, roundupRouteSockaddr(28))
+	sa[0] = 28
+	sa[1] = unix.AF_INET6
+	copy(sa[8:24], addr)
+
+	return sa, nil
+}
+
+// routeNetmaskSockaddr encodes mask as a sockaddr, as used by
+// RTAX_NETMASK. The kernel accepts a netmask sockaddr truncated to its
+// significant bytes, but a fixed, fully-sized one is simpler to both
+// build and parse back.
+func routeNetmaskSockaddr(mask net.IPMask, v4 bool) []byte {
+	if v4 {
+		sa := make([]byte, roundupRouteSockaddr(16))
+		sa[0] = 16
+		sa[1] = unix.AF_INET
+		copy(sa[4:8], mask)
+
+		return sa
+	}
+
+	sa := make([]byte, roundupRouteSockaddr(28))
+	sa[0] = 28
+	sa[1] = unix.AF_INET6
+	copy(sa[8:24], mask)
+
+	return sa
+}
+
+func roundupRouteSockaddr(n int) int {
+	if n <= 0 {
+		return routeSockaddrAlign
+	}
+
+	return (n + routeSockaddrAlign - 1) &^ (routeSockaddrAlign - 1)
+}
+
+// sysctlRouteDump reads the whole kernel routing table via a
+// {CTL_NET, AF_ROUTE, 0, AF_UNSPEC, NET_RT_DUMP, 0} sysctl.
+//
+// NET_RT_DUMP has no name unix.Sysctl can resolve, so this calls
+// __sysctl(2) directly with the numeric MIB, following the same two-call
+// (size, then read) convention unix.SysctlRaw uses for named sysctls.
+func sysctlRouteDump() ([]byte, error) {
+	mib := [6]int32{unix.CTL_NET, unix.AF_ROUTE, 0, unix.AF_UNSPEC, unix.NET_RT_DUMP, 0}
+
+	var n uintptr
+
+	if err := rawSysctl(&mib[0], len(mib), nil, &n); err != nil {
+		return nil, fmt.Errorf("sizing the route dump: %s", err)
+	}
+
+	if n == 0 {
+		return nil, nil
+	}
+
+	buf := make([]byte, n)
+
+	if err := rawSysctl(&mib[0], len(mib), &buf[0], &n); err != nil {
+		return nil, fmt.Errorf("reading the route dump: %s", err)
+	}
+
+	return buf[:n], nil
+}
+
+func rawSysctl(mib *int32, mibLen int, out *byte, outLen *uintptr) error {
+	_, _, errno := unix.Syscall6(
+		unix.SYS___SYSCTL,
+		uintptr(unsafe.Pointer(mib)),
+		uintptr(mibLen),
+		uintptr(unsafe.Pointer(out)),
+		uintptr(unsafe.Pointer(outLen)),
+		0,
+		0,
+	)
+
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
+
+// parseRouteDump walks a NET_RT_DUMP buffer and returns the routes whose
+// outgoing interface matches index.
+func parseRouteDump(b []byte, index int) []Route {
+	var routes []Route
+
+	for len(b) >= unix.SizeofRtMsghdr {
+		hdr := (*unix.RtMsghdr)(unsafe.Pointer(&b[0]))
+		msgLen := int(hdr.Msglen)
+
+		if msgLen <= 0 || msgLen > len(b) {
+			break
+		}
+
+		if int(hdr.Index) == index {
+			if route, ok := parseRouteAddrs(hdr.Addrs, b[unix.SizeofRtMsghdr:msgLen]); ok {
+				routes = append(routes, route)
+			}
+		}
+
+		b = b[msgLen:]
+	}
+
+	return routes
+}
+
+// Bit positions of the RTAX_* addresses within a rt_msghdr's Addrs mask,
+// in the order the kernel lays out the corresponding sockaddrs.
+const (
+	rtaxDst = iota
+	rtaxGateway
+	rtaxNetmask
+)
+
+// parseRouteAddrs decodes the sockaddrs following a rt_msghdr into a
+// Route. ok is false when no RTAX_DST address is present.
+func parseRouteAddrs(addrs int32, b []byte) (Route, bool) {
+	var dst, gateway net.IP
+	var bits int
+	var maskBytes []byte
+	haveDst := false
+
+	for i := 0; i < 8 && len(b) > 0; i++ {
+		if addrs&(1<<uint(i)) == 0 {
+			continue
+		}
+
+		saLen := int(b[0])
+
+		if saLen == 0 {
+			saLen = routeSockaddrAlign
+		}
+
+		if saLen > len(b) {
+			break
+		}
+
+		switch i {
+		case rtaxDst:
+			if ip, ipBits, ok := parseRouteSockaddr(b[:saLen]); ok {
+				dst = ip
+				bits = ipBits
+				haveDst = true
+			}
+		case rtaxGateway:
+			if ip, _, ok := parseRouteSockaddr(b[:saLen]); ok {
+				gateway = ip
+			}
+		case rtaxNetmask:
+			// RTAX_NETMASK sockaddrs are commonly truncated to their
+			// significant bytes; pad with zeroes out to the address
+			// family's full width before treating it as a mask.
+			// The mask sits where the address would: offset 4 in a
+			// sockaddr_in, offset 8 in a sockaddr_in6.
+			off := 4
+
+			if bits == 128 {
+				off = 8
+			}
+
+			if saLen > off {
+				maskBytes = append([]byte{}, b[off:saLen]...)
+			}
+		}
+
+		b = b[roundupRouteSockaddr(saLen):]
+	}
+
+	if !haveDst {
+		return Route{}, false
+	}
+
+	mask := make(net.IPMask, bits/8)
+	copy(mask, maskBytes)
+	ones, _ := mask.Size()
+
+	return Route{
+		Dst:     &net.IPNet{IP: dst, Mask: net.CIDRMask(ones, bits)},
+		Gateway: gateway,
+	}, true
+}
+
+// parseRouteSockaddr decodes a sockaddr_in/sockaddr_in6 into its address
+// and bit length.
+func parseRouteSockaddr(sa []byte) (net.IP, int, bool) {
+	if len(sa) < 2 {
+		return nil, 0, false
+	}
+
+	switch sa[1] {
+	case unix.AF_INET:
+		if len(sa) < 8 {
+			return nil, 0, false
+		}
+
+		return net.IP(sa[4:8]), 32, true
+	case unix.AF_INET6:
+		if len(sa) < 24 {
+			return nil, 0, false
+		}
+
+		return net.IP(sa[8:24]), 128, true
+	default:
+		return nil, 0, false
+	}
+}
@@ -0,0 +1,364 @@
+// +build linux
+
+package tuntap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// AddRoute installs route into RT_TABLE_MAIN via AF_NETLINK, scoped to a's
+// interface through RTA_OIF, treating an already-present route as success.
+func (a *adapterImpl) AddRoute(route Route) error {
+	index := a.Interface().Index
+
+	if err := sendTunRouteRequest(unix.RTM_NEWROUTE, unix.NLM_F_CREATE|unix.NLM_F_EXCL, index, route); err != nil {
+		if err == unix.EEXIST {
+			return nil
+		}
+
+		return fmt.Errorf("adding route %s via %s: %s", route.Dst, route.Gateway, err)
+	}
+
+	return nil
+}
+
+// DelRoute removes route from RT_TABLE_MAIN via AF_NETLINK, treating an
+// already-absent route as success.
+func (a *adapterImpl) DelRoute(route Route) error {
+	index := a.Interface().Index
+
+	if err := sendTunRouteRequest(unix.RTM_DELROUTE, 0, index, route); err != nil {
+		if err == unix.ESRCH || err == unix.ENOENT {
+			return nil
+		}
+
+		return fmt.Errorf("deleting route %s via %s: %s", route.Dst, route.Gateway, err)
+	}
+
+	return nil
+}
+
+// ListRoutes returns the routes in RT_TABLE_MAIN whose RTA_OIF points at
+// a's interface.
+func (a *adapterImpl) ListRoutes() ([]Route, error) {
+	index := a.Interface().Index
+
+	sock, err := newTunRouteSocket()
+
+	if err != nil {
+		return nil, fmt.Errorf("listing routes: %s", err)
+	}
+
+	defer sock.Close()
+
+	var routes []Route
+
+	for _, family := range []uint8{unix.AF_INET, unix.AF_INET6} {
+		sock.seq++
+
+		if err := sock.send(newTunRouteDumpRequest(sock.seq, family)); err != nil {
+			return nil, fmt.Errorf("listing routes: %s", err)
+		}
+
+		replies, err := sock.receiveUntilDone()
+
+		if err != nil {
+			return nil, fmt.Errorf("listing routes: %s", err)
+		}
+
+		for _, reply := range replies {
+			if route, ok := parseTunRouteMessage(reply, index); ok {
+				routes = append(routes, route)
+			}
+		}
+	}
+
+	return routes, nil
+}
+
+// tunRouteSocket wraps a NETLINK_ROUTE socket and the sequence-number
+// bookkeeping needed to pair requests with their acknowledgements.
+//
+// It mirrors routing.routeSocket, but every request it sends additionally
+// carries RTA_OIF (and, when set, RTA_PRIORITY), so routes are bound to a
+// specific adapter's interface instead of the system-wide table at large.
+type tunRouteSocket struct {
+	fd  int
+	seq uint32
+}
+
+func newTunRouteSocket() (*tunRouteSocket, error) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW, unix.NETLINK_ROUTE)
+
+	if err != nil {
+		return nil, fmt.Errorf("opening the netlink route socket: %s", err)
+	}
+
+	if err := unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		unix.Close(fd)
+
+		return nil, fmt.Errorf("binding the netlink route socket: %s", err)
+	}
+
+	return &tunRouteSocket{fd: fd}, nil
+}
+
+func (s *tunRouteSocket) Close() error {
+	return unix.Close(s.fd)
+}
+
+func (s *tunRouteSocket) send(msg []byte) error {
+	return unix.Sendto(s.fd, msg, 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK})
+}
+
+func (s *tunRouteSocket) receive() ([]unix.NetlinkMessage, error) {
+	buf := make([]byte, unix.Getpagesize())
+
+	n, _, err := unix.Recvfrom(s.fd, buf, 0)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return unix.ParseNetlinkMessage(buf[:n])
+}
+
+// receiveUntilDone collects RTM_NEWROUTE messages until the NLMSG_DONE (or
+// an NLMSG_ERROR) trailer of a NLM_F_DUMP request is received.
+func (s *tunRouteSocket) receiveUntilDone() ([]unix.NetlinkMessage, error) {
+	var result []unix.NetlinkMessage
+
+	for {
+		msgs, err := s.receive()
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, msg := range msgs {
+			switch msg.Header.Type {
+			case unix.NLMSG_DONE:
+				return result, nil
+			case unix.NLMSG_ERROR:
+				if err := parseTunNlMsgerr(msg.Data); err != nil {
+					return nil, err
+				}
+
+				return result, nil
+			default:
+				result = append(result, msg)
+			}
+		}
+	}
+}
+
+// sendTunRouteRequest sends a single RTM_NEWROUTE/RTM_DELROUTE request for
+// route, scoped to index via RTA_OIF, and waits for its acknowledgement.
+func sendTunRouteRequest(msgType uint16, flags uint16, index int, route Route) error {
+	sock, err := newTunRouteSocket()
+
+	if err != nil {
+		return err
+	}
+
+	defer sock.Close()
+
+	sock.seq++
+	seq := sock.seq
+
+	if err := sock.send(newTunRouteRequest(seq, msgType, flags, index, route)); err != nil {
+		return err
+	}
+
+	for {
+		msgs, err := sock.receive()
+
+		if err != nil {
+			return err
+		}
+
+		for _, msg := range msgs {
+			if msg.Header.Seq != seq || msg.Header.Type != unix.NLMSG_ERROR {
+				continue
+			}
+
+			return parseTunNlMsgerr(msg.Data)
+		}
+	}
+}
+
+func parseTunNlMsgerr(data []byte) error {
+	if len(data) < 4 {
+		return fmt.Errorf("truncated netlink error message")
+	}
+
+	errno := int32(binary.LittleEndian.Uint32(data))
+
+	if errno == 0 {
+		return nil
+	}
+
+	return unix.Errno(-errno)
+}
+
+// newTunRouteDumpRequest builds a bare RTM_GETROUTE request with no route
+// attributes attached, suitable for a NLM_F_DUMP of family's routing
+// table.
+func newTunRouteDumpRequest(seq uint32, family uint8) []byte {
+	rtmsg := unix.RtMsg{
+		Family: family,
+		Table:  unix.RT_TABLE_MAIN,
+	}
+
+	return packTunNetlinkMessage(unix.RTM_GETROUTE, unix.NLM_F_REQUEST|unix.NLM_F_DUMP, seq, tunRtMsgBytes(rtmsg), nil)
+}
+
+// newTunRouteRequest builds a RTM_NEWROUTE/RTM_DELROUTE request for route,
+// with the NLM_F_REQUEST|NLM_F_ACK flags common to both, an RTA_OIF
+// attribute binding it to index, and an RTA_PRIORITY attribute when
+// route.Metric is set.
+func newTunRouteRequest(seq uint32, msgType uint16, flags uint16, index int, route Route) []byte {
+	family := uint8(unix.AF_INET)
+	dst := route.Dst.IP.To4()
+	gw := route.Gateway.To4()
+
+	if dst == nil {
+		family = unix.AF_INET6
+		dst = route.Dst.IP.To16()
+		gw = route.Gateway.To16()
+	}
+
+	ones, _ := route.Dst.Mask.Size()
+
+	rtmsg := unix.RtMsg{
+		Family:   family,
+		Dst_len:  uint8(ones),
+		Table:    unix.RT_TABLE_MAIN,
+		Protocol: unix.RTPROT_BOOT,
+		Scope:    unix.RT_SCOPE_UNIVERSE,
+		Type:     unix.RTN_UNICAST,
+	}
+
+	var attrs []byte
+	attrs = append(attrs, packTunRtAttr(unix.RTA_DST, dst)...)
+
+	if gw != nil {
+		attrs = append(attrs, packTunRtAttr(unix.RTA_GATEWAY, gw)...)
+	}
+
+	oif := make([]byte, 4)
+	binary.LittleEndian.PutUint32(oif, uint32(index))
+	attrs = append(attrs, packTunRtAttr(unix.RTA_OIF, oif)...)
+
+	if route.Metric != 0 {
+		priority := make([]byte, 4)
+		binary.LittleEndian.PutUint32(priority, route.Metric)
+		attrs = append(attrs, packTunRtAttr(unix.RTA_PRIORITY, priority)...)
+	}
+
+	return packTunNetlinkMessage(msgType, flags|unix.NLM_F_REQUEST|unix.NLM_F_ACK, seq, tunRtMsgBytes(rtmsg), attrs)
+}
+
+func tunRtMsgBytes(rtmsg unix.RtMsg) []byte {
+	return []byte{rtmsg.Family, rtmsg.Dst_len, rtmsg.Src_len, rtmsg.Tos, rtmsg.Table, rtmsg.Protocol, rtmsg.Scope, rtmsg.Type, 0, 0, 0, 0}
+}
+
+// packTunRtAttr encodes a single, 4-byte-aligned route attribute.
+func packTunRtAttr(attrType uint16, data []byte) []byte {
+	l := unix.SizeofRtAttr + len(data)
+	buf := make([]byte, tunAlign4(l))
+
+	binary.LittleEndian.PutUint16(buf[0:2], uint16(l))
+	binary.LittleEndian.PutUint16(buf[2:4], attrType)
+	copy(buf[unix.SizeofRtAttr:], data)
+
+	return buf
+}
+
+func packTunNetlinkMessage(msgType uint16, flags uint16, seq uint32, payload, attrs []byte) []byte {
+	body := append(append([]byte{}, payload...), attrs...)
+	length := unix.SizeofNlMsghdr + len(body)
+
+	buf := make([]byte, tunAlign4(length))
+
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(length))
+	binary.LittleEndian.PutUint16(buf[4:6], msgType)
+	binary.LittleEndian.PutUint16(buf[6:8], flags)
+	binary.LittleEndian.PutUint32(buf[8:12], seq)
+	binary.LittleEndian.PutUint32(buf[12:16], uint32(unix.Getpid()))
+	copy(buf[unix.SizeofNlMsghdr:], body)
+
+	return buf
+}
+
+// parseTunRouteMessage decodes a RTM_NEWROUTE message's RtMsg and
+// RTA_DST/RTA_GATEWAY/RTA_OIF/RTA_PRIORITY attributes into a Route. ok is
+// false for routes outside RT_TABLE_MAIN, of a type other than
+// RTN_UNICAST, or not bound to index via RTA_OIF.
+func parseTunRouteMessage(msg unix.NetlinkMessage, index int) (Route, bool) {
+	if len(msg.Data) < unix.SizeofRtMsg {
+		return Route{}, false
+	}
+
+	rtmsg := unix.RtMsg{
+		Family:   msg.Data[0],
+		Dst_len:  msg.Data[1],
+		Src_len:  msg.Data[2],
+		Tos:      msg.Data[3],
+		Table:    msg.Data[4],
+		Protocol: msg.Data[5],
+		Scope:    msg.Data[6],
+		Type:     msg.Data[7],
+	}
+
+	if rtmsg.Table != unix.RT_TABLE_MAIN || rtmsg.Type != unix.RTN_UNICAST {
+		return Route{}, false
+	}
+
+	attrs, err := unix.ParseNetlinkRouteAttr(&msg)
+
+	if err != nil {
+		return Route{}, false
+	}
+
+	var dst, gw net.IP
+	var metric uint32
+	oif := -1
+
+	for _, attr := range attrs {
+		switch attr.Attr.Type {
+		case unix.RTA_DST:
+			dst = net.IP(attr.Value)
+		case unix.RTA_GATEWAY:
+			gw = net.IP(attr.Value)
+		case unix.RTA_OIF:
+			oif = int(binary.LittleEndian.Uint32(attr.Value))
+		case unix.RTA_PRIORITY:
+			metric = binary.LittleEndian.Uint32(attr.Value)
+		}
+	}
+
+	if dst == nil || oif != index {
+		return Route{}, false
+	}
+
+	bits := 32
+
+	if rtmsg.Family == unix.AF_INET6 {
+		bits = 128
+	}
+
+	return Route{
+		Dst:     &net.IPNet{IP: dst, Mask: net.CIDRMask(int(rtmsg.Dst_len), bits)},
+		Gateway: gw,
+		Metric:  metric,
+	}, true
+}
+
+func tunAlign4(n int) int {
+	return (n + 3) &^ 3
+}
@@ -6,26 +6,11 @@ import (
 )
 
 // TAPAdapter represents a TAP adapter.
+//
+// It is satisfied by the old, per-platform tapAdapter backends (now
+// removed) and is kept around as the type DHCPClient.Adapter is declared
+// against; any Adapter also satisfies it.
 type TAPAdapter interface {
 	io.ReadWriteCloser
 	Interface() *net.Interface
 }
-
-// TAPAdapterConfig represents a TAP adapter config.
-type TAPAdapterConfig struct {
-	// Name is the name of the TAP adapter to open.
-	//
-	// The exact value of this field is operating-system-dependant.
-	//
-	// On most systems, specifying an empty name will trigger auto-assignation
-	// or device creation.
-	Name string
-
-	// IPv4 is an IPv4 address to set on the interface after its goes up.
-	IPv4 *net.IPNet
-}
-
-// NewTAPAdapterConfig instantiate a new default configuration.
-func NewTAPAdapterConfig() *TAPAdapterConfig {
-	return &TAPAdapterConfig{}
-}
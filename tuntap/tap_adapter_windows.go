@@ -2,155 +2,122 @@ package tuntap
 
 import (
 	"fmt"
-	"net"
-	"runtime"
-	"strings"
-	"syscall"
-	"unsafe"
 
-	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
 )
 
 const (
 	userModeDeviceDir = "\\\\.\\Global\\"
 	tapWinSuffix      = ".tap"
+
+	// tapAdaptersRegistryKey is the registry key Windows lists every
+	// installed network adapter under, TAP-capable ones included.
+	tapAdaptersRegistryKey = `SYSTEM\CurrentControlSet\Control\Class\{4D36E972-E325-11CE-BFC1-08002BE10318}`
+
+	// wintunComponentID is the ComponentId registry value of a Wintun
+	// adapter.
+	wintunComponentID = "Wintun"
 )
 
-type tapAdapter struct {
-	*overlappedFile
-	inf *net.Interface
+// tapComponentIDs are the ComponentId registry values a TAP-capable
+// adapter may carry: the two driver generations of TAP-Windows6, and
+// Wintun.
+var tapComponentIDs = map[string]bool{
+	"tap0901":         true,
+	"tap0801":         true,
+	wintunComponentID: true,
 }
 
-// NewTAPAdapter instantiates a new TAP adapter.
-func NewTAPAdapter(config *TAPAdapterConfig) (TAPAdapter, error) {
-	if config == nil {
-		config = NewTAPAdapterConfig()
-	}
-
-	aas, err := getAdaptersAddresses()
+// TAPAdapterInfo describes one TAP-capable adapter discovered by
+// ListTAPAdapters.
+type TAPAdapterInfo struct {
+	// Name is the adapter's device name, as used to build its device path
+	// and to match it against AdapterConfig.Name. It is identical to GUID,
+	// but named independently since callers more commonly think of it as
+	// "the adapter's name".
+	Name string
+
+	// FriendlyName is the adapter's human-readable name, as shown in the
+	// Windows "Network Connections" panel (e.g. "Ethernet 2").
+	FriendlyName string
 
-	if err != nil {
-		return nil, fmt.Errorf("failed to get adapters addresses: %s", err)
-	}
+	// ComponentID is the driver's registry ComponentId: "tap0901" or
+	// "tap0801" for TAP-Windows6, "Wintun" for Wintun.
+	ComponentID string
 
-	var aa adapterAddresses
+	// GUID is the adapter's NetCfgInstanceId, as read from the registry.
+	GUID string
 
-	for _, aa = range aas {
-		// TODO: Use the registry and do this better.
-		if strings.HasPrefix(aa.Description, "TAP") {
-			break
-		}
-	}
+	// Index is the adapter's net.Interface index.
+	Index int
+}
 
-	path := fmt.Sprintf("%s%s%s", userModeDeviceDir, aa.Name, tapWinSuffix)
-	pathp, err := syscall.UTF16PtrFromString(path)
+// ListTAPAdapters enumerates every TAP-capable adapter installed on the
+// system. It reads the network adapter class's registry key to find every
+// adapter whose ComponentId identifies it as TAP-Windows6 or Wintun, and
+// correlates each one's NetCfgInstanceId with GetAdaptersAddresses to fill
+// in its friendly name and interface index.
+func ListTAPAdapters() ([]TAPAdapterInfo, error) {
+	root, err := registry.OpenKey(registry.LOCAL_MACHINE, tapAdaptersRegistryKey, registry.READ)
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to convert path to UTF16: %s", err)
+		return nil, fmt.Errorf("opening registry key %q: %s", tapAdaptersRegistryKey, err)
 	}
 
-	h, err := windows.CreateFile(
-		pathp,
-		syscall.GENERIC_READ|syscall.GENERIC_WRITE,
-		0,
-		nil,
-		syscall.OPEN_EXISTING,
-		syscall.FILE_ATTRIBUTE_SYSTEM|syscall.FILE_FLAG_OVERLAPPED,
-		0,
-	)
+	defer root.Close()
+
+	subKeyNames, err := root.ReadSubKeyNames(0)
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to open %s: %s", path, err)
+		return nil, fmt.Errorf("enumerating registry sub-keys: %s", err)
 	}
 
-	inf, err := net.InterfaceByIndex(aa.Index)
+	aas, err := getAdaptersAddresses()
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to get interface details for `%s`: %v", aa.FriendlyName, err)
-	}
-
-	ta := &tapAdapter{
-		&overlappedFile{
-			fd:   h,
-			name: aa.Name,
-		},
-		inf,
+		return nil, fmt.Errorf("failed to get adapters addresses: %s", err)
 	}
 
-	runtime.SetFinalizer(ta.overlappedFile, (*ta.overlappedFile).Close())
-
-	return ta, nil
-}
-
-func (a *tapAdapter) Interface() *net.Interface {
-	return a.inf
-}
+	var result []TAPAdapterInfo
 
-type adapterAddresses struct {
-	Name         string
-	Description  string
-	FriendlyName string
-	Index        int
-}
+	for _, subKeyName := range subKeyNames {
+		k, err := registry.OpenKey(root, subKeyName, registry.READ)
 
-func getAdaptersAddresses() (result []adapterAddresses, err error) {
-	// MSDN recommends starting with a 15KB buffer to store the results.
-	buf := make([]byte, 15*1024)
-	size := uint32(len(buf))
-
-	for {
-		if err = windows.GetAdaptersAddresses(
-			windows.AF_UNSPEC,
-			0,
-			0,
-			(*windows.IpAdapterAddresses)(unsafe.Pointer(&buf[0])),
-			&size,
-		); err == nil {
-			break
+		if err != nil {
+			continue
 		}
 
-		if err != windows.ERROR_BUFFER_OVERFLOW {
-			return
-		}
-
-		buf = make([]byte, int(size))
-	}
+		componentID, _, err := k.GetStringValue("ComponentId")
 
-	for aa := (*windows.IpAdapterAddresses)(unsafe.Pointer(&buf[0])); aa != nil; aa = aa.Next {
-		value := adapterAddresses{
-			Name:         bytePtrToString(aa.AdapterName),
-			Description:  uint16PtrToString(aa.Description),
-			FriendlyName: uint16PtrToString(aa.FriendlyName),
-			Index:        int(aa.IfIndex),
+		if err != nil || !tapComponentIDs[componentID] {
+			k.Close()
+			continue
 		}
 
-		result = append(result, value)
-	}
-
-	return
-}
+		guid, _, err := k.GetStringValue("NetCfgInstanceId")
+		k.Close()
 
-// bytePtrToString will convert a pointer to a null-terminated string to a Go
-// string.
-func bytePtrToString(b *byte) string {
-	buf := make([]byte, 0, 256)
+		if err != nil {
+			continue
+		}
 
-	for c := unsafe.Pointer(b); *((*byte)(c)) != 0; c = unsafe.Pointer(uintptr(c) + 1) {
-		buf = append(buf, *((*byte)(c)))
+		for _, aa := range aas {
+			if aa.Name == guid {
+				result = append(result, TAPAdapterInfo{
+					Name:         aa.Name,
+					FriendlyName: aa.FriendlyName,
+					ComponentID:  componentID,
+					GUID:         guid,
+					Index:        aa.Index,
+				})
+
+				break
+			}
+		}
 	}
 
-	return string(buf)
+	return result, nil
 }
 
-func uint16PtrToString(b *uint16) string {
-	buf := make([]uint16, 0, 256)
-
-	for c := unsafe.Pointer(b); *((*uint16)(c)) != 0; c = unsafe.Pointer(uintptr(c) + unsafe.Sizeof(uint16(0))) {
-		buf = append(buf, *((*uint16)(c)))
-	}
-
-	// UTF16ToString expects a zero-terminated buffer.
-	buf = append(buf, 0)
-
-	return syscall.UTF16ToString(buf)
-}
+// adapterAddresses, getAdaptersAddresses, bytePtrToString and
+// uint16PtrToString are shared with adapter_windows.go.